@@ -0,0 +1,151 @@
+// Package admin manages accounts outside the HTTP API, it backs the users
+// command of the binary
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type Manager struct {
+	Users  store.UserStore
+	Tokens store.TokenStore
+	Policy passwords.Policy
+	// Hasher hashes the passwords of new admins
+	Hasher passwords.Hasher
+	// Denylist revokes signed auth tokens, it is nil in opaque token mode
+	Denylist *tokens.SharedDenylist
+}
+
+// FindUser looks a user up by ID, or by email when ref is not a number
+func (m *Manager) FindUser(ctx context.Context, ref string) (*store.User, error) {
+	var user *store.User
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err == nil {
+		user, err = m.Users.GetUserByID(ctx, id)
+	} else {
+		user, err = m.Users.GetUserByEmail(ctx, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, ref)
+	}
+	return user, nil
+}
+
+// CreateAdmin creates an administrator account, the password has to follow
+// the same policy as passwords chosen through the API
+func (m *Manager) CreateAdmin(ctx context.Context, email, plaintextPassword string) (*store.User, error) {
+	v := validator.New()
+	store.ValidateEmail(v, email)
+	err := v.Err()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := m.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("user with email %q already exists", email)
+	}
+	err = m.Policy.Check(ctx, plaintextPassword, email, 0, m.Users)
+	if err != nil {
+		return nil, err
+	}
+	user := &store.User{Email: email, IsAdmin: true}
+	err = user.PasswordHash.Set(m.Hasher, plaintextPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Users.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password and revokes the tokens of the user, so
+// sessions started with the old password end
+func (m *Manager) ResetPassword(ctx context.Context, user *store.User, plaintextPassword string) error {
+	err := m.Policy.Check(ctx, plaintextPassword, user.Email, int64(user.ID), m.Users)
+	if err != nil {
+		return err
+	}
+	err = m.Users.UpdatePassword(ctx, int64(user.ID), plaintextPassword)
+	if err != nil {
+		return err
+	}
+	return m.RevokeTokens(ctx, user)
+}
+
+// SetDisabled disables or enables an account, disabling also revokes its tokens
+func (m *Manager) SetDisabled(ctx context.Context, user *store.User, disabled bool) error {
+	err := m.Users.SetUserDisabled(ctx, int64(user.ID), disabled)
+	if err != nil {
+		return err
+	}
+	user.Disabled = disabled
+	if !disabled {
+		return nil
+	}
+	return m.RevokeTokens(ctx, user)
+}
+
+// RevokeTokens deletes every stored token of the user and denies the signed
+// auth tokens issued to them so far
+func (m *Manager) RevokeTokens(ctx context.Context, user *store.User) error {
+	return tokens.Revoker{Tokens: m.Tokens, Denylist: m.Denylist}.RevokeUser(ctx, int64(user.ID))
+}
+
+func (m *Manager) ListUsers(ctx context.Context) ([]*store.User, error) {
+	return m.Users.ListUsers(ctx)
+}
+
+// passwordAlphabet leaves out look-alike characters and symbols that need
+// quoting in a shell
+const passwordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789-_.+="
+
+// GeneratePassword returns a random password of length characters that
+// satisfies the character rules of the policy
+func (m *Manager) GeneratePassword(length int) (string, error) {
+	if length < m.Policy.MinLength {
+		length = m.Policy.MinLength
+	}
+	if m.Policy.MaxLength > 0 && length > m.Policy.MaxLength {
+		length = m.Policy.MaxLength
+	}
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for {
+		buf := make([]byte, length)
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			buf[i] = passwordAlphabet[n.Int64()]
+		}
+		// without the email and history the check only looks at the characters
+		err := m.Policy.Check(context.Background(), string(buf), "", 0, nil)
+		if err == nil {
+			return string(buf), nil
+		}
+		var violations passwords.Violations
+		if !errors.As(err, &violations) {
+			return "", err
+		}
+	}
+}
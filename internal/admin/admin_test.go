@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store/memstore"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+func newManager(t *testing.T) *Manager {
+	t.Helper()
+	// the cheapest hash keeps the tests fast, the algorithm doesn't matter here
+	hasher := passwords.Hasher{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 4}
+	db := memstore.New()
+	return &Manager{Users: memstore.NewUserStore(db, hasher), Tokens: memstore.NewTokenStore(db), Policy: passwords.DefaultPolicy, Hasher: hasher}
+}
+
+func TestCreateAdmin(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t)
+
+	_, err := m.CreateAdmin(ctx, "not-an-email", "Secret123")
+	assert.EqualError(t, err, "email must be a valid email address")
+
+	_, err = m.CreateAdmin(ctx, "admin@example.com", "short")
+	var violations passwords.Violations
+	assert.ErrorAs(t, err, &violations)
+
+	admin, err := m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	require.NoError(t, err)
+	assert.True(t, admin.IsAdmin)
+	stored, err := m.FindUser(ctx, "admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, stored.ID)
+	assert.True(t, stored.IsAdmin)
+	matches, err := stored.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	_, err = m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestFindUser(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t)
+	admin, err := m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	require.NoError(t, err)
+
+	byID, err := m.FindUser(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, admin.Email, byID.Email)
+	_, err = m.FindUser(ctx, "99")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = m.FindUser(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestResetPasswordRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t)
+	user, err := m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	require.NoError(t, err)
+	token, err := m.Tokens.CreateNewToken(ctx, int64(user.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	err = m.ResetPassword(ctx, user, "Secret123")
+	assert.ErrorContains(t, err, "last 5 passwords")
+	require.NoError(t, m.ResetPassword(ctx, user, "Another456"))
+
+	stored, err := m.FindUser(ctx, user.Email)
+	require.NoError(t, err)
+	matches, err := stored.PasswordHash.Matches("Another456")
+	require.NoError(t, err)
+	assert.True(t, matches)
+	owner, err := m.Users.GetUserToken(ctx, tokens.ScopeAuth, token.PlainText)
+	require.NoError(t, err)
+	assert.Nil(t, owner)
+}
+
+func TestSetDisabled(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t)
+	user, err := m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	require.NoError(t, err)
+	token, err := m.Tokens.CreateNewToken(ctx, int64(user.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	require.NoError(t, m.SetDisabled(ctx, user, true))
+	stored, err := m.Tokens.GetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, stored, "disabling revokes tokens")
+
+	require.NoError(t, m.SetDisabled(ctx, user, false))
+	users, err := m.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.False(t, users[0].Disabled)
+}
+
+func TestDisableRevokesSignedTokens(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t)
+	m.Denylist = tokens.NewSharedDenylist(m.Tokens, time.Hour)
+	user, err := m.CreateAdmin(ctx, "admin@example.com", "Secret123")
+	require.NoError(t, err)
+
+	require.NoError(t, m.SetDisabled(ctx, user, true))
+	// a server reads the revocation from the shared store
+	server := tokens.NewSharedDenylist(m.Tokens, time.Hour)
+	require.NoError(t, server.Sync(ctx))
+	claims := &tokens.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "id", Subject: strconv.Itoa(user.ID), IssuedAt: jwt.NewNumericDate(time.Now())}}
+	assert.True(t, server.IsRevoked(claims))
+}
+
+func TestGeneratePassword(t *testing.T) {
+	m := newManager(t)
+	m.Policy.RequireSymbol = true
+	for i := 0; i < 20; i++ {
+		password, err := m.GeneratePassword(16)
+		require.NoError(t, err)
+		assert.Len(t, password, 16)
+		assert.NoError(t, m.Policy.Check(context.Background(), password, "", 0, nil))
+	}
+}
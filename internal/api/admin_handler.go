@@ -0,0 +1,54 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/lockout"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/utils"
+)
+
+// AdminHandler handles requests only administrators may make
+type AdminHandler struct {
+	userStore store.UserStore
+	guard     *lockout.Guard
+	logger    *slog.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, guard *lockout.Guard, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore: userStore,
+		guard:     guard,
+		logger:    logger,
+	}
+}
+
+// HandleUnlockUser lifts the login and second factor lockouts of an account
+// before they expire, locked client IPs stay locked
+func (ah *AdminHandler) HandleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ah.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	user, err := ah.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		ah.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if user == nil {
+		apierr.Write(w, r, apierr.NotFound("User not found"))
+		return
+	}
+	err = ah.guard.Unlock(r.Context(), int64(user.ID), user.Email)
+	if err != nil {
+		ah.logger.ErrorContext(r.Context(), "error unlocking user", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "User unlocked"})
+}
@@ -0,0 +1,46 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+)
+
+func TestUnlockUser(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, user := srv.NewUser("john@example.com")
+	_, admin := srv.NewAdmin("admin@example.com")
+	path := "/admin/users/" + strconv.Itoa(userID) + "/unlock/"
+
+	for i := 0; i < 5; i++ {
+		srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": "Wrong123"})
+	}
+	res := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": apitest.Password})
+	require.Equal(t, http.StatusTooManyRequests, res.Status)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, wantStatus: http.StatusUnauthorized},
+		{name: "not an admin", path: path, token: user, wantStatus: http.StatusForbidden},
+		{name: "missing user", path: "/admin/users/9999/unlock/", token: admin, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/admin/users/abc/unlock/", token: admin, wantStatus: http.StatusBadRequest},
+		{name: "admin", path: path, token: admin, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, tt.path, tt.token, nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	srv.Login("john@example.com", apitest.Password)
+}
@@ -1,24 +1,32 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
-	"encoding/json"
-	"log"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/metrics"
+	"github.com/makhammatovb/Articles/internal/middleware"
 	"github.com/makhammatovb/Articles/internal/store"
 	"github.com/makhammatovb/Articles/internal/utils"
-	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/validator"
 )
 
 // ArticleHandler struct to handle Article-related requests for future use
 type ArticleHandler struct {
 	articleStore store.ArticleStore
-	logger       *log.Logger
+	metrics      *metrics.Metrics
+	maxBodyBytes int64
+	logger       *slog.Logger
 }
 
 // NewArticleHandler creates a new instance of ArticleHandler.
-func NewArticleHandler(articleStore store.ArticleStore, logger *log.Logger) *ArticleHandler {
+func NewArticleHandler(articleStore store.ArticleStore, metrics *metrics.Metrics, maxBodyBytes int64, logger *slog.Logger) *ArticleHandler {
 	return &ArticleHandler{
 		articleStore: articleStore,
+		metrics:      metrics,
+		maxBodyBytes: maxBodyBytes,
 		logger:       logger,
 	}
 }
@@ -33,14 +41,18 @@ func (ah *ArticleHandler) HandleGetArticleByID(w http.ResponseWriter, r *http.Re
 	// retrieves the article ID from the URL parameters
 	articleID, err := utils.ReadIDParam(r)
 	if err != nil {
-		ah.logger.Println("Error reading article ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid article ID"})
+		ah.logger.WarnContext(r.Context(), "error reading article ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid article ID"))
 		return
 	}
-	article, err := ah.articleStore.GetArticleByID(articleID)
+	article, err := ah.articleStore.GetArticleByID(r.Context(), articleID)
 	if err != nil {
-		ah.logger.Println("Error getting article by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error getting article by ID", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if article == nil {
+		apierr.Write(w, r, apierr.NotFound("Article not found"))
 		return
 	}
 
@@ -49,20 +61,36 @@ func (ah *ArticleHandler) HandleGetArticleByID(w http.ResponseWriter, r *http.Re
 
 // HandleCreateArticle handles the POST request to create a new article.
 func (ah *ArticleHandler) HandleCreateArticle(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		ah.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
 	var article store.Article
-	err := json.NewDecoder(r.Body).Decode(&article)
+	err = utils.ReadJSON(w, r, &article, ah.maxBodyBytes)
 	if err != nil {
-		ah.logger.Println("Decoding error:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		ah.logger.WarnContext(r.Context(), "decoding error", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	// articles are always written by the user creating them
+	article.AuthorID = user.ID
+	v := validator.New()
+	store.ValidateArticle(v, &article)
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
 		return
 	}
 
-	createdArticle, err := ah.articleStore.CreateArticle(&article)
+	createdArticle, err := ah.articleStore.CreateArticle(r.Context(), &article)
 	if err != nil {
-		ah.logger.Println("Error creating article:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error creating article", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
+	ah.metrics.ArticleCreated()
 
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"article": createdArticle})
 }
@@ -70,41 +98,40 @@ func (ah *ArticleHandler) HandleCreateArticle(w http.ResponseWriter, r *http.Req
 func (ah *ArticleHandler) HandleUpdateArticle(w http.ResponseWriter, r *http.Request) {
 	articleID, err := utils.ReadIDParam(r)
 	if err != nil {
-		ah.logger.Println("Error reading article ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid article ID"})
+		ah.logger.WarnContext(r.Context(), "error reading article ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid article ID"))
 		return
 	}
-	existingArticle, err := ah.articleStore.GetArticleByID(articleID)
+	existingArticle, err := ah.articleStore.GetArticleByID(r.Context(), articleID)
 	if err != nil {
-		ah.logger.Println("Error getting article by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error getting article by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if existingArticle == nil {
-		http.NotFound(w, r)
+		apierr.Write(w, r, apierr.NotFound("Article not found"))
 		return
 	}
 	var updatedArticleRequest struct {
-		Title       *string        `json:"title"`
-		Description *string        `json:"description"`
-		Image       *string        `json:"image"`
-		AuthorID    *int           `json:"author_id"`
+		Title       *string            `json:"title"`
+		Description *string            `json:"description"`
+		Image       *string            `json:"image"`
 		Paraghraps  []store.Paraghraph `json:"paraghraps"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&updatedArticleRequest)
+	err = utils.ReadJSON(w, r, &updatedArticleRequest, ah.maxBodyBytes)
 	if err != nil {
-		ah.logger.Println("error while decoding article:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		ah.logger.WarnContext(r.Context(), "error while decoding article", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	user, err := middleware.GetUser(r)
 	if err != nil {
-		ah.logger.Println("Error getting user from context:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if user.ID != existingArticle.AuthorID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this article"})
+		apierr.Write(w, r, apierr.Forbidden("You are not the owner of this article"))
 		return
 	}
 
@@ -117,16 +144,25 @@ func (ah *ArticleHandler) HandleUpdateArticle(w http.ResponseWriter, r *http.Req
 	if updatedArticleRequest.Image != nil {
 		existingArticle.Image = *updatedArticleRequest.Image
 	}
-	if updatedArticleRequest.AuthorID != nil {
-		existingArticle.AuthorID = *updatedArticleRequest.AuthorID
-	}
 	if updatedArticleRequest.Paraghraps != nil {
 		existingArticle.Paraghraps = updatedArticleRequest.Paraghraps
 	}
-	err = ah.articleStore.UpdateArticle(existingArticle)
+	v := validator.New()
+	store.ValidateArticle(v, existingArticle)
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
+	err = ah.articleStore.UpdateArticle(r.Context(), existingArticle)
+	if errors.Is(err, store.ErrUnknownParagraph) {
+		v.Add("paraghraps", validator.CodeUnknown, err.Error())
+		apierr.Write(w, r, v.Err())
+		return
+	}
 	if err != nil {
-		ah.logger.Println("Error updating article:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error updating article", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"article": existingArticle})
@@ -135,36 +171,36 @@ func (ah *ArticleHandler) HandleUpdateArticle(w http.ResponseWriter, r *http.Req
 func (ah *ArticleHandler) HandleDeleteArticle(w http.ResponseWriter, r *http.Request) {
 	articleID, err := utils.ReadIDParam(r)
 	if err != nil {
-		ah.logger.Println("Error reading article ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid article ID"})
+		ah.logger.WarnContext(r.Context(), "error reading article ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid article ID"))
 		return
 	}
-	existingArticle, err := ah.articleStore.GetArticleByID(articleID)
+	existingArticle, err := ah.articleStore.GetArticleByID(r.Context(), articleID)
 	if err != nil {
-		ah.logger.Println("Error getting article by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error getting article by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if existingArticle == nil {
-		http.NotFound(w, r)
+		apierr.Write(w, r, apierr.NotFound("Article not found"))
 		return
 	}
 	user, err := middleware.GetUser(r)
 	if err != nil {
-		ah.logger.Println("Error getting user from context:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if user.ID != existingArticle.AuthorID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this article"})
+		apierr.Write(w, r, apierr.Forbidden("You are not the owner of this article"))
 		return
 	}
 
-	err = ah.articleStore.DeleteArticle(articleID)
+	err = ah.articleStore.DeleteArticle(r.Context(), articleID)
 	if err != nil {
-		ah.logger.Println("Error deleting article:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		ah.logger.ErrorContext(r.Context(), "error deleting article", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	w.WriteHeader(http.StatusNoContent)
 }
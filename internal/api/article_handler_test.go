@@ -0,0 +1,165 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+)
+
+func createArticle(t *testing.T, srv *apitest.Server, token string) int {
+	t.Helper()
+	res := srv.Do(http.MethodPost, "/articles/", token, map[string]any{
+		"title":       "Title",
+		"description": "Description",
+		"image":       "image.png",
+		"paraghraps": []map[string]any{
+			{"headline": "First", "body": "Body 1", "order_index": 1},
+			{"headline": "Second", "body": "Body 2", "order_index": 2},
+		},
+	})
+	require.Equal(t, http.StatusCreated, res.Status, "%s", res.Raw)
+	return res.Int("article", "id")
+}
+
+func TestCreateArticle(t *testing.T) {
+	srv := apitest.NewServer(t)
+	authorID, token := srv.NewUser("author@example.com")
+
+	tests := []struct {
+		name       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", body: map[string]any{"title": "Title"}, wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", token: "not-a-token", body: map[string]any{"title": "Title"}, wantStatus: http.StatusUnauthorized},
+		{name: "malformed json", token: token, body: `{"title":`, wantStatus: http.StatusBadRequest},
+		{name: "missing title", token: token, body: map[string]any{"description": "Description"}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "valid", token: token, body: map[string]any{"title": "Title", "description": "Description"}, wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/articles/", tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		res := srv.Do(http.MethodPost, "/articles/", token, map[string]any{
+			"title": strings.Repeat("t", 256),
+			"paraghraps": []map[string]any{
+				{"headline": "First", "order_index": 1},
+				{"headline": "", "order_index": -1},
+			},
+		})
+		require.Equal(t, http.StatusUnprocessableEntity, res.Status, "%s", res.Raw)
+		assert.Equal(t, "validation_failed", res.String("code"))
+		assert.Equal(t, "title", res.String("errors", "0", "field"))
+		assert.Equal(t, "too_long", res.String("errors", "0", "code"))
+		assert.Equal(t, "paraghraps[1].headline", res.String("errors", "1", "field"))
+		assert.Equal(t, "required", res.String("errors", "1", "code"))
+		assert.Equal(t, "paraghraps[1].order_index", res.String("errors", "2", "field"))
+		assert.Len(t, res.Value("errors"), 3)
+	})
+
+	t.Run("author is the current user", func(t *testing.T) {
+		res := srv.Do(http.MethodPost, "/articles/", token, map[string]any{"title": "Title", "author_id": authorID + 100})
+		require.Equal(t, http.StatusCreated, res.Status)
+		assert.Equal(t, authorID, res.Int("article", "author_id"))
+	})
+}
+
+func TestGetArticle(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, token := srv.NewUser("author@example.com")
+	articleID := createArticle(t, srv, token)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "existing", path: "/articles/" + strconv.Itoa(articleID), wantStatus: http.StatusOK},
+		{name: "missing", path: "/articles/9999", wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/articles/abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodGet, tt.path, "", nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	res := srv.Do(http.MethodGet, "/articles/"+strconv.Itoa(articleID), "", nil)
+	paragraphs, ok := res.Value("article", "paraghraps").([]any)
+	require.True(t, ok)
+	assert.Len(t, paragraphs, 2)
+}
+
+func TestUpdateArticle(t *testing.T) {
+	srv := apitest.NewServer(t)
+	ownerID, owner := srv.NewUser("owner@example.com")
+	otherID, other := srv.NewUser("other@example.com")
+	articleID := createArticle(t, srv, owner)
+	path := "/articles/" + strconv.Itoa(articleID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, body: map[string]any{"title": "New"}, wantStatus: http.StatusUnauthorized},
+		{name: "not the owner", path: path, token: other, body: map[string]any{"title": "New"}, wantStatus: http.StatusForbidden},
+		{name: "missing", path: "/articles/9999/", token: owner, body: map[string]any{"title": "New"}, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/articles/abc/", token: owner, body: map[string]any{"title": "New"}, wantStatus: http.StatusBadRequest},
+		{name: "malformed json", path: path, token: owner, body: `{"title":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown paragraph", path: path, token: owner, body: map[string]any{"paraghraps": []map[string]any{{"id": 9999, "headline": "H"}}}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "author cannot be changed", path: path, token: owner, body: map[string]any{"author_id": otherID}, wantStatus: http.StatusBadRequest},
+		{name: "owner", path: path, token: owner, body: map[string]any{"title": "New"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPut, tt.path, tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	res := srv.Do(http.MethodGet, "/articles/"+strconv.Itoa(articleID), "", nil)
+	assert.Equal(t, "New", res.String("article", "title"))
+	assert.Equal(t, ownerID, res.Int("article", "author_id"))
+}
+
+func TestDeleteArticle(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, owner := srv.NewUser("owner@example.com")
+	_, other := srv.NewUser("other@example.com")
+	articleID := createArticle(t, srv, owner)
+	path := "/articles/" + strconv.Itoa(articleID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, wantStatus: http.StatusUnauthorized},
+		{name: "not the owner", path: path, token: other, wantStatus: http.StatusForbidden},
+		{name: "invalid id", path: "/articles/abc/", token: owner, wantStatus: http.StatusBadRequest},
+		{name: "owner", path: path, token: owner, wantStatus: http.StatusNoContent},
+		{name: "already deleted", path: path, token: owner, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodDelete, tt.path, tt.token, nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
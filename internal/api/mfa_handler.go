@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/totp"
+	"github.com/makhammatovb/Articles/internal/utils"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+const (
+	totpIssuer        = "Articles"
+	recoveryCodeCount = 10
+)
+
+// MFAHandler handles authenticator app enrollment
+type MFAHandler struct {
+	mfaStore     store.MFAStore
+	userStore    store.UserStore
+	maxBodyBytes int64
+	logger       *slog.Logger
+}
+
+func NewMFAHandler(mfaStore store.MFAStore, userStore store.UserStore, maxBodyBytes int64, logger *slog.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaStore:     mfaStore,
+		userStore:    userStore,
+		maxBodyBytes: maxBodyBytes,
+		logger:       logger,
+	}
+}
+
+// HandleEnrollTOTP generates a new secret for the current user, two-factor
+// login only starts being required after HandleConfirmTOTP
+func (mh *MFAHandler) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	// signed tokens carry no email, and the one in the account may have changed
+	account, err := mh.userStore.GetUserByID(r.Context(), int64(user.ID))
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if account == nil {
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid token"))
+		return
+	}
+
+	existing, err := mh.mfaStore.GetTOTP(r.Context(), int64(user.ID))
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error getting totp settings", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if existing != nil && existing.Enabled {
+		apierr.Write(w, r, apierr.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error generating totp secret", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = mh.mfaStore.SaveTOTPSecret(r.Context(), int64(user.ID), secret)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error saving totp secret", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, account.Email, secret),
+	})
+}
+
+// HandleConfirmTOTP enables two-factor login once the user proves their
+// authenticator works, and hands out the one-time recovery codes
+func (mh *MFAHandler) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	err = utils.ReadJSON(w, r, &req, mh.maxBodyBytes)
+	if err != nil {
+		mh.logger.WarnContext(r.Context(), "error while decoding totp confirmation", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Required("code", req.Code)
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
+
+	settings, err := mh.mfaStore.GetTOTP(r.Context(), int64(user.ID))
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error getting totp settings", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if settings == nil {
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeMFANotStarted, "Two-factor enrollment has not been started"))
+		return
+	}
+	if settings.Enabled {
+		apierr.Write(w, r, apierr.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	step, ok := totp.Validate(settings.Secret, req.Code, time.Now())
+	if !ok {
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidMFACode, "Invalid code"))
+		return
+	}
+	_, err = mh.mfaStore.MarkTOTPStepUsed(r.Context(), int64(user.ID), step)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error marking totp step", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error generating recovery codes", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = mh.mfaStore.ReplaceRecoveryCodes(r.Context(), int64(user.ID), hashes)
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error saving recovery codes", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = mh.mfaStore.EnableTOTP(r.Context(), int64(user.ID))
+	if err != nil {
+		mh.logger.ErrorContext(r.Context(), "error enabling totp", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": codes})
+}
+
+// generateRecoveryCodes returns plain codes for the user and their hashes for storage
+func generateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, n)
+	hashes := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		random := make([]byte, 6)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := encoding.EncodeToString(random)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
@@ -0,0 +1,86 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/totp"
+)
+
+func TestEnrollTOTP(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, token := srv.NewUser("john@example.com")
+
+	res := srv.Do(http.MethodPost, "/users/totp/", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+
+	res = srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	require.Equal(t, http.StatusOK, res.Status)
+	assert.NotEmpty(t, res.String("secret"))
+	assert.Contains(t, res.String("otpauth_uri"), "otpauth://totp/")
+
+	// enrolling again before confirming replaces the secret
+	again := srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	require.Equal(t, http.StatusOK, again.Status)
+	assert.NotEqual(t, res.String("secret"), again.String("secret"))
+
+	enableTOTP(t, srv, token)
+	res = srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	assert.Equal(t, http.StatusConflict, res.Status)
+}
+
+func TestEnrollTOTPUsesCurrentEmail(t *testing.T) {
+	srv := apitest.NewServer(t, func(cfg *config.Config) {
+		cfg.Tokens.Mode = tokens.ModeJWT
+		cfg.Tokens.KeysDir = t.TempDir()
+	})
+	userID, token := srv.NewUser("john@example.com")
+	res := srv.Do(http.MethodPut, "/users/"+strconv.Itoa(userID)+"/", token, map[string]any{"email": "johnny@example.com"})
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+
+	// the signed token still names the old email
+	res = srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	assert.Contains(t, res.String("otpauth_uri"), "johnny@example.com")
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, token := srv.NewUser("john@example.com")
+
+	res := srv.Do(http.MethodPost, "/users/totp/confirm/", token, map[string]any{"code": "123456"})
+	assert.Equal(t, http.StatusBadRequest, res.Status, "enrollment not started")
+
+	res = srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	require.Equal(t, http.StatusOK, res.Status)
+	secret := res.String("secret")
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", body: map[string]any{"code": code}, wantStatus: http.StatusUnauthorized},
+		{name: "malformed json", token: token, body: `{"code":`, wantStatus: http.StatusBadRequest},
+		{name: "wrong code", token: token, body: map[string]any{"code": "000000"}, wantStatus: http.StatusBadRequest},
+		{name: "valid code", token: token, body: map[string]any{"code": code}, wantStatus: http.StatusOK},
+		{name: "already enabled", token: token, body: map[string]any{"code": code}, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/users/totp/confirm/", tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
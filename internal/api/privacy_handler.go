@@ -0,0 +1,248 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/utils"
+)
+
+// ErasurePolicy decides what happens when users delete their account
+type ErasurePolicy struct {
+	// GracePeriod is how long the account can still be restored, 0 erases
+	// it right away
+	GracePeriod time.Duration
+	// KeepArticles and KeepReviews keep that content under an anonymized
+	// author instead of deleting it
+	KeepArticles bool
+	KeepReviews  bool
+}
+
+// PrivacyHandler lets users download their data and erase their account
+type PrivacyHandler struct {
+	privacyStore store.PrivacyStore
+	policy       ErasurePolicy
+	// denylist is nil in opaque token mode, where erasing deletes the tokens
+	denylist *tokens.SharedDenylist
+	logger   *slog.Logger
+}
+
+func NewPrivacyHandler(privacyStore store.PrivacyStore, policy ErasurePolicy, denylist *tokens.SharedDenylist, logger *slog.Logger) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyStore: privacyStore,
+		policy:       policy,
+		denylist:     denylist,
+		logger:       logger,
+	}
+}
+
+// exportedArticle is an article without its paragraphs, which get a file
+// of their own
+type exportedArticle struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Image       string    `json:"image"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type exportedParagraph struct {
+	ArticleID int `json:"article_id"`
+	store.Paraghraph
+}
+
+// HandleExportUserData sends a ZIP archive with a JSON file for the
+// profile, articles, paragraphs, reviews and sessions of the user
+func (ph *PrivacyHandler) HandleExportUserData(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, ph.logger, userID) {
+		return
+	}
+	data, err := ph.privacyStore.GetUserData(r.Context(), userID)
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error getting user data", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if data == nil {
+		apierr.Write(w, r, apierr.NotFound("User not found"))
+		return
+	}
+	erasure, err := ph.privacyStore.GetErasure(r.Context(), userID)
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error getting erasure", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	articles := make([]exportedArticle, 0, len(data.Articles))
+	paragraphs := []exportedParagraph{}
+	for _, article := range data.Articles {
+		articles = append(articles, exportedArticle{
+			ID:          article.ID,
+			Title:       article.Title,
+			Description: article.Description,
+			Image:       article.Image,
+			CreatedAt:   article.CreatedAt,
+			UpdatedAt:   article.UpdatedAt,
+		})
+		for _, paragraph := range article.Paraghraps {
+			paragraphs = append(paragraphs, exportedParagraph{ArticleID: article.ID, Paraghraph: paragraph})
+		}
+	}
+
+	// built in memory so a failure can still be answered with an error
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", utils.Envelope{"user": data.User, "erasure": erasure}},
+		{"articles.json", articles},
+		{"paragraphs.json", paragraphs},
+		{"reviews.json", data.Reviews},
+		{"sessions.json", data.Sessions},
+	}
+	for _, file := range files {
+		err = writeZipJSON(archive, file.name, file.content)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error building data export", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.zip"`, userID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func writeZipJSON(archive *zip.Writer, name string, content any) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(content)
+}
+
+// HandleDeleteUser schedules the erasure of the account, which becomes
+// final after the grace period. Without a grace period it is erased now.
+func (ph *PrivacyHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, ph.logger, userID) {
+		return
+	}
+
+	now := time.Now().UTC()
+	erasure := &store.Erasure{
+		UserID:       userID,
+		RequestedAt:  now,
+		EraseAfter:   now.Add(ph.policy.GracePeriod),
+		KeepArticles: ph.policy.KeepArticles,
+		KeepReviews:  ph.policy.KeepReviews,
+	}
+	if ph.policy.GracePeriod == 0 {
+		// signed tokens are denied first, a failure leaves the account intact
+		if ph.denylist != nil {
+			err = ph.denylist.RevokeUser(r.Context(), userID)
+			if err != nil {
+				ph.logger.ErrorContext(r.Context(), "error revoking signed tokens", "error", err)
+				apierr.Write(w, r, err)
+				return
+			}
+		}
+		err = ph.privacyStore.EraseUser(r.Context(), erasure)
+		if err != nil {
+			ph.logger.ErrorContext(r.Context(), "error erasing user", "error", err)
+			apierr.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = ph.privacyStore.ScheduleErasure(r.Context(), erasure)
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error scheduling erasure", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"erasure": erasure})
+}
+
+// HandleGetErasure shows the pending erasure of the account
+func (ph *PrivacyHandler) HandleGetErasure(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, ph.logger, userID) {
+		return
+	}
+	erasure, err := ph.privacyStore.GetErasure(r.Context(), userID)
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error getting erasure", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if erasure == nil {
+		apierr.Write(w, r, apierr.NotFound("No erasure is pending"))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"erasure": erasure})
+}
+
+// HandleCancelErasure keeps the account during the grace period
+func (ph *PrivacyHandler) HandleCancelErasure(w http.ResponseWriter, r *http.Request) {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, ph.logger, userID) {
+		return
+	}
+	cancelled, err := ph.privacyStore.CancelErasure(r.Context(), userID)
+	if err != nil {
+		ph.logger.ErrorContext(r.Context(), "error cancelling erasure", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if !cancelled {
+		apierr.Write(w, r, apierr.NotFound("No erasure is pending"))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "Erasure cancelled"})
+}
@@ -0,0 +1,136 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+// readZip returns the decoded JSON files of an archive by name
+func readZip(t *testing.T, raw []byte) map[string]any {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	require.NoError(t, err)
+	files := map[string]any{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+		var content any
+		require.NoError(t, json.Unmarshal(data, &content), "decoding %s", file.Name)
+		files[file.Name] = content
+	}
+	return files
+}
+
+func TestExportUserData(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	createArticle(t, srv, token)
+	createReview(t, srv, token, createArticle(t, srv, other))
+	path := "/users/" + strconv.Itoa(userID) + "/export/"
+
+	res := srv.Do(http.MethodGet, path, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+	res = srv.Do(http.MethodGet, path, other, nil)
+	assert.Equal(t, http.StatusForbidden, res.Status)
+
+	res = srv.Do(http.MethodGet, path, token, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	assert.Equal(t, "application/zip", res.Header.Get("Content-Type"))
+	files := readZip(t, res.Raw)
+	require.Len(t, files, 5)
+
+	profile := files["profile.json"].(map[string]any)
+	assert.Equal(t, "john@example.com", profile["user"].(map[string]any)["email"])
+	assert.Nil(t, profile["erasure"])
+	assert.Len(t, files["articles.json"], 1)
+	assert.Len(t, files["paragraphs.json"], 2)
+	assert.Len(t, files["reviews.json"], 1)
+	sessions := files["sessions.json"].([]any)
+	require.Len(t, sessions, 1)
+	assert.NotContains(t, sessions[0], "hash", "tokens stay secret")
+}
+
+func TestErasureGracePeriod(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	path := "/users/" + strconv.Itoa(userID) + "/"
+
+	res := srv.Do(http.MethodGet, path+"erasure/", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.Status)
+	res = srv.Do(http.MethodDelete, path, other, nil)
+	assert.Equal(t, http.StatusForbidden, res.Status)
+
+	res = srv.Do(http.MethodDelete, path, token, nil)
+	require.Equal(t, http.StatusAccepted, res.Status, "%s", res.Raw)
+	eraseAfter := res.String("erasure", "erase_after")
+	assert.NotEmpty(t, eraseAfter)
+	assert.Equal(t, true, res.Value("erasure", "keep_reviews"))
+
+	// the account works until the grace period ends, asking again changes nothing
+	res = srv.Do(http.MethodDelete, path, token, nil)
+	require.Equal(t, http.StatusAccepted, res.Status, "%s", res.Raw)
+	assert.Equal(t, eraseAfter, res.String("erasure", "erase_after"))
+	res = srv.Do(http.MethodGet, path+"erasure/", token, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	assert.Equal(t, userID, res.Int("erasure", "user_id"))
+
+	res = srv.Do(http.MethodDelete, path+"erasure/", other, nil)
+	assert.Equal(t, http.StatusForbidden, res.Status)
+	res = srv.Do(http.MethodDelete, path+"erasure/", token, nil)
+	assert.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	res = srv.Do(http.MethodDelete, path+"erasure/", token, nil)
+	assert.Equal(t, http.StatusNotFound, res.Status)
+}
+
+func TestEraseKeepingReviews(t *testing.T) {
+	srv := apitest.NewServer(t, func(cfg *config.Config) { cfg.Privacy.ErasureGracePeriod = 0 })
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	reviewID := createReview(t, srv, token, createArticle(t, srv, other))
+
+	res := srv.Do(http.MethodDelete, "/users/"+strconv.Itoa(userID)+"/", token, nil)
+	require.Equal(t, http.StatusNoContent, res.Status, "%s", res.Raw)
+
+	res = srv.Do(http.MethodGet, "/reviews/"+strconv.Itoa(reviewID), other, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	res = srv.Do(http.MethodGet, "/users/"+strconv.Itoa(userID), other, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	assert.Equal(t, "Deleted user", res.String("user", "firstname"))
+	assert.NotEqual(t, "john@example.com", res.String("user", "email"))
+
+	// the email can be registered again
+	srv.Register("john@example.com")
+}
+
+func TestEraseRevokesSignedTokens(t *testing.T) {
+	srv := apitest.NewServer(t, func(cfg *config.Config) {
+		cfg.Privacy.ErasureGracePeriod = 0
+		cfg.Privacy.KeepReviews = true
+		cfg.Tokens.Mode = tokens.ModeJWT
+		cfg.Tokens.KeysDir = t.TempDir()
+	})
+	userID, token := srv.NewUser("john@example.com")
+	path := "/users/" + strconv.Itoa(userID) + "/"
+
+	res := srv.Do(http.MethodDelete, path, token, nil)
+	require.Equal(t, http.StatusNoContent, res.Status, "%s", res.Raw)
+	res = srv.Do(http.MethodGet, path+"export/", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Status, "the signed token of the erased account is denied")
+}
@@ -1,26 +1,32 @@
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/metrics"
+	"github.com/makhammatovb/Articles/internal/middleware"
 	"github.com/makhammatovb/Articles/internal/store"
 	"github.com/makhammatovb/Articles/internal/utils"
-	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/validator"
 )
 
 type ReviewHandler struct {
-	reviewStore store.ReviewStore
+	reviewStore  store.ReviewStore
 	articleStore store.ArticleStore
-	logger      *log.Logger
+	metrics      *metrics.Metrics
+	maxBodyBytes int64
+	logger       *slog.Logger
 }
 
-func NewReviewHandler(reviewStore store.ReviewStore, articleStore store.ArticleStore, logger *log.Logger) *ReviewHandler {
+func NewReviewHandler(reviewStore store.ReviewStore, articleStore store.ArticleStore, metrics *metrics.Metrics, maxBodyBytes int64, logger *slog.Logger) *ReviewHandler {
 	return &ReviewHandler{
-		reviewStore: reviewStore,
+		reviewStore:  reviewStore,
 		articleStore: articleStore,
-		logger:      logger,
+		metrics:      metrics,
+		maxBodyBytes: maxBodyBytes,
+		logger:       logger,
 	}
 }
 
@@ -28,170 +34,182 @@ func (rh *ReviewHandler) HandleGetReviewByID(w http.ResponseWriter, r *http.Requ
 
 	reviewID, err := utils.ReadIDParam(r)
 	if err != nil {
-		rh.logger.Println("Error reading review ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid review ID"})
+		rh.logger.WarnContext(r.Context(), "error reading review ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid review ID"))
 		return
 	}
-	
-	review, err := rh.reviewStore.GetReviewByID(reviewID)
+
+	review, err := rh.reviewStore.GetReviewByID(r.Context(), reviewID)
 	if err != nil {
-		rh.logger.Println("Error getting review by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error getting review by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if review == nil {
-		http.NotFound(w, r)
+		apierr.Write(w, r, apierr.NotFound("Review not found"))
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"review": review})
 }
 
 func (rh *ReviewHandler) HandleCreateReview(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("userID").(int64)
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	userID := int64(user.ID)
 	var review store.Review
-	err := json.NewDecoder(r.Body).Decode(&review)
+	err = utils.ReadJSON(w, r, &review, rh.maxBodyBytes)
 	if err != nil {
-		rh.logger.Println("Decoding error:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		rh.logger.WarnContext(r.Context(), "decoding error", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	review.AuthorID = userID
-	articleExists, err := rh.articleStore.ArticleExists(review.ArticleID)
-    if err != nil {
-        rh.logger.Println("Error checking article existence:", err)
-        utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
-        return
-    }
-    if !articleExists {
-        utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Article not found"})
-        return
-    }
-	articleAuthorID, err := rh.articleStore.GetArticleAuthorID(review.ArticleID)
-    if err != nil {
-        rh.logger.Println("Error getting article author:", err)
-        utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
-        return
-    }
-    if articleAuthorID == userID {
-        utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "Cannot review your own article"})
-        return
-    }
-	existingReview, err := rh.reviewStore.GetReviewByUserAndArticle(userID, review.ArticleID)
-    if err != nil {
-        rh.logger.Println("Error checking existing review:", err)
-        utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
-        return
-    }
-    if existingReview != nil {
-        utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "You have already reviewed this article"})
-        return
-    }
-	createdReview, err := rh.reviewStore.CreateReview(&review)
-	if err != nil {
-		rh.logger.Println("Error creating review:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+	v := validator.New()
+	store.ValidateReview(v, &review)
+	articleExists, err := rh.articleStore.ArticleExists(r.Context(), review.ArticleID)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error checking article existence", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
+	v.Check(articleExists, "article_id", validator.CodeUnknown, "Article not found")
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
+	articleAuthorID, err := rh.articleStore.GetArticleAuthorID(r.Context(), review.ArticleID)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error getting article author", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if articleAuthorID == userID {
+		apierr.Write(w, r, apierr.Forbidden("Cannot review your own article"))
+		return
+	}
+	existingReview, err := rh.reviewStore.GetReviewByUserAndArticle(r.Context(), userID, review.ArticleID)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error checking existing review", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if existingReview != nil {
+		apierr.Write(w, r, apierr.Conflict("You have already reviewed this article"))
+		return
+	}
+	createdReview, err := rh.reviewStore.CreateReview(r.Context(), &review)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error creating review", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	rh.metrics.ReviewCreated()
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"review": createdReview})
 }
 
 func (rh *ReviewHandler) HandleUpdateReview(w http.ResponseWriter, r *http.Request) {
 	reviewID, err := utils.ReadIDParam(r)
 	if err != nil {
-		rh.logger.Println("Error reading review ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid review ID"})
+		rh.logger.WarnContext(r.Context(), "error reading review ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid review ID"))
 		return
 	}
-	existingReview, err := rh.reviewStore.GetReviewByID(reviewID)
+	existingReview, err := rh.reviewStore.GetReviewByID(r.Context(), reviewID)
 	if err != nil {
-		rh.logger.Println("Error getting review by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error getting review by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if existingReview == nil {
-		http.NotFound(w, r)
+		apierr.Write(w, r, apierr.NotFound("Review not found"))
 		return
 	}
 	user, err := middleware.GetUser(r)
 	if err != nil {
-		rh.logger.Println("Error getting user from context:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if user.ID != int(existingReview.AuthorID) {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You are not the owner of this review"})
+		apierr.Write(w, r, apierr.Forbidden("You are not the owner of this review"))
 		return
 	}
 	var updatedReviewRequest struct {
 		Stars *int    `json:"stars"`
 		Note  *string `json:"note"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&updatedReviewRequest)
+	err = utils.ReadJSON(w, r, &updatedReviewRequest, rh.maxBodyBytes)
 	if err != nil {
-		rh.logger.Println("error while decoding review:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		rh.logger.WarnContext(r.Context(), "error while decoding review", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-	if updatedReviewRequest.Stars != nil {
-		if *updatedReviewRequest.Stars < 1 || *updatedReviewRequest.Stars > 5 {
-			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Stars must be between 1 and 5"})
-			return
-		}
-		existingReview.Stars = *updatedReviewRequest.Stars
-	}
 	if updatedReviewRequest.Stars != nil {
 		existingReview.Stars = *updatedReviewRequest.Stars
 	}
 	if updatedReviewRequest.Note != nil {
 		existingReview.Note = updatedReviewRequest.Note
 	}
-	err = rh.reviewStore.UpdateReview(existingReview)
+	v := validator.New()
+	store.ValidateReview(v, existingReview)
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
+	err = rh.reviewStore.UpdateReview(r.Context(), existingReview)
 	if err != nil {
-		rh.logger.Println("Error updating review:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error updating review", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"review": existingReview})
 }
 
 func (rh *ReviewHandler) HandleDeleteReview(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(int64)
-	if !ok {
-		rh.logger.Println("User ID not found in context")
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Authentication required"})
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		rh.logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
+	userID := int64(user.ID)
 
 	reviewID, err := utils.ReadIDParam(r)
 	if err != nil {
-		rh.logger.Println("Error reading review ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid review ID"})
+		rh.logger.WarnContext(r.Context(), "error reading review ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid review ID"))
 		return
 	}
-	
-	existingReview, err := rh.reviewStore.GetReviewByID(reviewID)
+
+	existingReview, err := rh.reviewStore.GetReviewByID(r.Context(), reviewID)
 	if err != nil {
-		rh.logger.Println("Error getting review by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error getting review by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
 	if existingReview == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Review not found"})
+		apierr.Write(w, r, apierr.NotFound("Review not found"))
 		return
 	}
 
 	if existingReview.AuthorID != userID {
-		rh.logger.Printf("User %d attempted to delete review %d owned by user %d", userID, reviewID, existingReview.AuthorID)
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You can only delete your own reviews"})
+		rh.logger.WarnContext(r.Context(), "user attempted to delete a review they do not own", "user_id", userID, "review_id", reviewID, "owner_id", existingReview.AuthorID)
+		apierr.Write(w, r, apierr.Forbidden("You can only delete your own reviews"))
 		return
 	}
 
-	err = rh.reviewStore.DeleteReview(reviewID)
+	err = rh.reviewStore.DeleteReview(r.Context(), reviewID)
 	if err != nil {
-		rh.logger.Println("Error deleting review:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		rh.logger.ErrorContext(r.Context(), "error deleting review", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+)
+
+func TestCreateReview(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, author := srv.NewUser("author@example.com")
+	reviewerID, reviewer := srv.NewUser("reviewer@example.com")
+	articleID := createArticle(t, srv, author)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", body: map[string]any{"article_id": articleID, "stars": 5}, wantStatus: http.StatusUnauthorized},
+		{name: "malformed json", token: reviewer, body: `{"stars":`, wantStatus: http.StatusBadRequest},
+		{name: "stars as string", token: reviewer, body: map[string]any{"article_id": articleID, "stars": "five"}, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", token: reviewer, body: map[string]any{"article_id": articleID, "stars": 5, "rating": 5}, wantStatus: http.StatusBadRequest},
+		{name: "stars out of range", token: reviewer, body: map[string]any{"article_id": articleID, "stars": 6}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "missing article", token: reviewer, body: map[string]any{"article_id": 9999, "stars": 5}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "own article", token: author, body: map[string]any{"article_id": articleID, "stars": 5}, wantStatus: http.StatusForbidden},
+		{name: "valid", token: reviewer, body: map[string]any{"article_id": articleID, "stars": 4, "note": "Nice"}, wantStatus: http.StatusCreated},
+		{name: "second review", token: reviewer, body: map[string]any{"article_id": articleID, "stars": 3}, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/reviews/", tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	t.Run("author is the current user", func(t *testing.T) {
+		_, author2 := srv.NewUser("author2@example.com")
+		otherArticle := createArticle(t, srv, author2)
+		res := srv.Do(http.MethodPost, "/reviews/", reviewer, map[string]any{"article_id": otherArticle, "stars": 5, "author_id": 9999})
+		require.Equal(t, http.StatusCreated, res.Status, "%s", res.Raw)
+		assert.Equal(t, reviewerID, res.Int("review", "author_id"))
+	})
+}
+
+func createReview(t *testing.T, srv *apitest.Server, token string, articleID int) int {
+	t.Helper()
+	res := srv.Do(http.MethodPost, "/reviews/", token, map[string]any{"article_id": articleID, "stars": 4})
+	require.Equal(t, http.StatusCreated, res.Status, "%s", res.Raw)
+	return res.Int("review", "id")
+}
+
+func TestGetReview(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, author := srv.NewUser("author@example.com")
+	_, reviewer := srv.NewUser("reviewer@example.com")
+	reviewID := createReview(t, srv, reviewer, createArticle(t, srv, author))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "existing", path: "/reviews/" + strconv.Itoa(reviewID), wantStatus: http.StatusOK},
+		{name: "missing", path: "/reviews/9999", wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/reviews/abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodGet, tt.path, "", nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
+
+func TestUpdateReview(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, author := srv.NewUser("author@example.com")
+	_, reviewer := srv.NewUser("reviewer@example.com")
+	reviewID := createReview(t, srv, reviewer, createArticle(t, srv, author))
+	path := "/reviews/" + strconv.Itoa(reviewID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, body: map[string]any{"stars": 5}, wantStatus: http.StatusUnauthorized},
+		{name: "not the owner", path: path, token: author, body: map[string]any{"stars": 5}, wantStatus: http.StatusForbidden},
+		{name: "missing", path: "/reviews/9999/", token: reviewer, body: map[string]any{"stars": 5}, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/reviews/abc/", token: reviewer, body: map[string]any{"stars": 5}, wantStatus: http.StatusBadRequest},
+		{name: "malformed json", path: path, token: reviewer, body: `{"stars":`, wantStatus: http.StatusBadRequest},
+		{name: "stars out of range", path: path, token: reviewer, body: map[string]any{"stars": 0}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "owner", path: path, token: reviewer, body: map[string]any{"stars": 5, "note": "Changed my mind"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPut, tt.path, tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	res := srv.Do(http.MethodGet, "/reviews/"+strconv.Itoa(reviewID), "", nil)
+	assert.Equal(t, 5, res.Int("review", "stars"))
+	assert.Equal(t, "Changed my mind", res.String("review", "note"))
+}
+
+func TestDeleteReview(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, author := srv.NewUser("author@example.com")
+	_, reviewer := srv.NewUser("reviewer@example.com")
+	reviewID := createReview(t, srv, reviewer, createArticle(t, srv, author))
+	path := "/reviews/" + strconv.Itoa(reviewID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, wantStatus: http.StatusUnauthorized},
+		{name: "not the owner", path: path, token: author, wantStatus: http.StatusForbidden},
+		{name: "invalid id", path: "/reviews/abc/", token: reviewer, wantStatus: http.StatusBadRequest},
+		{name: "owner", path: path, token: reviewer, wantStatus: http.StatusNoContent},
+		{name: "already deleted", path: path, token: reviewer, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodDelete, tt.path, tt.token, nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
@@ -1,21 +1,49 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
-	"encoding/json"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/lockout"
+	"github.com/makhammatovb/Articles/internal/metrics"
+	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/notify"
+	"github.com/makhammatovb/Articles/internal/passwords"
 	"github.com/makhammatovb/Articles/internal/store"
 	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/totp"
 	"github.com/makhammatovb/Articles/internal/utils"
+	"github.com/makhammatovb/Articles/internal/validator"
 )
 
+// TokenTTLs are the lifetimes of the tokens TokenHandler issues
+type TokenTTLs struct {
+	Auth          time.Duration
+	ResetPassword time.Duration
+	MFAChallenge  time.Duration
+}
+
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore   store.TokenStore
+	userStore    store.UserStore
+	mfaStore     store.MFAStore
+	jwt          *tokens.JWTManager
+	guard        *lockout.Guard
+	clientIP     utils.ClientIPResolver
+	notifier     notify.Notifier
+	policy       passwords.Policy
+	hasher       passwords.Hasher
+	revoker      tokens.Revoker
+	ttls         TokenTTLs
+	metrics      *metrics.Metrics
+	maxBodyBytes int64
+	logger       *slog.Logger
 }
 
 type createTokenRequest struct {
@@ -23,107 +51,393 @@ type createTokenRequest struct {
 	Password string `json:"password"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+// NewTokenHandler creates a TokenHandler, jwt may be nil to issue opaque database tokens
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, mfaStore store.MFAStore, jwt *tokens.JWTManager, guard *lockout.Guard, clientIP utils.ClientIPResolver, notifier notify.Notifier, policy passwords.Policy, hasher passwords.Hasher, revoker tokens.Revoker, ttls TokenTTLs, metrics *metrics.Metrics, maxBodyBytes int64, logger *slog.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:   tokenStore,
+		userStore:    userStore,
+		mfaStore:     mfaStore,
+		jwt:          jwt,
+		guard:        guard,
+		clientIP:     clientIP,
+		notifier:     notifier,
+		policy:       policy,
+		hasher:       hasher,
+		revoker:      revoker,
+		ttls:         ttls,
+		metrics:      metrics,
+		maxBodyBytes: maxBodyBytes,
+		logger:       logger,
+	}
+}
+
+// issueAuthToken creates a signed token in JWT mode and a stored opaque token otherwise
+func (h *TokenHandler) issueAuthToken(ctx context.Context, user *store.User) (*tokens.Token, error) {
+	var token *tokens.Token
+	var err error
+	if h.jwt != nil {
+		token, err = h.jwt.Issue(int64(user.ID), user.Email, h.ttls.Auth, tokens.ScopeAuth)
+	} else {
+		token, err = h.tokenStore.CreateNewToken(ctx, int64(user.ID), h.ttls.Auth, tokens.ScopeAuth)
+	}
+	if err != nil {
+		return nil, err
 	}
+	h.metrics.TokenIssued(tokens.ScopeAuth)
+	return token, nil
 }
 
 func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var req createTokenRequest
 
-	h.logger.Println(r.Body)
+	err := utils.ReadJSON(w, r, &req, h.maxBodyBytes)
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "error while decoding token", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Required("email", req.Email)
+	v.Required("password", req.Password)
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	ip := h.clientIP.ClientIP(r)
+	retryAfter, err := h.guard.RetryAfter(r.Context(), req.Email, ip)
 	if err != nil {
-		h.logger.Println("error while decoding token:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		h.logger.ErrorContext(r.Context(), "error while checking login lockout", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if retryAfter > 0 {
+		h.metrics.Login(metrics.LoginLocked)
+		setRetryAfter(w, retryAfter)
+		apierr.Write(w, r, apierr.New(http.StatusTooManyRequests, apierr.CodeTooManyAttempts, "Too many failed login attempts, try again later"))
 		return
 	}
 
-	user, err := h.userStore.GetUserByEmail(req.Email)
-	if err != nil{
-		h.logger.Println("error while getting user:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
 	if user == nil {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
+		// burn the same time as a real password check so unknown emails can't be detected
+		store.SimulatePasswordCheck(h.hasher, req.Password)
+		h.loginFailed(w, r, req.Email, ip, nil)
 		return
 	}
 
 	passwordsDoMatch, err := user.PasswordHash.Matches(req.Password)
 	if err != nil {
-		h.logger.Println("error while comparing passwords:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error while comparing passwords", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
 	if !passwordsDoMatch {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid credentials"})
+		h.loginFailed(w, r, req.Email, ip, user)
+		return
+	}
+
+	// only told after the right password, so it doesn't reveal the account
+	if user.Disabled {
+		h.metrics.Login(metrics.LoginDisabled)
+		apierr.Write(w, r, apierr.New(http.StatusForbidden, apierr.CodeAccountDisabled, "Account is disabled"))
+		return
+	}
+
+	err = h.guard.Succeed(r.Context(), req.Email)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while resetting login failures", "error", err)
+	}
+
+	// upgrade hashes made with an older algorithm or cost while we have the plaintext
+	if user.PasswordHash.NeedsRehash(h.hasher) {
+		err = user.PasswordHash.Set(h.hasher, req.Password)
+		if err == nil {
+			err = h.userStore.UpdatePasswordHash(r.Context(), user)
+		}
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while rehashing password", "error", err)
+		}
+	}
+
+	settings, err := h.mfaStore.GetTOTP(r.Context(), int64(user.ID))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting totp settings", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if settings != nil && settings.Enabled {
+		challenge, err := h.tokenStore.CreateNewToken(r.Context(), int64(user.ID), h.ttls.MFAChallenge, tokens.ScopeMFAChallenge)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while creating mfa challenge", "error", err)
+			apierr.Write(w, r, err)
+			return
+		}
+		h.metrics.TokenIssued(tokens.ScopeMFAChallenge)
+		h.metrics.Login(metrics.LoginMFARequired)
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"mfa_required": true, "mfa_token": challenge})
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(int64(user.ID), 24*time.Hour, tokens.ScopeAuth)
+	token, err := h.issueAuthToken(r.Context(), user)
 	if err != nil {
-		h.logger.Println("error while creating token:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error while creating token", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
+	h.metrics.Login(metrics.LoginSuccess)
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"token": token})
 }
 
-func (h *TokenHandler) GenerateResetPasswordToken(w http.ResponseWriter, r *http.Request) {
+// loginFailed records a failed login, tells the owner when their account got
+// locked and answers with the same response whether the account exists or not
+func (h *TokenHandler) loginFailed(w http.ResponseWriter, r *http.Request, email, ip string, user *store.User) {
+	h.metrics.Login(metrics.LoginFailure)
+	locked, err := h.guard.Fail(r.Context(), email, ip)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while recording login failure", "error", err)
+	}
+	if locked && user != nil {
+		err = h.notifier.Notify(user.Email, "Account temporarily locked",
+			"Your account was locked after several failed login attempts. If this wasn't you, consider changing your password.")
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while sending lockout notification", "error", err)
+		}
+	}
+	apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidCredentials, "Invalid credentials"))
+}
+
+// setRetryAfter tells the client how many whole seconds to wait
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// mfaLocked drops the user's pending challenges, so the password has to be
+// entered again once the lock is over, and answers with 429
+func (h *TokenHandler) mfaLocked(w http.ResponseWriter, r *http.Request, userID int64, wait time.Duration) {
+	err := h.tokenStore.DeleteAllTokensForUser(r.Context(), userID, tokens.ScopeMFAChallenge)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while deleting mfa challenges", "error", err)
+	}
+	setRetryAfter(w, wait)
+	apierr.Write(w, r, apierr.New(http.StatusTooManyRequests, apierr.CodeTooManyAttempts, "Too many wrong codes, try again later"))
+}
+
+// HandleVerifyMFA exchanges an mfa challenge token and a TOTP or recovery code for an auth token
+func (h *TokenHandler) HandleVerifyMFA(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Email string `json:"email"`
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := utils.ReadJSON(w, r, &req, h.maxBodyBytes)
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "error while decoding mfa request", "error", err)
+		apierr.Write(w, r, err)
+		return
 	}
-	err := json.NewDecoder(r.Body).Decode(&req)
+	v := validator.New()
+	v.Required("mfa_token", req.MFAToken)
+	v.Check(req.Code != "" || req.RecoveryCode != "", "code", validator.CodeRequired, "code or recovery_code is required")
+	err = v.Err()
 	if err != nil {
-		h.logger.Println("error while decoding password reset request:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		apierr.Write(w, r, err)
 		return
 	}
 
-	if req.Email == "" {
-		h.logger.Println("email is required for password reset")
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Email is required"})
+	hash := sha256.Sum256([]byte(req.MFAToken))
+	challenge, err := h.tokenStore.GetToken(r.Context(), hash[:])
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting mfa challenge", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if challenge == nil || challenge.Scope != tokens.ScopeMFAChallenge || challenge.Expiry.Before(time.Now()) {
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "Invalid or expired mfa token"))
 		return
 	}
 
-	user, err := h.userStore.GetUserByEmail(req.Email)
+	settings, err := h.mfaStore.GetTOTP(r.Context(), challenge.UserID)
 	if err != nil {
-		h.logger.Println("Error reading user email:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user email"})
+		h.logger.ErrorContext(r.Context(), "error while getting totp settings", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if settings == nil || !settings.Enabled {
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "Invalid or expired mfa token"))
 		return
 	}
 
+	retryAfter, err := h.guard.MFARetryAfter(r.Context(), challenge.UserID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while checking mfa lockout", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if retryAfter > 0 {
+		h.mfaLocked(w, r, challenge.UserID, retryAfter)
+		return
+	}
+
+	var verified bool
+	if req.Code != "" {
+		step, ok := totp.Validate(settings.Secret, req.Code, time.Now())
+		if ok {
+			// a code is only good once, even inside its time window
+			verified, err = h.mfaStore.MarkTOTPStepUsed(r.Context(), challenge.UserID, step)
+		}
+	} else {
+		verified, err = h.mfaStore.UseRecoveryCode(r.Context(), challenge.UserID, hashRecoveryCode(req.RecoveryCode))
+	}
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while verifying second factor", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if !verified {
+		lockedFor, err := h.guard.FailMFA(r.Context(), challenge.UserID)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while recording mfa failure", "error", err)
+		}
+		if lockedFor > 0 {
+			h.mfaLocked(w, r, challenge.UserID, lockedFor)
+			return
+		}
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidMFACode, "Invalid code"))
+		return
+	}
+	err = h.guard.SucceedMFA(r.Context(), challenge.UserID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while resetting mfa failures", "error", err)
+	}
+
+	user, err := h.userStore.GetUserByID(r.Context(), challenge.UserID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while getting user", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
 	if user == nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "No user found with the provided email"})
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "Invalid or expired mfa token"))
+		return
+	}
+	if user.Disabled {
+		apierr.Write(w, r, apierr.New(http.StatusForbidden, apierr.CodeAccountDisabled, "Account is disabled"))
+		return
+	}
+
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), challenge.UserID, tokens.ScopeMFAChallenge)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while deleting mfa challenge", "error", err)
+	}
+
+	token, err := h.issueAuthToken(r.Context(), user)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error while creating token", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"token": token})
+}
+
+// HandleRevokeToken revokes the token used to authenticate the request
+func (h *TokenHandler) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	plainText, ok := middleware.BearerToken(r)
+	if !ok {
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid auth header format"))
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(int64(user.ID), 10*time.Minute, tokens.ScopeResetPassword)
+	if h.jwt != nil {
+		claims, err := h.jwt.Verify(plainText, tokens.ScopeAuth)
+		if err != nil {
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid token"))
+			return
+		}
+		err = h.jwt.Revoke(r.Context(), claims)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while revoking token", "error", err)
+			apierr.Write(w, r, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "Token revoked"})
+		return
+	}
+
+	hash := sha256.Sum256([]byte(plainText))
+	err := h.tokenStore.DeleteToken(r.Context(), hash[:])
 	if err != nil {
-		h.logger.Println("error while creating reset token:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error while deleting token", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reset_token": token})
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "Token revoked"})
+}
+
+func (h *TokenHandler) GenerateResetPasswordToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	err := utils.ReadJSON(w, r, &req, h.maxBodyBytes)
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "error while decoding password reset request", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Required("email", req.Email)
+	err = v.Err()
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "email is required for password reset")
+		apierr.Write(w, r, err)
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error reading user email", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+
+	// the token only goes to the mailbox of the account and the answer is the
+	// same for unknown emails, so the endpoint can't tell who is registered
+	if user != nil {
+		token, err := h.tokenStore.CreateNewToken(r.Context(), int64(user.ID), h.ttls.ResetPassword, tokens.ScopeResetPassword)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while creating reset token", "error", err)
+			apierr.Write(w, r, err)
+			return
+		}
+		h.metrics.TokenIssued(tokens.ScopeResetPassword)
+		err = h.notifier.Notify(user.Email, "Password reset",
+			"Use this token to reset your password before "+token.Expiry.UTC().Format(time.RFC1123)+": "+token.PlainText)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "error while sending reset token", "error", err)
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "If the email is registered, a reset token has been sent to it"})
 }
 
 func (h *TokenHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
 	plainText, err := utils.ReadTokenParam(r)
 	if plainText == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Reset token is required"})
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidToken, "Reset token is required"))
 		return
 	}
 	if err != nil {
-		h.logger.Println("Error reading reset token:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid reset token"})
+		h.logger.WarnContext(r.Context(), "error reading reset token", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidToken, "Invalid reset token"))
 		return
 	}
 	hash := sha256.Sum256([]byte(plainText))
@@ -132,65 +446,85 @@ func (h *TokenHandler) HandleResetPassword(w http.ResponseWriter, r *http.Reques
 		NewPassword     string `json:"new_password"`
 		ConfirmPassword string `json:"confirm_password"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = utils.ReadJSON(w, r, &req, h.maxBodyBytes)
 	if err != nil {
-		h.logger.Println("error while decoding reset password request:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
-		return
-	}
-	if req.NewPassword == "" || req.ConfirmPassword == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "New password and confirmation are required"})
+		h.logger.WarnContext(r.Context(), "error while decoding reset password request", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-	if req.NewPassword != req.ConfirmPassword {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Passwords do not match"})
+	v := validator.New()
+	v.Required("new_password", req.NewPassword)
+	v.Required("confirm_password", req.ConfirmPassword)
+	v.Equal("confirm_password", req.ConfirmPassword, req.NewPassword, "Passwords do not match")
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
 		return
 	}
 
 	// bu xato (tokenData nil bolgan case alohida handle qilindi)
-	tokenData, err := h.tokenStore.GetToken(token)
+	tokenData, err := h.tokenStore.GetToken(r.Context(), token)
 	if err != nil {
-		h.logger.Println("Error retrieving reset token:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error retrieving reset token", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	if tokenData == nil || tokenData.Expiry.Before(time.Now()) {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid or expired reset token"})
+	// auth and mfa challenge tokens live in the same table, only reset tokens may reset a password
+	if tokenData == nil || tokenData.Scope != tokens.ScopeResetPassword || tokenData.Expiry.Before(time.Now()) {
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidToken, "Invalid or expired reset token"))
 		return
 	}
 
 	// KERAK EMAS || NOTO'G'RI (user nil bo'lishi handle qilindi va userStore.GetUserByID ishlatildi)
-	user, err := h.userStore.GetUserByID(tokenData.UserID)
+	user, err := h.userStore.GetUserByID(r.Context(), tokenData.UserID)
 	if err != nil {
-		h.logger.Println("Error getting user by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
 	if user == nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "No user found for the provided token"})
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidToken, "No user found for the provided token"))
+		return
+	}
+
+	err = checkPassword(v, "new_password", h.policy.Check(r.Context(), req.NewPassword, user.Email, int64(user.ID), h.userStore))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error checking password policy", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = user.PasswordHash.Set(req.NewPassword)
+	err = user.PasswordHash.Set(h.hasher, req.NewPassword)
 	if err != nil {
-		h.logger.Println("Error hashing new password:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error hashing new password", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = h.userStore.UpdateUser(user)
+	err = h.userStore.UpdateUser(r.Context(), user)
 	if err != nil {
-		h.logger.Println("Error updating password:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		h.logger.ErrorContext(r.Context(), "error updating password", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	// DeleteAllTokensForUser ishlatildi DeleteToken ni o'rniga
-	err = h.tokenStore.DeleteAllTokensForUser(int64(user.ID), tokens.ScopeResetPassword)
+	// the reset token goes along with every session of the account
+	err = h.revoker.RevokeUser(r.Context(), int64(user.ID))
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "error revoking tokens", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = h.guard.Succeed(r.Context(), user.Email)
 	if err != nil {
-		h.logger.Println("Error deleting used token:", err)
+		h.logger.ErrorContext(r.Context(), "error while resetting login failures", "error", err)
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "Password reset successfully"})
 }
@@ -0,0 +1,287 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/totp"
+)
+
+func TestCreateToken(t *testing.T) {
+	srv := apitest.NewServer(t)
+	srv.Register("john@example.com")
+
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+	}{
+		{name: "malformed json", body: `{"email":`, wantStatus: http.StatusBadRequest},
+		{name: "wrong password", body: map[string]any{"email": "john@example.com", "password": "Wrong123"}, wantStatus: http.StatusUnauthorized},
+		{name: "unknown email", body: map[string]any{"email": "nobody@example.com", "password": apitest.Password}, wantStatus: http.StatusUnauthorized},
+		{name: "valid", body: map[string]any{"email": "john@example.com", "password": apitest.Password}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/tokens/", "", tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	t.Run("unknown emails look like wrong passwords", func(t *testing.T) {
+		unknown := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "nobody@example.com", "password": apitest.Password})
+		wrong := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": "Wrong123"})
+		assert.Equal(t, wrong.Raw, unknown.Raw)
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	srv := apitest.NewServer(t)
+	srv.Register("john@example.com")
+	wrong := map[string]any{"email": "john@example.com", "password": "Wrong123"}
+
+	for i := 0; i < 4; i++ {
+		res := srv.Do(http.MethodPost, "/tokens/", "", wrong)
+		require.Equal(t, http.StatusUnauthorized, res.Status)
+	}
+	// the fifth failure locks the account
+	res := srv.Do(http.MethodPost, "/tokens/", "", wrong)
+	require.Equal(t, http.StatusUnauthorized, res.Status)
+
+	res = srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": apitest.Password})
+	assert.Equal(t, http.StatusTooManyRequests, res.Status)
+	assert.Equal(t, "60", res.Header.Get("Retry-After"))
+}
+
+func TestDisabledUser(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+	require.NoError(t, srv.Stores.Users.SetUserDisabled(context.Background(), int64(userID), true))
+
+	res := srv.Do(http.MethodGet, "/users/"+strconv.Itoa(userID), token, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Status, "existing tokens stop working")
+	res = srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": "Wrong123"})
+	assert.Equal(t, http.StatusUnauthorized, res.Status, "a wrong password doesn't reveal the account state")
+	res = srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": apitest.Password})
+	assert.Equal(t, http.StatusForbidden, res.Status)
+	assert.Equal(t, "Account is disabled", res.String("detail"))
+	assert.Equal(t, "account_disabled", res.String("code"))
+
+	require.NoError(t, srv.Stores.Users.SetUserDisabled(context.Background(), int64(userID), false))
+	srv.Login("john@example.com", apitest.Password)
+}
+
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+	}{
+		{name: "opaque", configure: func(cfg *config.Config) {}},
+		{name: "jwt", configure: func(cfg *config.Config) {
+			cfg.Tokens.Mode = tokens.ModeJWT
+			cfg.Tokens.KeysDir = t.TempDir()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer(t, tt.configure)
+			userID, token := srv.NewUser("john@example.com")
+			path := "/users/" + strconv.Itoa(userID)
+
+			res := srv.Do(http.MethodDelete, "/tokens/", "", nil)
+			assert.Equal(t, http.StatusUnauthorized, res.Status)
+
+			res = srv.Do(http.MethodGet, path, token, nil)
+			require.Equal(t, http.StatusOK, res.Status)
+			res = srv.Do(http.MethodDelete, "/tokens/", token, nil)
+			require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+			res = srv.Do(http.MethodGet, path, token, nil)
+			assert.Equal(t, http.StatusUnauthorized, res.Status)
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, session := srv.NewUser("john@example.com")
+	for i := 0; i < 5; i++ {
+		res := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": "Wrong123"})
+		require.Equal(t, http.StatusUnauthorized, res.Status)
+	}
+	reset := func(next, confirm string) map[string]any {
+		return map[string]any{"new_password": next, "confirm_password": confirm}
+	}
+
+	res := srv.Do(http.MethodPost, "/users/reset-password-request/", "", map[string]any{})
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Status)
+	assert.Equal(t, "email", res.String("errors", "0", "field"))
+	unknown := srv.Do(http.MethodPost, "/users/reset-password-request/", "", map[string]any{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, unknown.Status)
+	assert.Empty(t, srv.Mail.Messages("nobody@example.com"))
+	res = srv.Do(http.MethodPost, "/users/reset-password-request/", "", map[string]any{"email": "john@example.com"})
+	require.Equal(t, http.StatusOK, res.Status)
+	assert.Equal(t, unknown.Raw, res.Raw, "the answer doesn't tell whether the email is registered")
+
+	// the token is only sent to the owner of the account
+	messages := srv.Mail.Messages("john@example.com")
+	require.NotEmpty(t, messages)
+	message := messages[len(messages)-1]
+	require.Equal(t, "Password reset", message.Subject)
+	resetToken := message.Body[strings.LastIndex(message.Body, " ")+1:]
+	require.NotEmpty(t, resetToken)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "unknown token", token: "unknown", body: reset("Changed456", "Changed456"), wantStatus: http.StatusBadRequest},
+		{name: "malformed json", token: resetToken, body: `{"new_password":`, wantStatus: http.StatusBadRequest},
+		{name: "missing fields", token: resetToken, body: reset("", ""), wantStatus: http.StatusUnprocessableEntity},
+		{name: "confirmation mismatch", token: resetToken, body: reset("Changed456", "Changed789"), wantStatus: http.StatusUnprocessableEntity},
+		{name: "weak password", token: resetToken, body: reset("weak", "weak"), wantStatus: http.StatusUnprocessableEntity},
+		{name: "valid", token: resetToken, body: reset("Changed456", "Changed456"), wantStatus: http.StatusOK},
+		{name: "token is used up", token: resetToken, body: reset("Changed789", "Changed789"), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/users/reset-password/"+tt.token+"/", "", tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	res = srv.Do(http.MethodGet, "/users/"+strconv.Itoa(userID), session, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Status, "sessions end with the reset")
+	// the reset also lifts the lockout of the account
+	srv.Login("john@example.com", "Changed456")
+}
+
+func TestResetPasswordRequiresResetScope(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, authToken := srv.NewUser("john@example.com")
+	challenge, err := srv.Stores.Tokens.CreateNewToken(context.Background(), int64(userID), time.Minute, tokens.ScopeMFAChallenge)
+	require.NoError(t, err)
+	body := map[string]any{"new_password": "Changed456", "confirm_password": "Changed456"}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "auth token", token: authToken},
+		{name: "mfa challenge token", token: challenge.PlainText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/users/reset-password/"+tt.token+"/", "", body)
+			assert.Equal(t, http.StatusBadRequest, res.Status, "%s", res.Raw)
+			assert.Equal(t, "invalid_token", res.String("code"))
+		})
+	}
+
+	srv.Login("john@example.com", apitest.Password)
+}
+
+// enableTOTP enrolls the user in two-factor login and returns the secret
+// and the recovery codes
+func enableTOTP(t *testing.T, srv *apitest.Server, token string) (string, []any) {
+	t.Helper()
+	res := srv.Do(http.MethodPost, "/users/totp/", token, nil)
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	secret := res.String("secret")
+	code, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	res = srv.Do(http.MethodPost, "/users/totp/confirm/", token, map[string]any{"code": code})
+	require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+	codes, _ := res.Value("recovery_codes").([]any)
+	return secret, codes
+}
+
+func TestVerifyMFA(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, token := srv.NewUser("john@example.com")
+	secret, recoveryCodes := enableTOTP(t, srv, token)
+	require.NotEmpty(t, recoveryCodes)
+
+	login := func(t *testing.T) string {
+		t.Helper()
+		res := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": apitest.Password})
+		require.Equal(t, http.StatusOK, res.Status)
+		require.Equal(t, true, res.Value("mfa_required"))
+		require.Empty(t, res.String("token", "token"))
+		return res.String("mfa_token", "token")
+	}
+	// the code used to confirm the enrollment can't be replayed, the next
+	// step is still inside the allowed drift
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       func(mfaToken string) any
+		wantStatus int
+	}{
+		{name: "missing code", body: func(mfaToken string) any { return map[string]any{"mfa_token": mfaToken} }, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unknown mfa token", body: func(string) any { return map[string]any{"mfa_token": "unknown", "code": code} }, wantStatus: http.StatusUnauthorized},
+		{name: "wrong code", body: func(mfaToken string) any { return map[string]any{"mfa_token": mfaToken, "code": "000000"} }, wantStatus: http.StatusUnauthorized},
+		{name: "auth token is no mfa token", body: func(string) any { return map[string]any{"mfa_token": token, "code": code} }, wantStatus: http.StatusUnauthorized},
+		{name: "valid code", body: func(mfaToken string) any { return map[string]any{"mfa_token": mfaToken, "code": code} }, wantStatus: http.StatusOK},
+		{name: "replayed code", body: func(mfaToken string) any { return map[string]any{"mfa_token": mfaToken, "code": code} }, wantStatus: http.StatusUnauthorized},
+		{name: "recovery code", body: func(mfaToken string) any {
+			return map[string]any{"mfa_token": mfaToken, "recovery_code": recoveryCodes[0]}
+		}, wantStatus: http.StatusOK},
+		{name: "used recovery code", body: func(mfaToken string) any {
+			return map[string]any{"mfa_token": mfaToken, "recovery_code": recoveryCodes[0]}
+		}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/tokens/mfa/", "", tt.body(login(t)))
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+			if tt.wantStatus == http.StatusOK {
+				assert.NotEmpty(t, res.String("token", "token"))
+			}
+		})
+	}
+}
+
+func TestMFALockout(t *testing.T) {
+	srv := apitest.NewServer(t)
+	_, token := srv.NewUser("john@example.com")
+	secret, _ := enableTOTP(t, srv, token)
+
+	login := func() string {
+		res := srv.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": "john@example.com", "password": apitest.Password})
+		require.Equal(t, http.StatusOK, res.Status)
+		return res.String("mfa_token", "token")
+	}
+	mfaToken := login()
+	wrong := map[string]any{"mfa_token": mfaToken, "code": "000000"}
+	for i := 0; i < 4; i++ {
+		res := srv.Do(http.MethodPost, "/tokens/mfa/", "", wrong)
+		require.Equal(t, http.StatusUnauthorized, res.Status)
+	}
+	// the fifth wrong code locks two-factor login
+	res := srv.Do(http.MethodPost, "/tokens/mfa/", "", wrong)
+	require.Equal(t, http.StatusTooManyRequests, res.Status, "%s", res.Raw)
+	assert.Equal(t, "300", res.Header.Get("Retry-After"))
+	assert.Equal(t, "too_many_attempts", res.String("code"))
+
+	code, err := totp.Code(secret, time.Now().Add(totp.Period))
+	require.NoError(t, err)
+	res = srv.Do(http.MethodPost, "/tokens/mfa/", "", map[string]any{"mfa_token": mfaToken, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, res.Status, "the challenge is gone")
+	res = srv.Do(http.MethodPost, "/tokens/mfa/", "", map[string]any{"mfa_token": login(), "code": code})
+	assert.Equal(t, http.StatusTooManyRequests, res.Status, "a new challenge is locked as well")
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+}
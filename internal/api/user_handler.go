@@ -1,15 +1,18 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"regexp"
 
+	"github.com/makhammatovb/Articles/internal/apierr"
+	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/passwords"
 	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
 	"github.com/makhammatovb/Articles/internal/utils"
+	"github.com/makhammatovb/Articles/internal/validator"
 )
 
 type registerUserRequest struct {
@@ -21,65 +24,91 @@ type registerUserRequest struct {
 
 // UserHandler struct to handle User-related requests for future use
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore      store.UserStore
+	passwordPolicy passwords.Policy
+	hasher         passwords.Hasher
+	revoker        tokens.Revoker
+	maxBodyBytes   int64
+	logger         *slog.Logger
 }
 
 // NewUserHandler creates a new instance of UserHandler.
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, passwordPolicy passwords.Policy, hasher passwords.Hasher, revoker tokens.Revoker, maxBodyBytes int64, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:      userStore,
+		passwordPolicy: passwordPolicy,
+		hasher:         hasher,
+		revoker:        revoker,
+		maxBodyBytes:   maxBodyBytes,
+		logger:         logger,
 	}
 }
 
-func (uh *UserHandler) validateRegisterRequest(req *registerUserRequest) error {
-	if req.Email == "" {
-		return errors.New("missing required fields")
-	}
-
-	if len(req.Email) > 255 {
-		return errors.New("email is too long")
-	}
+func (uh *UserHandler) validateRegisterRequest(ctx context.Context, req *registerUserRequest) error {
+	v := validator.New()
+	store.ValidateUser(v, &store.User{Email: req.Email, FirstName: req.FirstName, LastName: req.LastName})
+	v.Required("password", req.Password)
 
-	emailRegex := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
-	if !emailRegex.MatchString(req.Email) {
-		return errors.New("invalid email format")
+	if req.Email != "" {
+		existingUser, err := uh.userStore.GetUserByEmail(ctx, req.Email)
+		if err != nil {
+			return err
+		}
+		v.Check(existingUser == nil, "email", validator.CodeTaken, "user with this email already exists")
 	}
 
-	if req.Password == "" {
-		return errors.New("missing required fields")
+	if req.Password != "" {
+		err := checkPassword(v, "password", uh.passwordPolicy.Check(ctx, req.Password, req.Email, 0, nil))
+		if err != nil {
+			return err
+		}
 	}
+	return v.Err()
+}
 
-	existingUser, err := uh.userStore.GetUserByEmail(req.Email)
-	if err != nil {
+// checkPassword adds the violations of a password policy check to v as
+// errors of field, other errors are returned as they are
+func checkPassword(v *validator.Validator, field string, err error) error {
+	var violations passwords.Violations
+	if !errors.As(err, &violations) {
 		return err
 	}
-	if existingUser != nil {
-		return errors.New("user with this email already exists")
+	for _, violation := range violations {
+		v.Add(field, validator.CodeWeakPassword, "password "+violation)
 	}
+	return nil
+}
 
-	if len(req.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
+// requireSelf answers 403 unless the request is made by the user with
+// userID, users may only change their own account
+func requireSelf(w http.ResponseWriter, r *http.Request, logger *slog.Logger, userID int64) bool {
+	user, err := middleware.GetUser(r)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "error getting user from context", "error", err)
+		apierr.Write(w, r, err)
+		return false
 	}
-
-	return nil
+	if int64(user.ID) != userID {
+		apierr.Write(w, r, apierr.Forbidden("You can only change your own account"))
+		return false
+	}
+	return true
 }
 
 func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req registerUserRequest
 
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := utils.ReadJSON(w, r, &req, uh.maxBodyBytes)
 	if err != nil {
-		uh.logger.Println("error while decoding user:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		uh.logger.WarnContext(r.Context(), "error while decoding user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = uh.validateRegisterRequest(&req)
+	err = uh.validateRegisterRequest(r.Context(), &req)
 	if err != nil {
-		uh.logger.Println("error while validating user:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		uh.logger.WarnContext(r.Context(), "error while validating user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
@@ -95,17 +124,17 @@ func (uh *UserHandler) HandleRegisterUser(w http.ResponseWriter, r *http.Request
 		user.LastName = req.LastName
 	}
 
-	err = user.PasswordHash.Set(req.Password)
+	err = user.PasswordHash.Set(uh.hasher, req.Password)
 	if err != nil {
-		uh.logger.Println("error while hashing password:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error while hashing password", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = uh.userStore.CreateUser(user)
+	err = uh.userStore.CreateUser(r.Context(), user)
 	if err != nil {
-		uh.logger.Println("error while creating user:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error while creating user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
@@ -115,16 +144,19 @@ func (uh *UserHandler) HandleGetUserByID(w http.ResponseWriter, r *http.Request)
 
 	// retrieves the user ID from the URL parameters
 	userID, err := utils.ReadIDParam(r)
-	fmt.Println("USER ID:", userID)
 	if err != nil {
-		uh.logger.Println("Error reading user ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID"})
+		uh.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
 		return
 	}
-	user, err := uh.userStore.GetUserByID(userID)
+	user, err := uh.userStore.GetUserByID(r.Context(), userID)
 	if err != nil {
-		uh.logger.Println("Error getting user by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	if user == nil {
+		apierr.Write(w, r, apierr.NotFound("User not found"))
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
@@ -134,10 +166,10 @@ func (uh *UserHandler) HandleGetUserByEmail(w http.ResponseWriter, r *http.Reque
 	var req struct {
 		Email string `json:"email"`
 	}
-	user, err := uh.userStore.GetUserByEmail(req.Email)
+	user, err := uh.userStore.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
-		uh.logger.Println("Error getting user by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
@@ -146,18 +178,21 @@ func (uh *UserHandler) HandleGetUserByEmail(w http.ResponseWriter, r *http.Reque
 func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := utils.ReadIDParam(r)
 	if err != nil {
-		uh.logger.Println("Error reading user ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID"})
+		uh.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, uh.logger, userID) {
 		return
 	}
-	existingUser, err := uh.userStore.GetUserByID(userID)
+	existingUser, err := uh.userStore.GetUserByID(r.Context(), userID)
 	if err != nil {
-		uh.logger.Println("Error getting user by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if existingUser == nil {
-		http.NotFound(w, r)
+		apierr.Write(w, r, apierr.NotFound("User not found"))
 		return
 	}
 	var updatedUserRequest struct {
@@ -166,10 +201,10 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 		Email        *string `json:"email"`
 		PasswordHash *string `json:"password"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&updatedUserRequest)
+	err = utils.ReadJSON(w, r, &updatedUserRequest, uh.maxBodyBytes)
 	if err != nil {
-		uh.logger.Println("error while decoding user:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		uh.logger.WarnContext(r.Context(), "error while decoding user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 	if updatedUserRequest.FirstName != nil {
@@ -181,37 +216,30 @@ func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request)
 	if updatedUserRequest.Email != nil {
 		existingUser.Email = *updatedUserRequest.Email
 	}
-	err = uh.userStore.UpdateUser(existingUser)
+	v := validator.New()
+	store.ValidateUser(v, existingUser)
+	err = v.Err()
 	if err != nil {
-		uh.logger.Println("Error updating user:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		apierr.Write(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": existingUser})
-}
-
-func (uh *UserHandler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	userID, err := utils.ReadIDParam(r)
+	err = uh.userStore.UpdateUser(r.Context(), existingUser)
 	if err != nil {
-		uh.logger.Println("Error reading user ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID"})
+		uh.logger.ErrorContext(r.Context(), "error updating user", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
-
-	err = uh.userStore.DeleteUser(userID)
-	if err != nil {
-		uh.logger.Println("Error deleting user:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
-		return
-	}
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": existingUser})
 }
 
 func (uh *UserHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 	userID, err := utils.ReadIDParam(r)
 	if err != nil {
-		uh.logger.Println("Error reading user ID:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid user ID"})
+		uh.logger.WarnContext(r.Context(), "error reading user ID", "error", err)
+		apierr.Write(w, r, apierr.BadRequest(apierr.CodeInvalidID, "Invalid user ID"))
+		return
+	}
+	if !requireSelf(w, r, uh.logger, userID) {
 		return
 	}
 
@@ -221,54 +249,80 @@ func (uh *UserHandler) HandleUpdatePassword(w http.ResponseWriter, r *http.Reque
 		ConfirmPassword string `json:"confirm_password"`
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = utils.ReadJSON(w, r, &req, uh.maxBodyBytes)
 	if err != nil {
-		uh.logger.Println("error while decoding password update request:", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		uh.logger.WarnContext(r.Context(), "error while decoding password update request", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	if req.CurrentPassword == "" || req.NewPassword == "" || req.ConfirmPassword == "" {
-		uh.logger.Println("missing required fields in password update request")
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "missing required fields"})
+	v := validator.New()
+	v.Required("current_password", req.CurrentPassword)
+	v.Required("new_password", req.NewPassword)
+	v.Required("confirm_password", req.ConfirmPassword)
+	v.Equal("confirm_password", req.ConfirmPassword, req.NewPassword, "Passwords do not match")
+	err = v.Err()
+	if err != nil {
+		uh.logger.WarnContext(r.Context(), "invalid password update request", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	oldUserPassword, err := uh.userStore.GetUserWithPasswordByID(userID)
+	oldUserPassword, err := uh.userStore.GetUserWithPasswordByID(r.Context(), userID)
 	if err != nil {
-		uh.logger.Println("Error getting user by ID:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error getting user by ID", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	// a signed token outlives the account it was issued for
+	if oldUserPassword == nil {
+		apierr.Write(w, r, apierr.NotFound("User not found"))
 		return
 	}
 
 	passwordsDoMatch, err := oldUserPassword.PasswordHash.Matches(req.CurrentPassword)
 	if err != nil {
-		uh.logger.Println("error while comparing passwords:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error while comparing passwords", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
 	if !passwordsDoMatch {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Current password is incorrect"})
+		apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidCredentials, "Current password is incorrect"))
 		return
 	}
 
-	if req.NewPassword != req.ConfirmPassword {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Passwords do not match"})
+	err = checkPassword(v, "new_password", uh.passwordPolicy.Check(r.Context(), req.NewPassword, oldUserPassword.Email, userID, uh.userStore))
+	if err != nil {
+		uh.logger.ErrorContext(r.Context(), "error checking password policy", "error", err)
+		apierr.Write(w, r, err)
+		return
+	}
+	err = v.Err()
+	if err != nil {
+		apierr.Write(w, r, err)
+		return
+	}
+
+	err = oldUserPassword.PasswordHash.Set(uh.hasher, req.NewPassword)
+	if err != nil {
+		uh.logger.ErrorContext(r.Context(), "error hashing new password", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = oldUserPassword.PasswordHash.Set(req.NewPassword)
+	err = uh.userStore.UpdateUser(r.Context(), oldUserPassword)
 	if err != nil {
-		uh.logger.Println("Error hashing new password:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error updating password", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
-	err = uh.userStore.UpdateUser(oldUserPassword)
+	// whoever knew the old password may still hold a session
+	err = uh.revoker.RevokeUser(r.Context(), userID)
 	if err != nil {
-		uh.logger.Println("Error updating password:", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		uh.logger.ErrorContext(r.Context(), "error revoking tokens", "error", err)
+		apierr.Write(w, r, err)
 		return
 	}
 
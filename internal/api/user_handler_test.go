@@ -0,0 +1,248 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+func TestRegisterUser(t *testing.T) {
+	srv := apitest.NewServer(t)
+	srv.Register("taken@example.com")
+
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{name: "valid", body: map[string]any{"email": "new@example.com", "password": apitest.Password}, wantStatus: http.StatusCreated},
+		{name: "malformed json", body: `{"email":`, wantStatus: http.StatusBadRequest, wantCode: "invalid_request"},
+		{name: "missing email", body: map[string]any{"password": apitest.Password}, wantStatus: http.StatusUnprocessableEntity, wantCode: "validation_failed", wantField: "email"},
+		{name: "invalid email", body: map[string]any{"email": "not-an-email", "password": apitest.Password}, wantStatus: http.StatusUnprocessableEntity, wantCode: "validation_failed", wantField: "email"},
+		{name: "missing password", body: map[string]any{"email": "nopass@example.com"}, wantStatus: http.StatusUnprocessableEntity, wantCode: "validation_failed", wantField: "password"},
+		{name: "weak password", body: map[string]any{"email": "weak@example.com", "password": "short"}, wantStatus: http.StatusUnprocessableEntity, wantCode: "validation_failed", wantField: "password"},
+		{name: "email taken", body: map[string]any{"email": "taken@example.com", "password": apitest.Password}, wantStatus: http.StatusUnprocessableEntity, wantCode: "validation_failed", wantField: "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, "/users/", "", tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+			if tt.wantCode != "" {
+				assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+				assert.Equal(t, tt.wantCode, res.String("code"))
+			}
+			if tt.wantField != "" {
+				assert.Equal(t, tt.wantField, res.String("errors", "0", "field"))
+			}
+		})
+	}
+
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		res := srv.Do(http.MethodPost, "/users/", "", map[string]any{"email": "not-an-email", "password": "short"})
+		require.Equal(t, http.StatusUnprocessableEntity, res.Status, "%s", res.Raw)
+		assert.Equal(t, "email", res.String("errors", "0", "field"))
+		assert.Equal(t, "invalid_format", res.String("errors", "0", "code"))
+		assert.Equal(t, "password", res.String("errors", "1", "field"))
+		assert.Equal(t, "weak_password", res.String("errors", "1", "code"))
+	})
+
+	t.Run("password hash is not returned", func(t *testing.T) {
+		res := srv.Do(http.MethodPost, "/users/", "", map[string]any{"email": "hash@example.com", "password": apitest.Password})
+		require.Equal(t, http.StatusCreated, res.Status)
+		assert.NotContains(t, string(res.Raw), "password")
+	})
+
+	t.Run("cannot register as admin", func(t *testing.T) {
+		res := srv.Do(http.MethodPost, "/users/", "", map[string]any{"email": "sneaky@example.com", "password": apitest.Password, "is_admin": true})
+		require.Equal(t, http.StatusBadRequest, res.Status)
+		assert.Equal(t, `body contains unknown field "is_admin"`, res.String("detail"))
+		user, err := srv.Stores.Users.GetUserByEmail(context.Background(), "sneaky@example.com")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("body limit comes from the configuration", func(t *testing.T) {
+		small := apitest.NewServer(t, func(cfg *config.Config) { cfg.Server.MaxBodyBytes = 32 })
+		res := small.Do(http.MethodPost, "/users/", "", map[string]any{"email": "long@example.com", "password": apitest.Password})
+		require.Equal(t, http.StatusRequestEntityTooLarge, res.Status, "%s", res.Raw)
+		assert.Equal(t, "body must not be larger than 32 bytes", res.String("detail"))
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous", path: "/users/" + strconv.Itoa(userID), wantStatus: http.StatusUnauthorized},
+		{name: "existing", path: "/users/" + strconv.Itoa(userID), token: token, wantStatus: http.StatusOK},
+		{name: "missing", path: "/users/9999", token: token, wantStatus: http.StatusNotFound},
+		{name: "invalid id", path: "/users/abc", token: token, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodGet, tt.path, tt.token, nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	path := "/users/" + strconv.Itoa(userID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, body: map[string]any{"firstname": "Johnny"}, wantStatus: http.StatusUnauthorized},
+		{name: "another user", path: path, token: other, body: map[string]any{"firstname": "Johnny"}, wantStatus: http.StatusForbidden},
+		{name: "invalid id", path: "/users/abc/", token: token, body: map[string]any{"firstname": "Johnny"}, wantStatus: http.StatusBadRequest},
+		{name: "malformed json", path: path, token: token, body: `{"firstname":`, wantStatus: http.StatusBadRequest},
+		{name: "email taken", path: path, token: token, body: map[string]any{"email": "other@example.com"}, wantStatus: http.StatusConflict},
+		{name: "self", path: path, token: token, body: map[string]any{"firstname": "Johnny"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPut, tt.path, tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	res := srv.Do(http.MethodGet, "/users/"+strconv.Itoa(userID), token, nil)
+	assert.Equal(t, "Johnny", res.String("user", "firstname"))
+	// the password is untouched, logging in still works
+	srv.Login("john@example.com", apitest.Password)
+}
+
+func TestDeleteUser(t *testing.T) {
+	// without a grace period the account is erased at once
+	srv := apitest.NewServer(t, func(cfg *config.Config) { cfg.Privacy.ErasureGracePeriod = 0 })
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	path := "/users/" + strconv.Itoa(userID) + "/"
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous", path: path, wantStatus: http.StatusUnauthorized},
+		{name: "another user", path: path, token: other, wantStatus: http.StatusForbidden},
+		{name: "invalid id", path: "/users/abc/", token: token, wantStatus: http.StatusBadRequest},
+		{name: "self", path: path, token: token, wantStatus: http.StatusNoContent},
+		// the token went away with the user
+		{name: "after deletion", path: path, token: token, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodDelete, tt.path, tt.token, nil)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	srv := apitest.NewServer(t)
+	userID, token := srv.NewUser("john@example.com")
+	_, other := srv.NewUser("other@example.com")
+	path := "/users/" + strconv.Itoa(userID) + "/password-change/"
+	change := func(current, next, confirm string) map[string]any {
+		return map[string]any{"current_password": current, "new_password": next, "confirm_password": confirm}
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		body       any
+		wantStatus int
+	}{
+		{name: "anonymous", body: change(apitest.Password, "Changed456", "Changed456"), wantStatus: http.StatusUnauthorized},
+		{name: "another user", token: other, body: change(apitest.Password, "Changed456", "Changed456"), wantStatus: http.StatusForbidden},
+		{name: "malformed json", token: token, body: `{"current_password":`, wantStatus: http.StatusBadRequest},
+		{name: "missing fields", token: token, body: change(apitest.Password, "", ""), wantStatus: http.StatusUnprocessableEntity},
+		{name: "wrong current password", token: token, body: change("Wrong123", "Changed456", "Changed456"), wantStatus: http.StatusUnauthorized},
+		{name: "confirmation mismatch", token: token, body: change(apitest.Password, "Changed456", "Changed789"), wantStatus: http.StatusUnprocessableEntity},
+		{name: "weak password", token: token, body: change(apitest.Password, "weak", "weak"), wantStatus: http.StatusUnprocessableEntity},
+		{name: "reused password", token: token, body: change(apitest.Password, apitest.Password, apitest.Password), wantStatus: http.StatusUnprocessableEntity},
+		{name: "valid", token: token, body: change(apitest.Password, "Changed456", "Changed456"), wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodPost, path, tt.token, tt.body)
+			assert.Equal(t, tt.wantStatus, res.Status, "%s", res.Raw)
+		})
+	}
+
+	srv.Login("john@example.com", "Changed456")
+}
+
+func TestChangePasswordDeletedUser(t *testing.T) {
+	srv := apitest.NewServer(t, func(cfg *config.Config) {
+		cfg.Tokens.Mode = tokens.ModeJWT
+		cfg.Tokens.KeysDir = t.TempDir()
+	})
+	userID, token := srv.NewUser("john@example.com")
+	require.NoError(t, srv.Stores.Users.DeleteUser(context.Background(), int64(userID)))
+
+	res := srv.Do(http.MethodPost, "/users/"+strconv.Itoa(userID)+"/password-change/", token, map[string]any{
+		"current_password": apitest.Password,
+		"new_password":     "Changed456",
+		"confirm_password": "Changed456",
+	})
+	assert.Equal(t, http.StatusNotFound, res.Status, "%s", res.Raw)
+}
+
+func TestChangePasswordEndsSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+	}{
+		{name: "opaque", configure: func(cfg *config.Config) {}},
+		{name: "jwt", configure: func(cfg *config.Config) {
+			cfg.Tokens.Mode = tokens.ModeJWT
+			cfg.Tokens.KeysDir = t.TempDir()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := apitest.NewServer(t, tt.configure)
+			userID, token := srv.NewUser("john@example.com")
+			otherSession := srv.Login("john@example.com", apitest.Password)
+			path := "/users/" + strconv.Itoa(userID)
+
+			res := srv.Do(http.MethodPost, path+"/password-change/", token, map[string]any{
+				"current_password": apitest.Password,
+				"new_password":     "Changed456",
+				"confirm_password": "Changed456",
+			})
+			require.Equal(t, http.StatusOK, res.Status, "%s", res.Raw)
+
+			res = srv.Do(http.MethodGet, path, token, nil)
+			assert.Equal(t, http.StatusUnauthorized, res.Status)
+			res = srv.Do(http.MethodGet, path, otherSession, nil)
+			assert.Equal(t, http.StatusUnauthorized, res.Status)
+		})
+	}
+}
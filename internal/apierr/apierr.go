@@ -0,0 +1,162 @@
+// Package apierr is the error model of the HTTP API. Every error response is
+// an RFC 7807 problem document served as application/problem+json, with a
+// stable code clients can branch on next to the detail meant for people.
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// Code identifies the kind of an error. Codes are part of the API, once
+// released they keep their meaning and are never renamed.
+type Code string
+
+const (
+	CodeInvalidRequest     Code = "invalid_request"
+	CodeUnsupportedMedia   Code = "unsupported_media_type"
+	CodeBodyTooLarge       Code = "body_too_large"
+	CodeInvalidID          Code = "invalid_id"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthenticated    Code = "unauthenticated"
+	CodeInvalidToken       Code = "invalid_token"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeInvalidMFACode     Code = "invalid_mfa_code"
+	CodeAccountDisabled    Code = "account_disabled"
+	CodeForbidden          Code = "forbidden"
+	CodeNotFound           Code = "not_found"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeConflict           Code = "conflict"
+	CodeMFANotStarted      Code = "mfa_enrollment_not_started"
+	CodeTooManyAttempts    Code = "too_many_attempts"
+	CodeInternal           Code = "internal_error"
+)
+
+// Error is an error the API reports to the client as it is
+type Error struct {
+	Status int
+	Code   Code
+	Detail string
+	Fields validator.Errors
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Detail
+}
+
+func New(status int, code Code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(code Code, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+func Unauthorized(code Code, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+// Internal hides what went wrong, the cause belongs in the server log
+func Internal() *Error {
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+}
+
+// Validation reports the invalid fields of a request, the detail joins
+// their messages
+func Validation(errs validator.Errors) *Error {
+	return &Error{
+		Status: http.StatusUnprocessableEntity,
+		Code:   CodeValidationFailed,
+		Detail: errs.Error(),
+		Fields: errs,
+	}
+}
+
+// From maps err to the error the client sees. An *Error anywhere in the
+// chain is used as it is, failed validations are 422 and the sentinel
+// errors of the stores get their status, with the store message as
+// detail. Anything else is internal.
+func From(err error) *Error {
+	var apiErr *Error
+	var fieldErrs validator.Errors
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &fieldErrs):
+		return Validation(fieldErrs)
+	case errors.Is(err, store.ErrNotFound):
+		return NotFound(err.Error())
+	case errors.Is(err, store.ErrConflict):
+		return Conflict(err.Error())
+	case errors.Is(err, store.ErrForbidden):
+		return Forbidden(err.Error())
+	default:
+		return Internal()
+	}
+}
+
+// Problem is the body of an error response
+type Problem struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Code     Code             `json:"code"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Errors   validator.Errors `json:"errors,omitempty"`
+}
+
+// Write answers the request with err as a problem document. The type is
+// about:blank, so the title is the status text and Code tells the errors
+// apart.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err)
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(apiErr.Status),
+		Status:   apiErr.Status,
+		Code:     apiErr.Code,
+		Detail:   apiErr.Detail,
+		Instance: r.URL.Path,
+		Errors:   apiErr.Fields,
+	}
+	js, err := json.MarshalIndent(problem, "", "  ")
+	if err != nil {
+		// a Problem always marshals, this only keeps the response valid
+		js = []byte(`{"type":"about:blank","status":500,"code":"internal_error"}`)
+		problem.Status = http.StatusInternalServerError
+	}
+	js = append(js, '\n')
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(js)
+}
+
+// NotFoundHandler answers requests no route matches
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, NotFound("No resource at "+r.URL.Path))
+}
+
+// MethodNotAllowedHandler answers requests with a method the route lacks
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method "+r.Method+" is not allowed here"))
+}
@@ -0,0 +1,76 @@
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   Code
+		wantDetail string
+	}{
+		{name: "api error", err: BadRequest(CodeInvalidID, "Invalid user ID"), wantStatus: http.StatusBadRequest, wantCode: CodeInvalidID, wantDetail: "Invalid user ID"},
+		{name: "wrapped api error", err: fmt.Errorf("handler: %w", Forbidden("No")), wantStatus: http.StatusForbidden, wantCode: CodeForbidden, wantDetail: "No"},
+		{name: "not found", err: fmt.Errorf("user with ID %d %w", 7, store.ErrNotFound), wantStatus: http.StatusNotFound, wantCode: CodeNotFound, wantDetail: "user with ID 7 not found"},
+		{name: "conflict", err: fmt.Errorf("user with email %q %w", "a@example.com", store.ErrConflict), wantStatus: http.StatusConflict, wantCode: CodeConflict, wantDetail: `user with email "a@example.com" already exists`},
+		{name: "forbidden", err: store.ErrForbidden, wantStatus: http.StatusForbidden, wantCode: CodeForbidden, wantDetail: "not allowed"},
+		{name: "anything else", err: errors.New("connect: password=secret"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantDetail: "Internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.wantCode, got.Code)
+			assert.Equal(t, tt.wantDetail, got.Detail)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/users/", nil)
+	v := validator.New()
+	v.Required("email", "")
+	v.Add("password", validator.CodeWeakPassword, "password must contain a digit")
+	Write(rec, r, fmt.Errorf("registering: %w", v.Err()))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Unprocessable Entity",
+		Status:   http.StatusUnprocessableEntity,
+		Code:     CodeValidationFailed,
+		Detail:   "email is required; password must contain a digit",
+		Instance: "/users/",
+		Errors: validator.Errors{
+			{Field: "email", Code: validator.CodeRequired, Message: "email is required"},
+			{Field: "password", Code: validator.CodeWeakPassword, Message: "password must contain a digit"},
+		},
+	}, problem)
+}
+
+func TestWriteHidesInternalErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(rec, httptest.NewRequest(http.MethodGet, "/articles/1", nil), errors.New("dial tcp 10.0.0.5:5432: refused"))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "10.0.0.5")
+	assert.NotContains(t, rec.Body.String(), `"errors"`)
+}
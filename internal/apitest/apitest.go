@@ -0,0 +1,225 @@
+// Package apitest runs the whole HTTP API, router and middleware included,
+// on in-memory stores so handlers can be tested end to end without a database
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/logging"
+	"github.com/makhammatovb/Articles/internal/metrics"
+	"github.com/makhammatovb/Articles/internal/notify"
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/routes"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/store/memstore"
+)
+
+// Password satisfies the default password policy, helpers use it for every
+// user they create
+const Password = "Secret123"
+
+// Server is an application built from memstore stores
+type Server struct {
+	t       *testing.T
+	App     *app.Application
+	Stores  app.Stores
+	Handler http.Handler
+	// Mail holds the notifications the application sent
+	Mail   *Mailbox
+	hasher passwords.Hasher
+}
+
+// Message is a notification sent to a user
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailbox is a notify.Notifier that keeps every message
+type Mailbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+var _ notify.Notifier = (*Mailbox)(nil)
+
+func (m *Mailbox) Notify(email, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, Message{To: email, Subject: subject, Body: body})
+	return nil
+}
+
+// Messages returns the messages sent to email, oldest first
+func (m *Mailbox) Messages(email string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []Message
+	for _, message := range m.messages {
+		if message.To == email {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// Response is a recorded response, Body holds the decoded JSON object
+type Response struct {
+	Status int
+	Header http.Header
+	Raw    []byte
+	Body   map[string]any
+}
+
+// NewServer builds a server with an empty database, configure may change
+// the default configuration before the application is built
+func NewServer(t *testing.T, configure ...func(cfg *config.Config)) *Server {
+	t.Helper()
+	cfg := config.Default()
+	// the cheapest hash keeps the tests fast, the algorithm doesn't matter here
+	cfg.Security.PasswordHash = passwords.AlgorithmBcrypt
+	cfg.Security.BcryptCost = 4
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	hasher := cfg.Security.PasswordHasher()
+	db := memstore.New()
+	stores := app.Stores{
+		Articles:      memstore.NewArticleStore(db),
+		Users:         memstore.NewUserStore(db, hasher),
+		Reviews:       memstore.NewReviewStore(db),
+		Tokens:        memstore.NewTokenStore(db),
+		MFA:           memstore.NewMFAStore(db),
+		LoginFailures: memstore.NewLoginFailureStore(db),
+		Privacy:       memstore.NewPrivacyStore(db, hasher),
+	}
+	mail := &Mailbox{}
+	application, err := app.New(cfg, logging.New(io.Discard, slog.LevelError), stores, mail, metrics.New(nil, nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { application.Close() })
+	return &Server{
+		t:       t,
+		App:     application,
+		Stores:  stores,
+		Handler: routes.SetupRoutes(application),
+		Mail:    mail,
+		hasher:  hasher,
+	}
+}
+
+// Do sends a request, body is encoded as JSON unless it is a string, which
+// is sent as is. An empty token sends no Authorization header.
+func (s *Server) Do(method, path, token string, body any) *Response {
+	s.t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		js, err := json.Marshal(body)
+		require.NoError(s.t, err)
+		reader = bytes.NewReader(js)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+
+	res := &Response{Status: rec.Code, Header: rec.Header(), Raw: rec.Body.Bytes()}
+	contentType := rec.Header().Get("Content-Type")
+	if len(res.Raw) > 0 && (contentType == "application/json" || contentType == "application/problem+json") {
+		require.NoError(s.t, json.Unmarshal(res.Raw, &res.Body), "decoding %s", res.Raw)
+	}
+	return res
+}
+
+// Register creates a user through the API and returns its ID
+func (s *Server) Register(email string) int {
+	s.t.Helper()
+	res := s.Do(http.MethodPost, "/users/", "", map[string]any{
+		"firstname": "John",
+		"lastname":  "Doe",
+		"email":     email,
+		"password":  Password,
+	})
+	require.Equal(s.t, http.StatusCreated, res.Status, "registering %s: %s", email, res.Raw)
+	return res.Int("user", "id")
+}
+
+// Login returns a fresh auth token for the user
+func (s *Server) Login(email, password string) string {
+	s.t.Helper()
+	res := s.Do(http.MethodPost, "/tokens/", "", map[string]any{"email": email, "password": password})
+	require.Equal(s.t, http.StatusOK, res.Status, "logging in %s: %s", email, res.Raw)
+	return res.String("token", "token")
+}
+
+// NewUser registers and logs in a user, returning its ID and token
+func (s *Server) NewUser(email string) (int, string) {
+	s.t.Helper()
+	id := s.Register(email)
+	return id, s.Login(email, Password)
+}
+
+// NewAdmin creates an administrator straight in the store, there is no API
+// for it, and logs it in
+func (s *Server) NewAdmin(email string) (int, string) {
+	s.t.Helper()
+	admin := &store.User{Email: email, FirstName: "Ada", LastName: "Admin", IsAdmin: true}
+	require.NoError(s.t, admin.PasswordHash.Set(s.hasher, Password))
+	require.NoError(s.t, s.Stores.Users.CreateUser(context.Background(), admin))
+	return admin.ID, s.Login(email, Password)
+}
+
+// Value walks the decoded body along the keys, nil if a key is missing.
+// Keys into arrays are indexes.
+func (res *Response) Value(keys ...string) any {
+	var value any = res.Body
+	for _, key := range keys {
+		switch container := value.(type) {
+		case map[string]any:
+			value = container[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil
+			}
+			value = container[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// String returns the string at the keys, empty if there is none
+func (res *Response) String(keys ...string) string {
+	value, _ := res.Value(keys...).(string)
+	return value
+}
+
+// Int returns the number at the keys, zero if there is none
+func (res *Response) Int(keys ...string) int {
+	value, _ := res.Value(keys...).(float64)
+	return int(value)
+}
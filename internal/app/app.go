@@ -1,54 +1,200 @@
 package app
 
 import (
-	"database/sql"
-	"fmt"
-	"log"
-	"net/http"
+	"context"
+	"log/slog"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/makhammatovb/Articles/internal/api"
-	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/lockout"
+	"github.com/makhammatovb/Articles/internal/logging"
+	"github.com/makhammatovb/Articles/internal/metrics"
 	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/notify"
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/tracing"
 	"github.com/makhammatovb/Articles/migrations"
 )
 
 // Application struct includes logger and handler from api package
 // central container for keeping application-wide dependencies
 type Application struct {
-	Logger         *log.Logger
+	Logger         *slog.Logger
 	ArticleHandler *api.ArticleHandler
 	UserHandler    *api.UserHandler
 	ReviewHandler  *api.ReviewHandler
 	TokenHandler   *api.TokenHandler
+	MFAHandler     *api.MFAHandler
+	AdminHandler   *api.AdminHandler
+	PrivacyHandler *api.PrivacyHandler
 	Middleware     middleware.UserMiddleware
-	DB *sql.DB
+	Config         *config.Config
+	Metrics        *metrics.Metrics
+	TokenStore     store.TokenStore
+	PrivacyStore   store.PrivacyStore
+	DB             *store.Database
+
+	// schemaVersion is the migration version this release expects, it is
+	// read from the migration files once at startup
+	schemaVersion int64
+
+	// denylist is nil in opaque token mode
+	denylist   *tokens.SharedDenylist
+	loginGuard *lockout.Guard
+
+	shutdownTracing func(context.Context) error
+
+	workersCtx   context.Context
+	stopWorkers  context.CancelFunc
+	workers      sync.WaitGroup
+	shuttingDown atomic.Bool
 }
 
 // NewApplication creates a new instance of Application
 // and returns a pointer to it with error
-func NewApplication() (*Application, error) {
-	pgDB, err := store.Open()
+func NewApplication(cfg *config.Config) (*Application, error) {
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger := logging.New(os.Stdout, level)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+	db, stores, err := OpenStores(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Database.AutoMigrate {
+		err = db.Migrate(context.Background(), migrations.FS)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	// the server still starts, readiness reports the schema as outdated
+	current, expected, err := db.MigrationVersions(context.Background(), migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if current != expected {
+		logger.Warn("database schema is not up to date, run the migrate command", "current", current, "expected", expected)
+	}
+	logger.Info("connected to the database", "driver", db.Driver)
+	app, err := New(cfg, logger, stores, &notify.LogNotifier{Logger: logger}, metrics.New(db.Pool, db.SQL))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	app.DB = db
+	app.schemaVersion = expected
+	app.shutdownTracing = shutdownTracing
+	return app, nil
+}
+
+// Stores are the storage backends the application is built on
+type Stores struct {
+	Articles      store.ArticleStore
+	Users         store.UserStore
+	Reviews       store.ReviewStore
+	Tokens        store.TokenStore
+	MFA           store.MFAStore
+	LoginFailures store.LoginFailureStore
+	Privacy       store.PrivacyStore
+}
+
+// OpenStores opens the configured database and builds its stores. Commands
+// that work on the data without serving use it directly.
+func OpenStores(ctx context.Context, cfg *config.Config) (*store.Database, Stores, error) {
+	db, err := store.OpenDatabase(ctx, cfg.Database.Driver, cfg.Database.DSN, cfg.Database.PoolOptions())
+	if err != nil {
+		return nil, Stores{}, err
+	}
+	db.QueryTimeout = cfg.Database.QueryTimeout
+	return db, newStores(db, cfg.Security.PasswordHasher()), nil
+}
+
+// newStores builds the stores of the driver db was opened with, bounded by
+// its query timeout, hasher hashes the passwords the stores set
+func newStores(db *store.Database, hasher passwords.Hasher) Stores {
+	timeout := db.QueryTimeout
+	if db.Driver == store.DriverSQLite {
+		return Stores{
+			Articles:      store.NewSQLiteArticleStore(db.SQL, timeout),
+			Users:         store.NewSQLiteUserStore(db.SQL, hasher, timeout),
+			Reviews:       store.NewSQLiteReviewStore(db.SQL, timeout),
+			Tokens:        store.NewSQLiteTokenStore(db.SQL, timeout),
+			MFA:           store.NewSQLiteMFAStore(db.SQL, timeout),
+			LoginFailures: store.NewSQLiteLoginFailureStore(db.SQL, timeout),
+			Privacy:       store.NewSQLitePrivacyStore(db.SQL, hasher, timeout),
+		}
+	}
+	return Stores{
+		Articles:      store.NewPostgresArticleStore(db.Pool, timeout),
+		Users:         store.NewPostgresUserStore(db.Pool, hasher, timeout),
+		Reviews:       store.NewPostgresReviewStore(db.Pool, timeout),
+		Tokens:        store.NewPostgresTokenStore(db.Pool, timeout),
+		MFA:           store.NewPostgresMFAStore(db.Pool, timeout),
+		LoginFailures: store.NewPostgresLoginFailureStore(db.Pool, timeout),
+		Privacy:       store.NewPostgresPrivacyStore(db.Pool, hasher, timeout),
+	}
+}
+
+// New wires handlers and middleware on top of the given stores. It does not
+// open a database, DB stays nil and readiness checks skip the database.
+// Notices to users, like reset tokens, are sent through notifier.
+func New(cfg *config.Config, logger *slog.Logger, stores Stores, notifier notify.Notifier, appMetrics *metrics.Metrics) (*Application, error) {
+	loginGuard := lockout.NewGuard(stores.LoginFailures)
+	jwtManager, denylist, err := newJWTManager(cfg.Tokens, stores.Tokens)
+	if err != nil {
+		return nil, err
+	}
+	clientIP, err := cfg.Server.ClientIPResolver()
 	if err != nil {
 		return nil, err
 	}
-	err = store.MigrateFS(pgDB, migrations.FS, ".")
+	hasher := cfg.Security.PasswordHasher()
+	passwordPolicy, err := cfg.Security.PasswordPolicy()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if passwordPolicy.Breached != nil {
+		logger.Info("loaded breached password hashes", "count", passwordPolicy.Breached.Len())
 	}
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
-	articleStore := store.NewPostgresArticleStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
-	reviewStore := store.NewPostgresReviewStore(pgDB)
-	tokenStore := store.NewPostgresTokenStore(pgDB)
 	userMiddleware := middleware.UserMiddleware{
-		UserStore: userStore,
+		UserStore: stores.Users,
+		JWT:       jwtManager,
+		Logger:    logger,
 	}
 	// Initialize handlers from api package, creates a new instance of ArticleHandler and returns pointer to it
-	articleHandler := api.NewArticleHandler(articleStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	reviewHandler := api.NewReviewHandler(reviewStore, articleStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
+	articleHandler := api.NewArticleHandler(stores.Articles, appMetrics, cfg.Server.MaxBodyBytes, logger)
+	revoker := tokens.Revoker{Tokens: stores.Tokens, Denylist: denylist}
+	userHandler := api.NewUserHandler(stores.Users, passwordPolicy, hasher, revoker, cfg.Server.MaxBodyBytes, logger)
+	reviewHandler := api.NewReviewHandler(stores.Reviews, stores.Articles, appMetrics, cfg.Server.MaxBodyBytes, logger)
+	tokenHandler := api.NewTokenHandler(stores.Tokens, stores.Users, stores.MFA, jwtManager, loginGuard, clientIP, notifier, passwordPolicy, hasher, revoker, api.TokenTTLs{
+		Auth:          cfg.Tokens.AuthTTL,
+		ResetPassword: cfg.Tokens.ResetPasswordTTL,
+		MFAChallenge:  cfg.Tokens.MFAChallengeTTL,
+	}, appMetrics, cfg.Server.MaxBodyBytes, logger)
+	mfaHandler := api.NewMFAHandler(stores.MFA, stores.Users, cfg.Server.MaxBodyBytes, logger)
+	adminHandler := api.NewAdminHandler(stores.Users, loginGuard, logger)
+	privacyHandler := api.NewPrivacyHandler(stores.Privacy, api.ErasurePolicy{
+		GracePeriod:  cfg.Privacy.ErasureGracePeriod,
+		KeepArticles: cfg.Privacy.KeepArticles,
+		KeepReviews:  cfg.Privacy.KeepReviews,
+	}, denylist, logger)
 
 	app := &Application{
 		Logger:         logger,
@@ -56,13 +202,45 @@ func NewApplication() (*Application, error) {
 		UserHandler:    userHandler,
 		ReviewHandler:  reviewHandler,
 		TokenHandler:   tokenHandler,
+		MFAHandler:     mfaHandler,
+		AdminHandler:   adminHandler,
+		PrivacyHandler: privacyHandler,
 		Middleware:     userMiddleware,
-		DB:             pgDB,
+		Config:         cfg,
+		Metrics:        appMetrics,
+		TokenStore:     stores.Tokens,
+		PrivacyStore:   stores.Privacy,
+		denylist:       denylist,
+		loginGuard:     loginGuard,
 	}
+	if denylist != nil {
+		// a failed load is retried by the sync worker
+		err = denylist.Sync(context.Background())
+		if err != nil {
+			logger.Error("error loading revoked tokens", "error", err)
+		}
+	}
+	app.workersCtx, app.stopWorkers = context.WithCancel(context.Background())
 	return app, nil
 }
 
-// HealthCheck is a simple handler to check the health of the application
-func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "Status is available")
+// newJWTManager loads the signing keys when signed tokens are enabled and
+// keeps revocations in the token store, it returns nil in the default
+// opaque token mode
+func newJWTManager(cfg config.TokenConfig, tokenStore store.TokenStore) (*tokens.JWTManager, *tokens.SharedDenylist, error) {
+	if cfg.Mode != tokens.ModeJWT {
+		return nil, nil, nil
+	}
+	keyring, err := tokens.LoadKeyring(cfg.KeysDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.RotateKey {
+		_, err = keyring.Rotate()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	denylist := tokens.NewSharedDenylist(tokenStore, cfg.AuthTTL)
+	return tokens.NewJWTManager(keyring, denylist), denylist, nil
 }
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/utils"
+)
+
+// readinessTimeout bounds every dependency check of a readiness probe
+const readinessTimeout = 2 * time.Second
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	Current   *int64 `json:"current,omitempty"`
+	Expected  *int64 `json:"expected,omitempty"`
+}
+
+// HealthCheck is the liveness probe, it only tells that the process is up
+// and serving requests
+func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": "alive"})
+}
+
+// ReadinessCheck tells whether the application can serve traffic: the
+// database answers, its schema is at the expected migration and the server
+// is not shutting down. Every dependency is reported separately.
+func (a *Application) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]dependencyStatus{
+		"shutdown": {Status: "ok"},
+	}
+	if a.DB != nil {
+		checks["database"], checks["migrations"] = a.checkDatabase(ctx)
+	}
+	if a.ShuttingDown() {
+		checks["shutdown"] = dependencyStatus{Status: "draining"}
+	}
+
+	status := http.StatusOK
+	ready := "ready"
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status = http.StatusServiceUnavailable
+			ready = "not_ready"
+		}
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"status": ready, "checks": checks})
+}
+
+// checkDatabase reads the schema version, the one query tells both whether
+// the database answers and whether its schema is current. Driver errors can
+// name hosts and users, they are logged and not put in the response.
+func (a *Application) checkDatabase(ctx context.Context) (dependencyStatus, dependencyStatus) {
+	start := time.Now()
+	current, err := a.DB.SchemaVersion(ctx)
+	if err != nil {
+		a.Logger.ErrorContext(ctx, "readiness check failed", "error", err)
+		failed := dependencyStatus{Status: "error", Error: "database unavailable"}
+		return failed, dependencyStatus{Status: "unknown"}
+	}
+	database := dependencyStatus{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+	status := "ok"
+	expected := a.schemaVersion
+	if current != expected {
+		status = "outdated"
+	}
+	return database, dependencyStatus{Status: status, Current: &current, Expected: &expected}
+}
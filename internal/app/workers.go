@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// StartWorker runs fn in the background, fn must return once ctx is cancelled
+// which happens when the application is closed
+func (a *Application) StartWorker(fn func(ctx context.Context)) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		fn(a.workersCtx)
+	}()
+}
+
+// StartBackgroundJobs starts the periodic jobs the server needs
+func (a *Application) StartBackgroundJobs() {
+	a.StartWorker(a.cleanupExpiredTokens)
+	a.StartWorker(a.eraseDueUsers)
+	a.StartWorker(a.cleanupLoginFailures)
+	if a.denylist != nil {
+		a.StartWorker(a.syncDenylist)
+	}
+}
+
+// cleanupExpiredTokens deletes expired tokens once an hour
+func (a *Application) cleanupExpiredTokens(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		deleted, err := a.TokenStore.DeleteExpiredTokens(ctx)
+		if err != nil {
+			a.Logger.Error("error deleting expired tokens", "error", err)
+		} else if deleted > 0 {
+			a.Logger.Info("deleted expired tokens", "count", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupLoginFailures deletes failed login counters that expired, once an
+// hour, so emails and client IPs are not kept longer than needed
+func (a *Application) cleanupLoginFailures(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		deleted, err := a.loginGuard.DeleteStale(ctx)
+		if err != nil {
+			a.Logger.Error("error deleting stale login failures", "error", err)
+		} else if deleted > 0 {
+			a.Logger.Info("deleted stale login failures", "count", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncDenylist reloads revoked signed tokens, so revocations made by other
+// replicas are honoured within tokens.denylist_sync_interval
+func (a *Application) syncDenylist(ctx context.Context) {
+	ticker := time.NewTicker(a.Config.Tokens.DenylistSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := a.denylist.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			a.Logger.Error("error syncing revoked tokens", "error", err)
+		}
+	}
+}
+
+// eraseDueUsers makes the erasures whose grace period ended final, once an
+// hour. A failed erasure stays pending and is tried again the next time.
+func (a *Application) eraseDueUsers(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		erasures, err := a.PrivacyStore.DueErasures(ctx, time.Now())
+		if err != nil {
+			a.Logger.Error("error listing due erasures", "error", err)
+		}
+		for _, erasure := range erasures {
+			if a.denylist != nil {
+				err = a.denylist.RevokeUser(ctx, erasure.UserID)
+				if err != nil {
+					a.Logger.Error("error revoking signed tokens", "user_id", erasure.UserID, "error", err)
+					continue
+				}
+			}
+			err = a.PrivacyStore.EraseUser(ctx, erasure)
+			if err != nil {
+				a.Logger.Error("error erasing user", "user_id", erasure.UserID, "error", err)
+				continue
+			}
+			a.Logger.Info("erased user", "user_id", erasure.UserID)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// BeginShutdown marks the application as shutting down, readiness
+// checks start failing from this point
+func (a *Application) BeginShutdown() {
+	a.shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether BeginShutdown was called
+func (a *Application) ShuttingDown() bool {
+	return a.shuttingDown.Load()
+}
+
+// Close stops background workers, flushes pending spans and closes the
+// database pool, it should be called after the HTTP server has stopped
+func (a *Application) Close() error {
+	a.BeginShutdown()
+	a.stopWorkers()
+	a.workers.Wait()
+	var err error
+	if a.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = a.shutdownTracing(ctx)
+	}
+	if a.DB != nil {
+		a.DB.Close()
+	}
+	return err
+}
@@ -0,0 +1,583 @@
+// Package config loads the application settings. Every setting has a
+// default, which can be overridden by an optional YAML file, then by
+// ARTICLES_* environment variables and finally by command-line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/tracing"
+	"github.com/makhammatovb/Articles/internal/utils"
+)
+
+const envPrefix = "ARTICLES_"
+
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Tokens   TokenConfig    `yaml:"tokens"`
+	Security SecurityConfig `yaml:"security"`
+	Log      LogConfig      `yaml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	Privacy  PrivacyConfig  `yaml:"privacy"`
+}
+
+type ServerConfig struct {
+	Port         int           `yaml:"port"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// DrainDelay is how long the server keeps accepting requests after a
+	// shutdown signal while readiness already fails, so load balancers stop
+	// routing to it before its listener closes
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// MaxBodyBytes is the largest JSON request body accepted
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// TrustedProxies are the IP addresses or CIDR ranges of the proxies in
+	// front of the server, only they may set ClientIPHeader
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	ClientIPHeader string   `yaml:"client_ip_header"`
+}
+
+type DatabaseConfig struct {
+	// Driver is store.DriverPostgres or store.DriverSQLite, for SQLite the
+	// DSN is the path of the database file
+	Driver            string        `yaml:"driver"`
+	DSN               string        `yaml:"dsn"`
+	MaxConns          int           `yaml:"max_conns"`
+	MinConns          int           `yaml:"min_conns"`
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime   time.Duration `yaml:"conn_max_idle_time"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+	// StatementCacheSize is the number of prepared statements cached per
+	// connection, 0 disables the cache
+	StatementCacheSize int `yaml:"statement_cache_size"`
+	// QueryTimeout bounds every store call, 0 disables it
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	// AutoMigrate applies pending migrations when the server starts, turn it
+	// off to run them with the migrate command instead
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type TokenConfig struct {
+	// Mode is tokens.ModeOpaque or tokens.ModeJWT
+	Mode    string `yaml:"mode"`
+	KeysDir string `yaml:"keys_dir"`
+	// RotateKey generates a new signing key on startup
+	RotateKey        bool          `yaml:"rotate_key"`
+	AuthTTL          time.Duration `yaml:"auth_ttl"`
+	ResetPasswordTTL time.Duration `yaml:"reset_password_ttl"`
+	MFAChallengeTTL  time.Duration `yaml:"mfa_challenge_ttl"`
+	// DenylistSyncInterval is how often revoked signed tokens are reloaded
+	// from the database, revocations made by other replicas take up to this
+	// long to be honoured
+	DenylistSyncInterval time.Duration `yaml:"denylist_sync_interval"`
+}
+
+type SecurityConfig struct {
+	PasswordHash          string `yaml:"password_hash"`
+	BcryptCost            int    `yaml:"bcrypt_cost"`
+	Argon2Memory          uint32 `yaml:"argon2_memory"`
+	Argon2Iterations      uint32 `yaml:"argon2_iterations"`
+	Argon2Parallelism     uint8  `yaml:"argon2_parallelism"`
+	BreachedPasswordsFile string `yaml:"breached_passwords_file"`
+	// Password are the rules new passwords have to follow
+	Password PasswordConfig `yaml:"password"`
+}
+
+type PasswordConfig struct {
+	MinLength int `yaml:"min_length"`
+	// MaxLength of 0 allows any length, bcrypt ignores everything after 72 bytes
+	MaxLength     int  `yaml:"max_length"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// HistorySize is how many of the latest passwords, the current one
+	// included, cannot be reused. 0 disables the check.
+	HistorySize int `yaml:"history_size"`
+	// DisallowEmail rejects passwords containing the email or its local part
+	DisallowEmail bool `yaml:"disallow_email"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+}
+
+type TracingConfig struct {
+	// Exporter is tracing.ExporterNone, tracing.ExporterOTLP or tracing.ExporterStdout
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host:port of an OTLP/HTTP collector
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type PrivacyConfig struct {
+	// ErasureGracePeriod is how long a deleted account can still be
+	// restored before it is erased, 0 erases it right away
+	ErasureGracePeriod time.Duration `yaml:"erasure_grace_period"`
+	// KeepArticles and KeepReviews keep the content of erased users under
+	// an anonymized author instead of deleting it
+	KeepArticles bool `yaml:"keep_articles"`
+	KeepReviews  bool `yaml:"keep_reviews"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	hasher := passwords.DefaultHasher
+	policy := passwords.DefaultPolicy
+	return &Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     time.Minute,
+			ShutdownTimeout: 30 * time.Second,
+			MaxBodyBytes:    1 << 20,
+			ClientIPHeader:  "X-Forwarded-For",
+		},
+		Database: DatabaseConfig{
+			Driver:             store.DriverPostgres,
+			DSN:                "host=localhost user=postgres password=postgres dbname=articles port=5432 sslmode=disable",
+			MaxConns:           25,
+			MinConns:           2,
+			ConnMaxLifetime:    time.Hour,
+			ConnMaxIdleTime:    15 * time.Minute,
+			HealthCheckPeriod:  time.Minute,
+			StatementCacheSize: 512,
+			QueryTimeout:       5 * time.Second,
+			AutoMigrate:        true,
+		},
+		Tokens: TokenConfig{
+			Mode:                 tokens.ModeOpaque,
+			KeysDir:              "keys",
+			AuthTTL:              24 * time.Hour,
+			ResetPasswordTTL:     10 * time.Minute,
+			MFAChallengeTTL:      5 * time.Minute,
+			DenylistSyncInterval: 10 * time.Second,
+		},
+		Security: SecurityConfig{
+			PasswordHash:      hasher.Algorithm,
+			BcryptCost:        hasher.BcryptCost,
+			Argon2Memory:      hasher.Argon2.Memory,
+			Argon2Iterations:  hasher.Argon2.Iterations,
+			Argon2Parallelism: hasher.Argon2.Parallelism,
+			Password: PasswordConfig{
+				MinLength:     policy.MinLength,
+				MaxLength:     policy.MaxLength,
+				RequireLower:  policy.RequireLower,
+				RequireUpper:  policy.RequireUpper,
+				RequireDigit:  policy.RequireDigit,
+				RequireSymbol: policy.RequireSymbol,
+				HistorySize:   policy.HistorySize,
+				DisallowEmail: policy.DisallowEmail,
+			},
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+		},
+		Privacy: PrivacyConfig{
+			ErasureGracePeriod: 30 * 24 * time.Hour,
+			// reviews sit on other people's articles, deleting them would
+			// change ratings the readers already saw
+			KeepReviews: true,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the optional file given with
+// -config or ARTICLES_CONFIG, the environment and args, then validates it
+func Load(name string, args []string) (*Config, error) {
+	cfg, _, err := LoadArgs(name, args, nil)
+	return cfg, err
+}
+
+// LoadArgs is Load for commands that take arguments, it also returns the
+// arguments left after the flags. commandFlags registers the flags of the
+// command next to the settings, it may be nil.
+func LoadArgs(name string, args []string, commandFlags func(fs *flag.FlagSet)) (*Config, []string, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	envNames := cfg.bind(fs)
+	fs.String("config", "", "Path to a YAML config file (env "+envPrefix+"CONFIG)")
+	if commandFlags != nil {
+		commandFlags(fs)
+	}
+
+	// the file has the lowest precedence after defaults, so it has to be
+	// read before flags are applied, look for its path on its own first
+	path := configPath(name, args, commandFlags)
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path != "" {
+		err := cfg.loadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envNames[f.Name])
+		if !ok || envNames[f.Name] == "" {
+			return
+		}
+		err := f.Value.Set(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", envNames[f.Name], err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// configPath finds the -config flag, parse errors are left for the real parse to report
+func configPath(name string, args []string, commandFlags func(fs *flag.FlagSet)) string {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	Default().bind(fs)
+	if commandFlags != nil {
+		commandFlags(fs)
+	}
+	path := fs.String("config", "", "")
+	_ = fs.Parse(args)
+	return *path
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read file %w", err)
+	}
+	// a misspelled or misplaced key would otherwise leave its default in place
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// bind registers a flag for every setting and returns the environment
+// variable name of each flag
+func (c *Config) bind(fs *flag.FlagSet) map[string]string {
+	env := map[string]string{}
+	add := func(name, envName string) {
+		env[name] = envPrefix + envName
+	}
+
+	fs.IntVar(&c.Server.Port, "port", c.Server.Port, "Port to run the server on")
+	add("port", "PORT")
+	fs.DurationVar(&c.Server.ReadTimeout, "read-timeout", c.Server.ReadTimeout, "HTTP read timeout")
+	add("read-timeout", "READ_TIMEOUT")
+	fs.DurationVar(&c.Server.WriteTimeout, "write-timeout", c.Server.WriteTimeout, "HTTP write timeout")
+	add("write-timeout", "WRITE_TIMEOUT")
+	fs.DurationVar(&c.Server.IdleTimeout, "idle-timeout", c.Server.IdleTimeout, "HTTP keep-alive idle timeout")
+	add("idle-timeout", "IDLE_TIMEOUT")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "Time allowed for in-flight requests to finish on shutdown")
+	add("shutdown-timeout", "SHUTDOWN_TIMEOUT")
+	fs.DurationVar(&c.Server.DrainDelay, "drain-delay", c.Server.DrainDelay, "Time to keep serving after a shutdown signal while readiness fails, 0 closes right away")
+	add("drain-delay", "DRAIN_DELAY")
+	fs.Int64Var(&c.Server.MaxBodyBytes, "max-body-bytes", c.Server.MaxBodyBytes, "Largest JSON request body accepted, in bytes")
+	add("max-body-bytes", "MAX_BODY_BYTES")
+	fs.Var(listValue{&c.Server.TrustedProxies}, "trusted-proxies", "Comma separated IP addresses or CIDR ranges of proxies allowed to set the client IP header")
+	add("trusted-proxies", "TRUSTED_PROXIES")
+	fs.StringVar(&c.Server.ClientIPHeader, "client-ip-header", c.Server.ClientIPHeader, "Header trusted proxies put the client address in")
+	add("client-ip-header", "CLIENT_IP_HEADER")
+
+	fs.StringVar(&c.Database.Driver, "db-driver", c.Database.Driver, "Database driver, postgres or sqlite")
+	add("db-driver", "DB_DRIVER")
+	fs.StringVar(&c.Database.DSN, "db-dsn", c.Database.DSN, "Postgres connection string or SQLite database file")
+	add("db-dsn", "DB_DSN")
+	fs.IntVar(&c.Database.MaxConns, "db-max-conns", c.Database.MaxConns, "Maximum database connections in the pool")
+	add("db-max-conns", "DB_MAX_CONNS")
+	fs.IntVar(&c.Database.MinConns, "db-min-conns", c.Database.MinConns, "Database connections the pool keeps open when idle")
+	add("db-min-conns", "DB_MIN_CONNS")
+	fs.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", c.Database.ConnMaxLifetime, "Maximum lifetime of a database connection")
+	add("db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME")
+	fs.DurationVar(&c.Database.ConnMaxIdleTime, "db-conn-max-idle-time", c.Database.ConnMaxIdleTime, "Maximum idle time of a database connection")
+	add("db-conn-max-idle-time", "DB_CONN_MAX_IDLE_TIME")
+	fs.DurationVar(&c.Database.HealthCheckPeriod, "db-health-check-period", c.Database.HealthCheckPeriod, "How often idle database connections are checked")
+	add("db-health-check-period", "DB_HEALTH_CHECK_PERIOD")
+	fs.IntVar(&c.Database.StatementCacheSize, "db-statement-cache-size", c.Database.StatementCacheSize, "Prepared statements cached per connection, 0 to disable")
+	add("db-statement-cache-size", "DB_STATEMENT_CACHE_SIZE")
+	fs.DurationVar(&c.Database.QueryTimeout, "db-query-timeout", c.Database.QueryTimeout, "Maximum duration of a database call, 0 for no limit")
+	add("db-query-timeout", "DB_QUERY_TIMEOUT")
+	fs.BoolVar(&c.Database.AutoMigrate, "db-auto-migrate", c.Database.AutoMigrate, "Apply pending migrations when the server starts")
+	add("db-auto-migrate", "DB_AUTO_MIGRATE")
+
+	fs.StringVar(&c.Tokens.Mode, "token-mode", c.Tokens.Mode, "Auth token mode: opaque or jwt")
+	add("token-mode", "TOKEN_MODE")
+	fs.StringVar(&c.Tokens.KeysDir, "token-keys-dir", c.Tokens.KeysDir, "Directory with signing keys for jwt token mode")
+	add("token-keys-dir", "TOKEN_KEYS_DIR")
+	fs.BoolVar(&c.Tokens.RotateKey, "rotate-token-key", c.Tokens.RotateKey, "Generate a new signing key on startup (jwt token mode)")
+	add("rotate-token-key", "ROTATE_TOKEN_KEY")
+	fs.DurationVar(&c.Tokens.AuthTTL, "auth-token-ttl", c.Tokens.AuthTTL, "Lifetime of auth tokens")
+	add("auth-token-ttl", "AUTH_TOKEN_TTL")
+	fs.DurationVar(&c.Tokens.ResetPasswordTTL, "reset-token-ttl", c.Tokens.ResetPasswordTTL, "Lifetime of password reset tokens")
+	add("reset-token-ttl", "RESET_TOKEN_TTL")
+	fs.DurationVar(&c.Tokens.MFAChallengeTTL, "mfa-token-ttl", c.Tokens.MFAChallengeTTL, "Lifetime of two-factor challenge tokens")
+	add("mfa-token-ttl", "MFA_TOKEN_TTL")
+	fs.DurationVar(&c.Tokens.DenylistSyncInterval, "token-denylist-sync-interval", c.Tokens.DenylistSyncInterval, "How often revoked signed tokens are reloaded from the database (jwt token mode)")
+	add("token-denylist-sync-interval", "TOKEN_DENYLIST_SYNC_INTERVAL")
+
+	fs.StringVar(&c.Security.PasswordHash, "password-hash", c.Security.PasswordHash, "Algorithm for new password hashes: argon2id or bcrypt")
+	add("password-hash", "PASSWORD_HASH")
+	fs.IntVar(&c.Security.BcryptCost, "bcrypt-cost", c.Security.BcryptCost, "bcrypt cost factor")
+	add("bcrypt-cost", "BCRYPT_COST")
+	fs.Var(uintValue[uint32]{&c.Security.Argon2Memory}, "argon2-memory", "argon2id memory in KiB")
+	add("argon2-memory", "ARGON2_MEMORY")
+	fs.Var(uintValue[uint32]{&c.Security.Argon2Iterations}, "argon2-iterations", "argon2id iterations")
+	add("argon2-iterations", "ARGON2_ITERATIONS")
+	fs.Var(uintValue[uint8]{&c.Security.Argon2Parallelism}, "argon2-parallelism", "argon2id parallelism")
+	add("argon2-parallelism", "ARGON2_PARALLELISM")
+	fs.StringVar(&c.Security.BreachedPasswordsFile, "breached-passwords", c.Security.BreachedPasswordsFile, "File with SHA-1 hashes of breached passwords to reject")
+	add("breached-passwords", "BREACHED_PASSWORDS_FILE")
+	fs.IntVar(&c.Security.Password.MinLength, "password-min-length", c.Security.Password.MinLength, "Minimum length of new passwords")
+	add("password-min-length", "PASSWORD_MIN_LENGTH")
+	fs.IntVar(&c.Security.Password.MaxLength, "password-max-length", c.Security.Password.MaxLength, "Maximum length of new passwords, 0 for no limit")
+	add("password-max-length", "PASSWORD_MAX_LENGTH")
+	fs.BoolVar(&c.Security.Password.RequireLower, "password-require-lower", c.Security.Password.RequireLower, "New passwords need a lowercase letter")
+	add("password-require-lower", "PASSWORD_REQUIRE_LOWER")
+	fs.BoolVar(&c.Security.Password.RequireUpper, "password-require-upper", c.Security.Password.RequireUpper, "New passwords need an uppercase letter")
+	add("password-require-upper", "PASSWORD_REQUIRE_UPPER")
+	fs.BoolVar(&c.Security.Password.RequireDigit, "password-require-digit", c.Security.Password.RequireDigit, "New passwords need a digit")
+	add("password-require-digit", "PASSWORD_REQUIRE_DIGIT")
+	fs.BoolVar(&c.Security.Password.RequireSymbol, "password-require-symbol", c.Security.Password.RequireSymbol, "New passwords need a symbol")
+	add("password-require-symbol", "PASSWORD_REQUIRE_SYMBOL")
+	fs.IntVar(&c.Security.Password.HistorySize, "password-history-size", c.Security.Password.HistorySize, "Number of latest passwords, the current one included, that cannot be reused, 0 to allow reuse")
+	add("password-history-size", "PASSWORD_HISTORY_SIZE")
+	fs.BoolVar(&c.Security.Password.DisallowEmail, "password-disallow-email", c.Security.Password.DisallowEmail, "Reject passwords containing the email")
+	add("password-disallow-email", "PASSWORD_DISALLOW_EMAIL")
+
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Log level: debug, info, warn or error")
+	add("log-level", "LOG_LEVEL")
+
+	fs.StringVar(&c.Tracing.Exporter, "tracing-exporter", c.Tracing.Exporter, "Trace exporter: none, otlp or stdout")
+	add("tracing-exporter", "TRACING_EXPORTER")
+	fs.StringVar(&c.Tracing.Endpoint, "otlp-endpoint", c.Tracing.Endpoint, "host:port of the OTLP/HTTP trace collector")
+	add("otlp-endpoint", "OTLP_ENDPOINT")
+	fs.BoolVar(&c.Tracing.Insecure, "otlp-insecure", c.Tracing.Insecure, "Send traces to the collector over plain HTTP")
+	add("otlp-insecure", "OTLP_INSECURE")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "Fraction of new traces to record, from 0 to 1")
+	add("trace-sample-ratio", "TRACE_SAMPLE_RATIO")
+
+	fs.DurationVar(&c.Privacy.ErasureGracePeriod, "erasure-grace-period", c.Privacy.ErasureGracePeriod, "Time a deleted account can be restored before it is erased, 0 to erase at once")
+	add("erasure-grace-period", "ERASURE_GRACE_PERIOD")
+	fs.BoolVar(&c.Privacy.KeepArticles, "erasure-keep-articles", c.Privacy.KeepArticles, "Keep the articles of erased users under an anonymized author")
+	add("erasure-keep-articles", "ERASURE_KEEP_ARTICLES")
+	fs.BoolVar(&c.Privacy.KeepReviews, "erasure-keep-reviews", c.Privacy.KeepReviews, "Keep the reviews of erased users under an anonymized author")
+	add("erasure-keep-reviews", "ERASURE_KEEP_REVIEWS")
+	return env
+}
+
+// uintValue is a flag.Value for the unsigned integer sizes the flag package lacks
+type uintValue[T uint8 | uint32] struct {
+	p *T
+}
+
+func (v uintValue[T]) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.FormatUint(uint64(*v.p), 10)
+}
+
+func (v uintValue[T]) Set(s string) error {
+	var zero T
+	bits := 8
+	if any(zero) == any(uint32(0)) {
+		bits = 32
+	}
+	n, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return err
+	}
+	*v.p = T(n)
+	return nil
+}
+
+// listValue is a flag.Value for a comma separated list, an empty value
+// clears the list
+type listValue struct {
+	p *[]string
+}
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = nil
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			*v.p = append(*v.p, item)
+		}
+	}
+	return nil
+}
+
+// ClientIPResolver returns the resolver of client addresses behind the
+// trusted proxies
+func (s ServerConfig) ClientIPResolver() (utils.ClientIPResolver, error) {
+	return utils.NewClientIPResolver(s.ClientIPHeader, s.TrustedProxies)
+}
+
+// PoolOptions returns the connection pool settings of the database
+func (d DatabaseConfig) PoolOptions() store.PoolOptions {
+	return store.PoolOptions{
+		MaxConns:               int32(d.MaxConns),
+		MinConns:               int32(d.MinConns),
+		MaxConnLifetime:        d.ConnMaxLifetime,
+		MaxConnIdleTime:        d.ConnMaxIdleTime,
+		HealthCheckPeriod:      d.HealthCheckPeriod,
+		StatementCacheCapacity: d.StatementCacheSize,
+	}
+}
+
+// PasswordHasher returns the hasher described by the security settings
+func (s SecurityConfig) PasswordHasher() passwords.Hasher {
+	hasher := passwords.DefaultHasher
+	hasher.Algorithm = s.PasswordHash
+	hasher.BcryptCost = s.BcryptCost
+	hasher.Argon2.Memory = s.Argon2Memory
+	hasher.Argon2.Iterations = s.Argon2Iterations
+	hasher.Argon2.Parallelism = s.Argon2Parallelism
+	return hasher
+}
+
+// PasswordPolicy returns the policy for new passwords, loading the breached
+// password list when one is configured
+func (s SecurityConfig) PasswordPolicy() (passwords.Policy, error) {
+	policy := passwords.Policy{
+		MinLength:     s.Password.MinLength,
+		MaxLength:     s.Password.MaxLength,
+		RequireLower:  s.Password.RequireLower,
+		RequireUpper:  s.Password.RequireUpper,
+		RequireDigit:  s.Password.RequireDigit,
+		RequireSymbol: s.Password.RequireSymbol,
+		HistorySize:   s.Password.HistorySize,
+		DisallowEmail: s.Password.DisallowEmail,
+	}
+	if s.BreachedPasswordsFile == "" {
+		return policy, nil
+	}
+	var err error
+	policy.Breached, err = passwords.LoadBreachedList(s.BreachedPasswordsFile)
+	return policy, err
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drain_delay must not be negative")
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive")
+	_, err := c.Server.ClientIPResolver()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("server.trusted_proxies: %w", err))
+	}
+	check(len(c.Server.TrustedProxies) == 0 || c.Server.ClientIPHeader != "",
+		"server.client_ip_header is required with server.trusted_proxies")
+
+	check(c.Database.Driver == store.DriverPostgres || c.Database.Driver == store.DriverSQLite,
+		"database.driver must be %q or %q, got %q", store.DriverPostgres, store.DriverSQLite, c.Database.Driver)
+	check(c.Database.DSN != "", "database.dsn is required")
+	check(c.Database.MaxConns > 0 && c.Database.MaxConns <= math.MaxInt32, "database.max_conns must be positive")
+	check(c.Database.MinConns >= 0 && c.Database.MinConns <= c.Database.MaxConns,
+		"database.min_conns must be between 0 and database.max_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time must not be negative")
+	check(c.Database.HealthCheckPeriod > 0, "database.health_check_period must be positive")
+	check(c.Database.StatementCacheSize >= 0, "database.statement_cache_size must not be negative")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout must not be negative")
+
+	check(c.Tokens.Mode == tokens.ModeOpaque || c.Tokens.Mode == tokens.ModeJWT,
+		"tokens.mode must be %q or %q, got %q", tokens.ModeOpaque, tokens.ModeJWT, c.Tokens.Mode)
+	check(c.Tokens.Mode != tokens.ModeJWT || c.Tokens.KeysDir != "", "tokens.keys_dir is required in jwt mode")
+	check(c.Tokens.AuthTTL > 0, "tokens.auth_ttl must be positive")
+	check(c.Tokens.ResetPasswordTTL > 0, "tokens.reset_password_ttl must be positive")
+	check(c.Tokens.MFAChallengeTTL > 0, "tokens.mfa_challenge_ttl must be positive")
+	check(c.Tokens.DenylistSyncInterval > 0, "tokens.denylist_sync_interval must be positive")
+
+	err = c.Security.PasswordHasher().Validate()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("security: %w", err))
+	}
+	password := c.Security.Password
+	check(password.MinLength > 0, "security.password.min_length must be positive")
+	check(password.MaxLength == 0 || password.MaxLength >= password.MinLength,
+		"security.password.max_length must be 0 or at least security.password.min_length")
+	check(c.Security.PasswordHash != passwords.AlgorithmBcrypt || (password.MaxLength > 0 && password.MaxLength <= 72),
+		"security.password.max_length must be between 1 and 72 with bcrypt, which ignores longer passwords")
+	check(password.HistorySize >= 0, "security.password.history_size must not be negative")
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, otlp or stdout, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(c.Privacy.ErasureGracePeriod >= 0, "privacy.erasure_grace_period must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
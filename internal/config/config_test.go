@@ -0,0 +1,137 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+server:
+  port: 9000
+  read_timeout: 5s
+database:
+  dsn: postgres://file
+tokens:
+  auth_ttl: 2h
+`), 0o600)
+	require.NoError(t, err)
+
+	t.Setenv("ARTICLES_DB_DSN", "postgres://env")
+	t.Setenv("ARTICLES_AUTH_TOKEN_TTL", "3h")
+
+	cfg, err := Load("test", []string{"-config", path, "-auth-token-ttl", "4h"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 9000, cfg.Server.Port, "file overrides default")
+	assert.Equal(t, 5*time.Second, cfg.Server.ReadTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Server.WriteTimeout, "default kept")
+	assert.Equal(t, "postgres://env", cfg.Database.DSN, "env overrides file")
+	assert.Equal(t, 4*time.Hour, cfg.Tokens.AuthTTL, "flag overrides env")
+}
+
+func TestLoadUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+server:
+  port: 9000
+  auth_ttl: 2h
+`), 0o600)
+	require.NoError(t, err)
+
+	_, err = Load("test", []string{"-config", path})
+	assert.ErrorContains(t, err, "field auth_ttl not found")
+
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = Load("test", []string{"-config", empty})
+	assert.NoError(t, err, "an empty file keeps the defaults")
+}
+
+func TestLoadValidation(t *testing.T) {
+	_, err := Load("test", []string{"-port", "0", "-max-body-bytes", "0", "-drain-delay", "-1s", "-trusted-proxies", "10.0.0.0/8,proxy", "-token-denylist-sync-interval", "0", "-token-mode", "paseto", "-log-level", "loud", "-bcrypt-cost", "1", "-password-hash", "bcrypt"})
+	require.Error(t, err)
+	for _, want := range []string{"server.port", "server.max_body_bytes", "server.drain_delay", "server.trusted_proxies", "tokens.denylist_sync_interval", "tokens.mode", "log.level", "bcrypt cost"} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	t.Setenv("ARTICLES_PORT", "not-a-number")
+	_, err = Load("test", nil)
+	assert.ErrorContains(t, err, "ARTICLES_PORT")
+}
+
+func TestLoadArgs(t *testing.T) {
+	cfg, args, err := LoadArgs("test", []string{"-db-auto-migrate=false", "up", "-port", "1"}, nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.Database.AutoMigrate)
+	assert.Equal(t, 8080, cfg.Server.Port, "flags after the first argument are arguments")
+	assert.Equal(t, []string{"up", "-port", "1"}, args)
+
+	var users int
+	cfg, args, err = LoadArgs("test", []string{"-users", "50", "-port", "9000"}, func(fs *flag.FlagSet) {
+		fs.IntVar(&users, "users", 10, "")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 50, users, "command flags mix with the settings")
+	assert.Equal(t, 9000, cfg.Server.Port)
+	assert.Empty(t, args)
+
+	t.Setenv("ARTICLES_TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.7")
+	cfg, err = Load("test", nil)
+	require.NoError(t, err)
+	assert.True(t, cfg.Database.AutoMigrate)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7"}, cfg.Server.TrustedProxies)
+	assert.Equal(t, "X-Forwarded-For", cfg.Server.ClientIPHeader)
+	assert.Equal(t, "postgres", cfg.Database.Driver)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+security:
+  password:
+    min_length: 12
+    require_symbol: true
+`), 0o600)
+	require.NoError(t, err)
+	t.Setenv("ARTICLES_PASSWORD_HISTORY_SIZE", "0")
+
+	cfg, err := Load("test", []string{"-config", path, "-password-disallow-email=false"})
+	require.NoError(t, err)
+	policy, err := cfg.Security.PasswordPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, 12, policy.MinLength)
+	assert.Equal(t, 72, policy.MaxLength, "default kept")
+	assert.True(t, policy.RequireUpper, "default kept")
+	assert.True(t, policy.RequireSymbol)
+	assert.Equal(t, 0, policy.HistorySize)
+	assert.False(t, policy.DisallowEmail)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "min above max", args: []string{"-password-min-length", "20", "-password-max-length", "10"}, want: "security.password.max_length must be 0 or at least"},
+		{name: "no min", args: []string{"-password-min-length", "0"}, want: "security.password.min_length"},
+		{name: "negative history", args: []string{"-password-history-size", "-1"}, want: "security.password.history_size"},
+		{name: "too long for bcrypt", args: []string{"-password-hash", "bcrypt", "-password-max-length", "100"}, want: "between 1 and 72 with bcrypt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load("test", tt.args)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+
+	cfg, err = Load("test", []string{"-password-max-length", "0"})
+	require.NoError(t, err, "argon2id has no length limit")
+	assert.Equal(t, 0, cfg.Security.Password.MaxLength)
+}
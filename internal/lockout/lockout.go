@@ -0,0 +1,177 @@
+// Package lockout slows down password guessing by locking accounts and
+// client IPs for exponentially growing periods after repeated failures
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+// Policy decides when and for how long a key gets locked
+type Policy struct {
+	// Threshold is the number of failures allowed before the first lockout
+	Threshold int
+	// BaseDelay is the first lockout, every further failure doubles it
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered
+	Window time.Duration
+}
+
+// Delay returns how long to lock after the given number of failures
+func (p Policy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+var (
+	DefaultAccountPolicy = Policy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+	// client IPs can be shared behind NAT, so they get more room
+	DefaultIPPolicy = Policy{Threshold: 20, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	// a six digit code is guessed far quicker than a password
+	DefaultMFAPolicy = Policy{Threshold: 5, BaseDelay: 5 * time.Minute, MaxDelay: time.Hour, Window: 24 * time.Hour}
+)
+
+// Guard tracks failed logins per account and per client IP, and failed
+// second factor codes per user
+type Guard struct {
+	store   store.LoginFailureStore
+	Account Policy
+	IP      Policy
+	MFA     Policy
+}
+
+func NewGuard(store store.LoginFailureStore) *Guard {
+	return &Guard{
+		store:   store,
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+		MFA:     DefaultMFAPolicy,
+	}
+}
+
+// the keys live in the store package, erasing an account removes its rows
+var (
+	accountKey = store.AccountFailureKey
+	ipKey      = store.IPFailureKey
+	mfaKey     = store.MFAFailureKey
+)
+
+// RetryAfter returns how long the caller still has to wait, zero if neither
+// the account nor the IP is locked
+func (g *Guard) RetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		remaining, err := g.retryAfter(ctx, key, now)
+		if err != nil {
+			return 0, err
+		}
+		if remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+func (g *Guard) retryAfter(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	lockedUntil, err := g.store.GetLockedUntil(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return max(lockedUntil.Sub(now), 0), nil
+}
+
+// Fail records a failed login and reports whether it locked the account for
+// the first time within the window. Later failures keep extending the lock
+// but are not reported again, so the owner is told about a lockout once.
+func (g *Guard) Fail(ctx context.Context, email, ip string) (bool, error) {
+	now := time.Now()
+	accountLocked, err := g.fail(ctx, accountKey(email), g.Account, now)
+	if err != nil {
+		return false, err
+	}
+	_, err = g.fail(ctx, ipKey(ip), g.IP, now)
+	if err != nil {
+		return false, err
+	}
+	return accountLocked, nil
+}
+
+func (g *Guard) fail(ctx context.Context, key string, policy Policy, now time.Time) (bool, error) {
+	failures, _, err := g.record(ctx, key, policy, now)
+	return failures == policy.Threshold, err
+}
+
+// lock records a failure for key and returns how long the key is locked now
+func (g *Guard) lock(ctx context.Context, key string, policy Policy, now time.Time) (time.Duration, error) {
+	_, delay, err := g.record(ctx, key, policy, now)
+	return delay, err
+}
+
+// record counts a failure for key, locks it once the policy says so and
+// returns the failures within the window along with the lock
+func (g *Guard) record(ctx context.Context, key string, policy Policy, now time.Time) (int, time.Duration, error) {
+	failures, err := g.store.RecordFailure(ctx, key, now.Add(-policy.Window))
+	if err != nil {
+		return 0, 0, err
+	}
+	delay := policy.Delay(failures)
+	if delay == 0 {
+		return failures, 0, nil
+	}
+	return failures, delay, g.store.Lock(ctx, key, now.Add(delay))
+}
+
+// Succeed forgets the failures of an account after a correct password or a
+// password reset.
+// The IP counter is kept so an attacker cannot reset it with their own account.
+func (g *Guard) Succeed(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts the login and second factor lockouts of an account before
+// they expire. Locks of client IPs are kept, they are not tied to one account
+// and may be held by whoever was guessing its password.
+func (g *Guard) Unlock(ctx context.Context, userID int64, email string) error {
+	err := g.store.Reset(ctx, accountKey(email))
+	if err != nil {
+		return err
+	}
+	return g.store.Reset(ctx, mfaKey(userID))
+}
+
+// MFARetryAfter returns how long the user still has to wait before trying
+// another second factor code, zero if they are not locked
+func (g *Guard) MFARetryAfter(ctx context.Context, userID int64) (time.Duration, error) {
+	return g.retryAfter(ctx, mfaKey(userID), time.Now())
+}
+
+// FailMFA records a wrong second factor code and returns how long the user
+// is locked because of it, zero if they may try again right away
+func (g *Guard) FailMFA(ctx context.Context, userID int64) (time.Duration, error) {
+	return g.lock(ctx, mfaKey(userID), g.MFA, time.Now())
+}
+
+// SucceedMFA forgets the failed codes of a user after a correct one
+func (g *Guard) SucceedMFA(ctx context.Context, userID int64) error {
+	return g.store.Reset(ctx, mfaKey(userID))
+}
+
+// DeleteStale forgets keys whose failures are older than every window and
+// that are not locked anymore
+func (g *Guard) DeleteStale(ctx context.Context) (int64, error) {
+	window := max(g.Account.Window, g.IP.Window, g.MFA.Window)
+	return g.store.DeleteStale(ctx, time.Now().Add(-window))
+}
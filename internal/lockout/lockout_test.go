@@ -0,0 +1,85 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/store/memstore"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Minute},
+		{failures: 4, want: 2 * time.Minute},
+		{failures: 5, want: 4 * time.Minute},
+		{failures: 6, want: 8 * time.Minute},
+		{failures: 7, want: 10 * time.Minute},
+		{failures: 50, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, policy.Delay(tt.failures), "failures=%d", tt.failures)
+	}
+}
+
+func TestFailReportsFirstLockOnly(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(memstore.NewLoginFailureStore(memstore.New()))
+	guard.Account = Policy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	var reported []bool
+	for range 4 {
+		locked, err := guard.Fail(ctx, "a@example.com", "192.0.2.1")
+		require.NoError(t, err)
+		reported = append(reported, locked)
+	}
+	assert.Equal(t, []bool{false, true, false, false}, reported)
+
+	wait, err := guard.RetryAfter(ctx, "a@example.com", "192.0.2.2")
+	require.NoError(t, err)
+	assert.Greater(t, wait, 2*time.Minute, "later failures still extend the lock")
+
+	for range DefaultMFAPolicy.Threshold - 1 {
+		delay, err := guard.FailMFA(ctx, 1)
+		require.NoError(t, err)
+		assert.Zero(t, delay)
+	}
+	for _, want := range []time.Duration{5 * time.Minute, 10 * time.Minute} {
+		delay, err := guard.FailMFA(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, want, delay, "every locking code failure reports its delay")
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(memstore.NewLoginFailureStore(memstore.New()))
+	guard.Account.Threshold = 1
+	guard.IP.Threshold = 1
+	guard.MFA.Threshold = 1
+	_, err := guard.Fail(ctx, "a@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	_, err = guard.FailMFA(ctx, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, guard.Unlock(ctx, 1, "a@example.com"))
+	wait, err := guard.RetryAfter(ctx, "a@example.com", "192.0.2.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait, "the account lock is lifted")
+	wait, err = guard.MFARetryAfter(ctx, 1)
+	require.NoError(t, err)
+	assert.Zero(t, wait, "the second factor lock is lifted")
+	wait, err = guard.RetryAfter(ctx, "b@example.com", "192.0.2.1")
+	require.NoError(t, err)
+	assert.NotZero(t, wait, "the IP stays locked")
+}
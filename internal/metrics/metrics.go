@@ -0,0 +1,146 @@
+// Package metrics exposes Prometheus metrics about HTTP traffic, the
+// database pool, authentication and content creation
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "articles"
+
+// Login results used as the "result" label of the logins counter
+const (
+	LoginSuccess     = "success"
+	LoginFailure     = "failure"
+	LoginLocked      = "locked"
+	LoginMFARequired = "mfa_required"
+	LoginDisabled    = "disabled"
+)
+
+// Metrics holds every collector of the application. All recording methods
+// are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+	logins          *prometheus.CounterVec
+	tokensIssued    *prometheus.CounterVec
+	articlesCreated prometheus.Counter
+	reviewsCreated  prometheus.Counter
+}
+
+// New registers the collectors. pool is the Postgres pool and sqlDB the
+// SQLite handle, either may be nil to skip its statistics.
+func New(pool *pgxpool.Pool, sqlDB *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, chi route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and chi route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Tokens issued by scope.",
+		}, []string{"scope"}),
+		articlesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "articles_created_total",
+			Help:      "Articles created.",
+		}),
+		reviewsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reviews_created_total",
+			Help:      "Reviews created.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests, m.duration, m.logins, m.tokensIssued, m.articlesCreated, m.reviewsCreated,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if pool != nil {
+		m.registry.MustRegister(newPoolCollector(pool))
+	}
+	if sqlDB != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, "sqlite"))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests and measures their latency. Routes are
+// labelled by their chi pattern, like "/articles/{id}", to keep the
+// number of series bounded.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *Metrics) Login(result string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) TokenIssued(scope string) {
+	if m == nil {
+		return
+	}
+	m.tokensIssued.WithLabelValues(scope).Inc()
+}
+
+func (m *Metrics) ArticleCreated() {
+	if m == nil {
+		return
+	}
+	m.articlesCreated.Inc()
+}
+
+func (m *Metrics) ReviewCreated() {
+	if m == nil {
+		return
+	}
+	m.reviewsCreated.Inc()
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestMiddlewareLabelsRoutePattern(t *testing.T) {
+	m := New(nil, nil)
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/articles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.Method("GET", "/metrics", m.Handler())
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/articles/42", nil))
+	m.Login(LoginSuccess)
+	m.TokenIssued("authentication")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `articles_http_requests_total{method="GET",route="/articles/{id}",status="404"} 1`)
+	assert.Contains(t, string(body), `articles_logins_total{result="success"} 1`)
+	assert.Contains(t, string(body), `articles_tokens_issued_total{scope="authentication"} 1`)
+}
+
+func TestSQLiteStats(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+	m := New(nil, db)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `go_sql_max_open_connections{db_name="sqlite"} 3`)
+}
+
+func TestNilMetricsRecordsNothing(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.Login(LoginFailure)
+		m.TokenIssued("authentication")
+		m.ArticleCreated()
+		m.ReviewCreated()
+	})
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/makhammatovb/Articles/internal/logging"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// incoming request IDs are reused only if they look harmless
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID reuses the X-Request-ID header of the request or generates one,
+// echoes it in the response and stores it in the context for logging
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// accessInfo is filled in while the request travels down the chain,
+// the access log reads it once the handler returns
+type accessInfo struct {
+	userID int
+}
+
+type accessInfoKey struct{}
+
+// AccessLog writes one structured record per request with the method,
+// chi route pattern, status, latency and authenticated user ID
+func AccessLog(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			info := &accessInfo{}
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(context.WithValue(r.Context(), accessInfoKey{}, info))
+
+			next.ServeHTTP(ww, r)
+
+			// handlers that write nothing leave the implicit 200
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			attrs := []any{
+				"method", r.Method,
+				"route", route,
+				"status", status,
+				"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+				"bytes", ww.BytesWritten(),
+			}
+			if info.userID != 0 {
+				attrs = append(attrs, "user_id", info.userID)
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.Log(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// recordUser lets the access log know who made the request
+func recordUser(r *http.Request, userID int) {
+	if info, ok := r.Context().Value(accessInfoKey{}).(*accessInfo); ok {
+		info.userID = userID
+	}
+}
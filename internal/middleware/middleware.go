@@ -3,23 +3,37 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
 	"github.com/makhammatovb/Articles/internal/store"
 	"github.com/makhammatovb/Articles/internal/tokens"
-	"github.com/makhammatovb/Articles/internal/utils"
 )
 
 type UserMiddleware struct {
 	UserStore store.UserStore
+	// JWT is set when the server runs in signed token mode,
+	// nil means opaque tokens looked up in the database
+	JWT    *tokens.JWTManager
+	Logger *slog.Logger
 }
 
 type contextKey string
 
 const UserContextKey = contextKey("user")
 
+var tracer = otel.Tracer("github.com/makhammatovb/Articles/internal/middleware")
+
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	if !user.IsAnonymous() {
+		recordUser(r, user.ID)
+	}
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -42,21 +56,27 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid auth header format"})
+		// the span covers the token lookup only, not the handlers after it
+		ctx, span := tracer.Start(r.Context(), "UserMiddleware.Authenticate")
+		token, ok := BearerToken(r)
+		if !ok {
+			span.End()
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid auth header format"))
 			return
 		}
 
-		token := headerParts[1]
-		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
+		user, err := um.userForToken(ctx, token)
 		if err != nil {
-			fmt.Println("Error retrieving user by token:", err)
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "token lookup failed")
+			span.End()
+			um.Logger.ErrorContext(ctx, "error retrieving user by token", "error", err)
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid token"))
 			return
 		}
+		span.End()
 		if user == nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeInvalidToken, "invalid token"))
 			return
 		}
 
@@ -65,15 +85,73 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) (string, bool) {
+	headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return "", false
+	}
+	return headerParts[1], true
+}
+
+// userForToken resolves the user behind an auth token, signed tokens are
+// verified locally while opaque tokens need a database lookup.
+//
+// A signed token only yields the user ID, the rest of the account is not
+// loaded. The admin flag, the disabled flag, the email and the second factor
+// settings have to be read from the store by whoever needs them, as
+// RequireAdmin does. Disabling or erasing an account denies its tokens at once
+// on this replica and on the others after their next denylist sync.
+func (um *UserMiddleware) userForToken(ctx context.Context, token string) (*store.User, error) {
+	if um.JWT == nil {
+		return um.UserStore.GetUserToken(ctx, tokens.ScopeAuth, token)
+	}
+	claims, err := um.JWT.Verify(token, tokens.ScopeAuth)
+	if err != nil {
+		return nil, nil
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil
+	}
+	return &store.User{ID: userID}, nil
+}
+
 func (um *UserMiddleware) RequireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user, err := GetUser(r)
 		if err != nil {
-			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			apierr.Write(w, r, apierr.Internal())
 			return
 		}
 		if user.IsAnonymous() {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be authenticated to access this resource"})
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeUnauthenticated, "you must be authenticated to access this resource"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin lets only administrators through. The flag is read from the
+// database so it takes effect immediately, even for signed tokens.
+func (um *UserMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := GetUser(r)
+		if err != nil {
+			apierr.Write(w, r, apierr.Internal())
+			return
+		}
+		if user.IsAnonymous() {
+			apierr.Write(w, r, apierr.Unauthorized(apierr.CodeUnauthenticated, "you must be authenticated to access this resource"))
+			return
+		}
+		current, err := um.UserStore.GetUserByID(r.Context(), int64(user.ID))
+		if err != nil {
+			apierr.Write(w, r, apierr.Internal())
+			return
+		}
+		if current == nil || !current.IsAdmin {
+			apierr.Write(w, r, apierr.Forbidden("you must be an administrator to access this resource"))
 			return
 		}
 		next.ServeHTTP(w, r)
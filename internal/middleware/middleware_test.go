@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/logging"
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/store/memstore"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+type fixture struct {
+	middleware UserMiddleware
+	tokens     *memstore.TokenStore
+	user       *store.User
+	admin      *store.User
+	token      string
+	adminToken string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	db := memstore.New()
+	users := memstore.NewUserStore(db, passwords.DefaultHasher)
+	tokenStore := memstore.NewTokenStore(db)
+
+	f := &fixture{
+		middleware: UserMiddleware{UserStore: users, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+		tokens:     tokenStore,
+		user:       &store.User{Email: "john@example.com"},
+		admin:      &store.User{Email: "admin@example.com", IsAdmin: true},
+	}
+	require.NoError(t, users.CreateUser(ctx, f.user))
+	require.NoError(t, users.CreateUser(ctx, f.admin))
+	token, err := tokenStore.CreateNewToken(ctx, int64(f.user.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	f.token = token.PlainText
+	token, err = tokenStore.CreateNewToken(ctx, int64(f.admin.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	f.adminToken = token.PlainText
+	return f
+}
+
+// whoAmI answers with the ID of the user in the context, 0 for anonymous
+var whoAmI = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	user, err := GetUser(r)
+	if err != nil {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"id": user.ID})
+})
+
+func serve(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticate(t *testing.T) {
+	f := newFixture(t)
+	expired, err := f.tokens.CreateNewToken(context.Background(), int64(f.user.ID), -time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantID        int
+	}{
+		{name: "no header is anonymous", wantStatus: http.StatusOK, wantID: 0},
+		{name: "valid token", authorization: "Bearer " + f.token, wantStatus: http.StatusOK, wantID: f.user.ID},
+		{name: "not a bearer token", authorization: "Basic " + f.token, wantStatus: http.StatusUnauthorized},
+		{name: "missing token", authorization: "Bearer", wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", authorization: "Bearer unknown", wantStatus: http.StatusUnauthorized},
+		{name: "expired token", authorization: "Bearer " + expired.PlainText, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(f.middleware.Authenticate(whoAmI), tt.authorization)
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			assert.Equal(t, "Authorization", rec.Header().Get("Vary"))
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body map[string]int
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantID, body["id"])
+		})
+	}
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	f := newFixture(t)
+	keyring, err := tokens.LoadKeyring(t.TempDir())
+	require.NoError(t, err)
+	f.middleware.JWT = tokens.NewJWTManager(keyring, tokens.NewMemoryDenylist())
+	signed, err := f.middleware.JWT.Issue(int64(f.user.ID), f.user.Email, time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	reset, err := f.middleware.JWT.Issue(int64(f.user.ID), f.user.Email, time.Hour, tokens.ScopeResetPassword)
+	require.NoError(t, err)
+
+	rec := serve(f.middleware.Authenticate(whoAmI), "Bearer "+signed.PlainText)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":`+strconv.Itoa(f.user.ID)+`}`, rec.Body.String())
+
+	rec = serve(f.middleware.Authenticate(whoAmI), "Bearer "+reset.PlainText)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "tokens of other scopes are rejected")
+	rec = serve(f.middleware.Authenticate(whoAmI), "Bearer "+f.token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "opaque tokens are rejected in jwt mode")
+}
+
+func TestRequireAuthenticatedUser(t *testing.T) {
+	f := newFixture(t)
+	handler := f.middleware.Authenticate(f.middleware.RequireAuthenticatedUser(whoAmI))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(handler, "").Code)
+	assert.Equal(t, http.StatusOK, serve(handler, "Bearer "+f.token).Code)
+	assert.Equal(t, http.StatusInternalServerError, serve(f.middleware.RequireAuthenticatedUser(whoAmI), "").Code,
+		"no user in the context means Authenticate did not run")
+}
+
+func TestRequireAdmin(t *testing.T) {
+	f := newFixture(t)
+	handler := f.middleware.Authenticate(f.middleware.RequireAdmin(whoAmI))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "anonymous", wantStatus: http.StatusUnauthorized},
+		{name: "user", authorization: "Bearer " + f.token, wantStatus: http.StatusForbidden},
+		{name: "admin", authorization: "Bearer " + f.adminToken, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantStatus, serve(handler, tt.authorization).Code)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{name: "generated", incoming: "", reused: false},
+		{name: "reused", incoming: "abc-123", reused: true},
+		{name: "unsafe value replaced", incoming: "abc\n123", reused: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, tt.incoming)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			assert.NotEmpty(t, id)
+			assert.Equal(t, id, seen)
+			assert.Equal(t, tt.reused, id == tt.incoming)
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	f := newFixture(t)
+	var buf bytes.Buffer
+	r := chi.NewRouter()
+	r.Use(AccessLog(logging.New(&buf, slog.LevelInfo)))
+	r.Use(f.middleware.Authenticate)
+	r.Get("/articles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/articles/7", nil)
+	req.Header.Set("Authorization", "Bearer "+f.token)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "/articles/{id}", record["route"])
+	assert.Equal(t, float64(http.StatusAccepted), record["status"])
+	assert.Equal(t, float64(f.user.ID), record["user_id"])
+	assert.NotContains(t, buf.String(), f.token)
+}
+
+func TestAccessLogKeepsFlusher(t *testing.T) {
+	var buf bytes.Buffer
+	handler := AccessLog(logging.New(&buf, slog.LevelInfo))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok, "streaming handlers can flush through the access log")
+		_, _ = io.WriteString(w, "chunk")
+		flusher.Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.True(t, rec.Flushed)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, float64(http.StatusOK), record["status"])
+	assert.Equal(t, float64(len("chunk")), record["bytes"])
+}
@@ -0,0 +1,20 @@
+// Package notify sends security notices to users
+package notify
+
+import "log/slog"
+
+// Notifier delivers a message to the owner of an email address
+type Notifier interface {
+	Notify(email, subject, body string) error
+}
+
+// LogNotifier writes notifications to the application log, it is used
+// until a real mail transport is configured
+type LogNotifier struct {
+	Logger *slog.Logger
+}
+
+func (n *LogNotifier) Notify(email, subject, body string) error {
+	n.Logger.Info("notification", "to", email, "subject", subject, "body", body)
+	return nil
+}
@@ -0,0 +1,85 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachedList holds SHA-1 hashes of leaked passwords grouped by their
+// five character prefix, the same layout the Have I Been Pwned range API uses
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+	size   int
+}
+
+// LoadBreachedList reads a file with one upper- or lowercase hex SHA-1 hash
+// per line, optionally followed by ":<count>" as in the pwned passwords dumps
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("breached passwords: open %w", err)
+	}
+	defer file.Close()
+
+	list := &BreachedList{ranges: map[string]map[string]struct{}{}}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("breached passwords: line %d: not a sha1 hash", line)
+		}
+		_, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, fmt.Errorf("breached passwords: line %d: %w", line, err)
+		}
+		list.add(hash)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("breached passwords: read %w", err)
+	}
+	return list, nil
+}
+
+func (l *BreachedList) add(hash string) {
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+	bucket, ok := l.ranges[prefix]
+	if !ok {
+		bucket = map[string]struct{}{}
+		l.ranges[prefix] = bucket
+	}
+	if _, ok := bucket[suffix]; !ok {
+		bucket[suffix] = struct{}{}
+		l.size++
+	}
+}
+
+// Len returns the number of hashes in the list
+func (l *BreachedList) Len() int {
+	return l.size
+}
+
+// Contains reports whether the password is in the list
+func (l *BreachedList) Contains(plaintextPassword string) bool {
+	sum := sha1.Sum([]byte(plaintextPassword))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	bucket, ok := l.ranges[hash[:prefixLength]]
+	if !ok {
+		return false
+	}
+	_, ok = bucket[hash[prefixLength:]]
+	return ok
+}
@@ -0,0 +1,209 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Upper bounds of the argon2id parameters. Stored hashes describe their own
+// cost, so a crafted or imported hash must not make a login allocate
+// gigabytes or run for minutes.
+const (
+	maxArgon2Memory      = 1024 * 1024 // 1 GiB
+	maxArgon2Iterations  = 64
+	maxArgon2Parallelism = 64
+	maxArgon2SaltLength  = 64
+	maxArgon2KeyLength   = 128
+)
+
+// Argon2Params are the argon2id cost settings, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher creates new password hashes with one algorithm and verifies
+// hashes of every supported algorithm. Hashes are self-describing:
+// bcrypt ones start with "$2", argon2id ones use the PHC string format
+// "$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>".
+type Hasher struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+var DefaultHasher = Hasher{
+	Algorithm:  AlgorithmArgon2id,
+	BcryptCost: 12,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+}
+
+// Validate reports settings that would produce weak or unusable hashes
+func (h Hasher) Validate() error {
+	switch h.Algorithm {
+	case AlgorithmBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		p := h.Argon2
+		if p.Memory < 8*1024 || p.Iterations < 1 || p.Parallelism < 1 || p.SaltLength < 8 || p.KeyLength < 16 {
+			return errors.New("argon2id parameters are too weak")
+		}
+		// hashes made with larger ones would not verify
+		err := p.checkLimits()
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", h.Algorithm)
+	}
+	return nil
+}
+
+// Hash hashes the password with the configured algorithm and parameters
+func (h Hasher) Hash(plaintextPassword string) ([]byte, error) {
+	if h.Algorithm == AlgorithmBcrypt {
+		return bcrypt.GenerateFromPassword([]byte(plaintextPassword), h.BcryptCost)
+	}
+	p := h.Argon2
+	salt := make([]byte, p.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(plaintextPassword), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+// Verify checks the password against a hash of any supported algorithm,
+// the settings of h don't matter
+func (h Hasher) Verify(hash []byte, plaintextPassword string) (bool, error) {
+	return Verify(hash, plaintextPassword)
+}
+
+// Verify checks the password against a hash of any supported algorithm, the
+// hash describes how it was made
+func Verify(hash []byte, plaintextPassword string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword(hash, []byte(plaintextPassword))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(plaintextPassword), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// weaker parameters than the current ones
+func (h Hasher) NeedsRehash(hash []byte) bool {
+	if isBcrypt(hash) {
+		if h.Algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost(hash)
+		return err != nil || cost != h.BcryptCost
+	}
+	if h.Algorithm != AlgorithmArgon2id {
+		return true
+	}
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+	p := h.Argon2
+	return params.Memory != p.Memory || params.Iterations != p.Iterations || params.Parallelism != p.Parallelism ||
+		uint32(len(salt)) != p.SaltLength || uint32(len(key)) != p.KeyLength
+}
+
+// checkLimits reports parameters above the upper bounds, or below what
+// argon2id itself requires
+func (p Argon2Params) checkLimits() error {
+	switch {
+	case p.Memory > maxArgon2Memory:
+		return fmt.Errorf("argon2id memory must be at most %d KiB", maxArgon2Memory)
+	case p.Iterations < 1 || p.Iterations > maxArgon2Iterations:
+		return fmt.Errorf("argon2id iterations must be between 1 and %d", maxArgon2Iterations)
+	case p.Parallelism < 1 || p.Parallelism > maxArgon2Parallelism:
+		return fmt.Errorf("argon2id parallelism must be between 1 and %d", maxArgon2Parallelism)
+	case p.Memory < 8*uint32(p.Parallelism):
+		return errors.New("argon2id memory must be at least 8 KiB per lane")
+	case p.SaltLength < 8 || p.SaltLength > maxArgon2SaltLength:
+		return fmt.Errorf("argon2id salt must be between 8 and %d bytes", maxArgon2SaltLength)
+	case p.KeyLength < 4 || p.KeyLength > maxArgon2KeyLength:
+		return fmt.Errorf("argon2id key must be between 4 and %d bytes", maxArgon2KeyLength)
+	}
+	return nil
+}
+
+func isBcrypt(hash []byte) bool {
+	return strings.HasPrefix(string(hash), "$2")
+}
+
+func decodeArgon2(hash []byte) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHashFormat)
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	err = params.checkLimits()
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHashFormat, err)
+	}
+	return params, salt, key, nil
+}
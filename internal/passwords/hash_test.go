@@ -0,0 +1,79 @@
+package passwords
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasher(t *testing.T) {
+	argon := DefaultHasher
+	argon.Argon2.Memory = 8 * 1024
+	argon.Argon2.Iterations = 1
+	bcryptHasher := Hasher{Algorithm: AlgorithmBcrypt, BcryptCost: 4}
+	require.NoError(t, argon.Validate())
+	require.NoError(t, bcryptHasher.Validate())
+
+	for _, hasher := range []Hasher{argon, bcryptHasher} {
+		t.Run(hasher.Algorithm, func(t *testing.T) {
+			hash, err := hasher.Hash("s3cret-Pass")
+			require.NoError(t, err)
+
+			ok, err := hasher.Verify(hash, "s3cret-Pass")
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = hasher.Verify(hash, "wrong")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.False(t, hasher.NeedsRehash(hash))
+		})
+	}
+
+	// old bcrypt hashes still verify under argon2id and are flagged for rehashing
+	oldHash, err := bcryptHasher.Hash("s3cret-Pass")
+	require.NoError(t, err)
+	ok, err := argon.Verify(oldHash, "s3cret-Pass")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, argon.NeedsRehash(oldHash))
+
+	// raising the cost asks for a rehash too
+	stronger := argon
+	stronger.Argon2.Iterations = 2
+	newHash, err := argon.Hash("s3cret-Pass")
+	require.NoError(t, err)
+	assert.True(t, stronger.NeedsRehash(newHash))
+
+	_, err = argon.Verify([]byte("plain"), "plain")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+
+	tooStrong := argon
+	tooStrong.Argon2.Memory = 2 * maxArgon2Memory
+	assert.Error(t, tooStrong.Validate())
+}
+
+func TestVerifyRejectsCostlyHashes(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{name: "huge memory", params: "m=4194304,t=1,p=1"},
+		{name: "many iterations", params: "m=8192,t=100000,p=1"},
+		{name: "no lanes", params: "m=8192,t=1,p=0"},
+		{name: "no iterations", params: "m=8192,t=0,p=1"},
+		{name: "too little memory per lane", params: "m=8,t=1,p=4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := "$argon2id$v=19$" + tt.params + "$" + salt + "$" + key
+			_, err := Verify([]byte(hash), "s3cret-Pass")
+			assert.ErrorIs(t, err, ErrUnknownHashFormat)
+			assert.True(t, DefaultHasher.NeedsRehash([]byte(hash)))
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package passwords decides which passwords users are allowed to choose
+package passwords
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// History reports whether a user had the password recently,
+// store.UserStore implements it
+type History interface {
+	PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (bool, error)
+}
+
+// Policy lists the rules every new password has to follow
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// HistorySize is how many of the latest passwords, the current one
+	// included, cannot be reused. 0 disables the check.
+	HistorySize int
+	// DisallowEmail rejects passwords containing the email or its local part
+	DisallowEmail bool
+	// Breached is an optional list of leaked passwords
+	Breached *BreachedList
+}
+
+var DefaultPolicy = Policy{
+	MinLength:     8,
+	MaxLength:     72,
+	RequireLower:  true,
+	RequireUpper:  true,
+	RequireDigit:  true,
+	HistorySize:   5,
+	DisallowEmail: true,
+}
+
+// Violations is returned when a password breaks one or more rules
+type Violations []string
+
+func (v Violations) Error() string {
+	return "password " + strings.Join(v, ", ")
+}
+
+// Check validates a new password for the user with the given email.
+// userID is 0 for accounts that do not exist yet, which skips the reuse check.
+func (p Policy) Check(ctx context.Context, plaintextPassword, email string, userID int64, history History) error {
+	var violations Violations
+	if len(plaintextPassword) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	// bcrypt ignores everything after 72 bytes
+	if p.MaxLength > 0 && len(plaintextPassword) > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range plaintextPassword {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.DisallowEmail && containsEmail(plaintextPassword, email) {
+		violations = append(violations, "must not contain your email")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(plaintextPassword) {
+		violations = append(violations, "has appeared in a data breach, choose another one")
+	}
+
+	if len(violations) > 0 {
+		return violations
+	}
+
+	if p.HistorySize > 0 && userID != 0 && history != nil {
+		used, err := history.PasswordUsedRecently(ctx, userID, plaintextPassword, p.HistorySize)
+		if err != nil {
+			return err
+		}
+		if used {
+			return Violations{fmt.Sprintf("must not be one of your last %d passwords", p.HistorySize)}
+		}
+	}
+	return nil
+}
+
+func containsEmail(plaintextPassword, email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	lower := strings.ToLower(plaintextPassword)
+	if strings.Contains(lower, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	// very short local parts like "jo" would reject too many passwords
+	return len(local) >= 3 && strings.Contains(lower, local)
+}
@@ -0,0 +1,59 @@
+package passwords
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHistory map[string]bool
+
+func (h fakeHistory) PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (bool, error) {
+	return h[plaintextPassword], nil
+}
+
+func TestPolicyCheck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "breached.txt")
+	// sha1 of "Password123"
+	err := os.WriteFile(path, []byte("b2e98ad6f6eb8508dd6a14cfa704bad7f05f6fb1:12345\n"), 0o600)
+	require.NoError(t, err)
+	breached, err := LoadBreachedList(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, breached.Len())
+
+	policy := DefaultPolicy
+	policy.Breached = breached
+	history := fakeHistory{"OldSecret99": true}
+
+	tests := []struct {
+		name     string
+		password string
+		userID   int64
+		wantErr  bool
+	}{
+		{name: "valid", password: "Tr1cky-Horse", userID: 1},
+		{name: "too short", password: "Ab1", wantErr: true},
+		{name: "no uppercase", password: "lowercase123", wantErr: true},
+		{name: "no digit", password: "NoDigitsHere", wantErr: true},
+		{name: "contains email", password: "Johnny2024!", wantErr: true},
+		{name: "breached", password: "Password123", wantErr: true},
+		{name: "reused", password: "OldSecret99", userID: 1, wantErr: true},
+		{name: "reuse ignored for new accounts", password: "OldSecret99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(context.Background(), tt.password, "johnny@example.com", tt.userID, history)
+			if tt.wantErr {
+				var violations Violations
+				assert.ErrorAs(t, err, &violations)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
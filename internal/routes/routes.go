@@ -2,41 +2,68 @@ package routes
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/makhammatovb/Articles/internal/apierr"
 	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/middleware"
+	"github.com/makhammatovb/Articles/internal/tracing"
 )
 
 // SetupRoutes sets up the routes for the application using chi router
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	r.NotFound(apierr.NotFoundHandler)
+	r.MethodNotAllowed(apierr.MethodNotAllowedHandler)
+	r.Use(tracing.Middleware)
+	r.Use(middleware.RequestID)
+	r.Use(middleware.AccessLog(app.Logger))
+	r.Use(app.Metrics.Middleware)
 	r.Use(app.Middleware.Authenticate)
 
-	r.Group(func(r chi.Router){
+	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.RequireAuthenticatedUser)
 
 		r.Post("/articles/", app.ArticleHandler.HandleCreateArticle)        // checked
 		r.Put("/articles/{id}/", app.ArticleHandler.HandleUpdateArticle)    // checked
 		r.Delete("/articles/{id}/", app.ArticleHandler.HandleDeleteArticle) // checked
 
-		r.Put("/users/{id}/", app.UserHandler.HandleUpdateUser)    // checked
-		r.Delete("/users/{id}/", app.UserHandler.HandleDeleteUser) // checked
+		r.Put("/users/{id}/", app.UserHandler.HandleUpdateUser)                      // checked
+		r.Delete("/users/{id}/", app.PrivacyHandler.HandleDeleteUser)                // checked
 		r.Post("/users/{id}/password-change/", app.UserHandler.HandleUpdatePassword) // checked
-		r.Get("/users/{id}", app.UserHandler.HandleGetUserByID)    // checked
+		r.Get("/users/{id}", app.UserHandler.HandleGetUserByID)                      // checked
+		r.Get("/users/{id}/export/", app.PrivacyHandler.HandleExportUserData)
+		r.Get("/users/{id}/erasure/", app.PrivacyHandler.HandleGetErasure)
+		r.Delete("/users/{id}/erasure/", app.PrivacyHandler.HandleCancelErasure)
 
 		//reviews
 		r.Post("/reviews/", app.ReviewHandler.HandleCreateReview)        // checked
 		r.Put("/reviews/{id}/", app.ReviewHandler.HandleUpdateReview)    // checked
 		r.Delete("/reviews/{id}/", app.ReviewHandler.HandleDeleteReview) // checked
 
-		
+		// tokens
+		r.Delete("/tokens/", app.TokenHandler.HandleRevokeToken)
+
+		// two-factor authentication
+		r.Post("/users/totp/", app.MFAHandler.HandleEnrollTOTP)
+		r.Post("/users/totp/confirm/", app.MFAHandler.HandleConfirmTOTP)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(app.Middleware.RequireAdmin)
+
+		r.Post("/admin/users/{id}/unlock/", app.AdminHandler.HandleUnlockUser)
+
 	})
 	// articles
-	r.Get("/health", app.HealthCheck)                                   // checked
+	r.Get("/health", app.HealthCheck) // checked
+	r.Get("/healthz", app.HealthCheck)
+	r.Get("/readyz", app.ReadinessCheck)
+	r.Method("GET", "/metrics", app.Metrics.Handler())
 	// users
-	r.Post("/users/", app.UserHandler.HandleRegisterUser)      			// checked
+	r.Post("/users/", app.UserHandler.HandleRegisterUser) // checked
 
-	r.Get("/articles/{id}", app.ArticleHandler.HandleGetArticleByID)    // checked
+	r.Get("/articles/{id}", app.ArticleHandler.HandleGetArticleByID) // checked
 
-	r.Get("/reviews/{id}", app.ReviewHandler.HandleGetReviewByID)    // checked
+	r.Get("/reviews/{id}", app.ReviewHandler.HandleGetReviewByID) // checked
 
 	// users password update
 	r.Post("/users/reset-password-request/", app.TokenHandler.GenerateResetPasswordToken)
@@ -44,5 +71,6 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 
 	// tokens
 	r.Post("/tokens/", app.TokenHandler.HandleCreateToken)
+	r.Post("/tokens/mfa/", app.TokenHandler.HandleVerifyMFA)
 	return r
 }
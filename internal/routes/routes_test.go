@@ -0,0 +1,77 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apitest"
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+func TestProbes(t *testing.T) {
+	srv := apitest.NewServer(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "health", path: "/health", wantStatus: http.StatusOK, wantBody: "alive"},
+		{name: "liveness", path: "/healthz", wantStatus: http.StatusOK, wantBody: "alive"},
+		{name: "readiness", path: "/readyz", wantStatus: http.StatusOK, wantBody: "ready"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := srv.Do(http.MethodGet, tt.path, "", nil)
+			assert.Equal(t, tt.wantStatus, res.Status)
+			assert.Equal(t, tt.wantBody, res.String("status"))
+		})
+	}
+
+	srv.App.BeginShutdown()
+	res := srv.Do(http.MethodGet, "/readyz", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Status)
+	assert.Equal(t, "draining", res.String("checks", "shutdown", "status"))
+}
+
+func TestReadinessHidesDatabaseErrors(t *testing.T) {
+	srv := apitest.NewServer(t)
+	// a database that was never migrated fails the schema version query
+	db, err := store.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "articles.db"), 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	srv.App.DB = &store.Database{Driver: store.DriverSQLite, SQL: db}
+
+	res := srv.Do(http.MethodGet, "/readyz", "", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Status)
+	assert.Equal(t, "error", res.String("checks", "database", "status"))
+	assert.Equal(t, "database unavailable", res.String("checks", "database", "error"))
+	assert.NotContains(t, string(res.Raw), "goose_db_version")
+}
+
+func TestMetrics(t *testing.T) {
+	srv := apitest.NewServer(t)
+	srv.Do(http.MethodGet, "/articles/1", "", nil)
+
+	res := srv.Do(http.MethodGet, "/metrics", "", nil)
+	assert.Equal(t, http.StatusOK, res.Status)
+	assert.Contains(t, string(res.Raw), `articles_http_requests_total{method="GET",route="/articles/{id}",status="404"} 1`)
+}
+
+func TestUnknownRoute(t *testing.T) {
+	srv := apitest.NewServer(t)
+	res := srv.Do(http.MethodGet, "/nowhere", "", nil)
+	assert.Equal(t, http.StatusNotFound, res.Status)
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "not_found", res.String("code"))
+	assert.Equal(t, "/nowhere", res.String("instance"))
+	res = srv.Do(http.MethodPatch, "/articles/1", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Status)
+	assert.Equal(t, "method_not_allowed", res.String("code"))
+}
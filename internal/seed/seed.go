@@ -0,0 +1,319 @@
+// Package seed fills a database with generated users, articles and reviews
+// for development and load testing. Every record is generated from the seed
+// value and its position, so the same options always produce the same data
+// whatever order the workers insert it in.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type Options struct {
+	// Seed selects the generated data
+	Seed     uint64
+	Users    int
+	Articles int
+	// ReviewsPerArticle is the average number of reviews of an article, a
+	// few popular articles get many more than most
+	ReviewsPerArticle float64
+	// BatchSize is how many users or articles are inserted with one store
+	// call, in one transaction
+	BatchSize int
+	// Workers is how many batches are inserted at the same time
+	Workers int
+	// Password is the password of every generated user, it is hashed once
+	// with Hasher
+	Password string
+	Hasher   passwords.Hasher
+	// Progress is called after every batch with the number of records
+	// inserted so far, it may be nil
+	Progress func(kind string, done, total int)
+}
+
+type Stores struct {
+	Users    store.UserStore
+	Articles store.ArticleStore
+	Reviews  store.ReviewStore
+}
+
+// Result counts the inserted records
+type Result struct {
+	Users      int
+	Articles   int
+	Paragraphs int
+	Reviews    int
+}
+
+// kinds of generated records, they keep the random streams of a user and
+// an article with the same index apart
+const (
+	kindUser uint64 = iota + 1
+	kindArticle
+)
+
+func newRand(seed, kind uint64, index int) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, kind<<56|uint64(index)))
+}
+
+// Run generates and inserts the records, users first so articles and
+// reviews can refer to them
+func Run(ctx context.Context, stores Stores, opts Options) (*Result, error) {
+	if opts.Users <= 0 {
+		return nil, errors.New("seed: at least one user is required")
+	}
+	if opts.Articles < 0 || opts.ReviewsPerArticle < 0 {
+		return nil, errors.New("seed: articles and reviews must not be negative")
+	}
+	err := opts.Hasher.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("seed: %w", err)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	// hashing is by far the slowest part, every user gets a copy of one hash
+	var template store.User
+	err = template.PasswordHash.Set(opts.Hasher, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]int, opts.Users)
+	err = inBatches(ctx, "users", opts.Users, opts, func(ctx context.Context, start, end int) error {
+		users := make([]*store.User, 0, end-start)
+		for i := start; i < end; i++ {
+			user := generateUser(newRand(opts.Seed, kindUser, i), i)
+			user.PasswordHash = template.PasswordHash
+			users = append(users, user)
+		}
+		err := stores.Users.CreateUsers(ctx, users)
+		if err != nil {
+			return err
+		}
+		for i, user := range users {
+			userIDs[start+i] = user.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var paragraphs, reviews atomic.Int64
+	err = inBatches(ctx, "articles", opts.Articles, opts, func(ctx context.Context, start, end int) error {
+		articles := make([]*store.Article, 0, end-start)
+		rands := make([]*rand.Rand, 0, end-start)
+		authors := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			r := newRand(opts.Seed, kindArticle, i)
+			author := pickAuthor(r, opts.Users)
+			articles = append(articles, generateArticle(r, i, userIDs[author]))
+			rands = append(rands, r)
+			authors = append(authors, author)
+		}
+		err := stores.Articles.CreateArticles(ctx, articles)
+		if err != nil {
+			return err
+		}
+		// reviews continue the random stream of their article, they need
+		// its ID so they are generated once the articles are in
+		var batch []*store.Review
+		for i, article := range articles {
+			paragraphs.Add(int64(len(article.Paraghraps)))
+			batch = append(batch, generateReviews(rands[i], opts, authors[i], article.ID, userIDs)...)
+		}
+		err = stores.Reviews.CreateReviews(ctx, batch)
+		if err != nil {
+			return err
+		}
+		reviews.Add(int64(len(batch)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Users:      opts.Users,
+		Articles:   opts.Articles,
+		Paragraphs: int(paragraphs.Load()),
+		Reviews:    int(reviews.Load()),
+	}, nil
+}
+
+// inBatches splits the indexes below total into batches of opts.BatchSize
+// and calls insert once per batch, up to opts.Workers batches at a time.
+// Progress is reported after every batch.
+func inBatches(ctx context.Context, kind string, total int, opts Options, insert func(ctx context.Context, start, end int) error) error {
+	batches := (total + opts.BatchSize - 1) / opts.BatchSize
+	var mu sync.Mutex
+	done := 0
+	err := runWorkers(ctx, batches, opts.Workers, func(ctx context.Context, batch int) error {
+		start := batch * opts.BatchSize
+		end := min(start+opts.BatchSize, total)
+		err := insert(ctx, start, end)
+		if err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			done += end - start
+			opts.Progress(kind, done, total)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("seed %s: %w", kind, err)
+	}
+	return nil
+}
+
+// runWorkers calls fn for every index below count, stops handing out
+// indexes after the first error and returns it
+func runWorkers(ctx context.Context, count, workers int, fn func(ctx context.Context, i int) error) error {
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := fn(workCtx, i)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for i := 0; i < count; i++ {
+		select {
+		case indexes <- i:
+		case <-workCtx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	err := <-errs
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// pickAuthor favors the first users, a few prolific authors write most
+// articles like on a real site
+func pickAuthor(r *rand.Rand, users int) int {
+	return int(float64(users) * math.Pow(r.Float64(), 2))
+}
+
+func generateUser(r *rand.Rand, index int) *store.User {
+	first := pick(r, firstNames)
+	last := pick(r, lastNames)
+	return &store.User{
+		// the index keeps emails unique
+		Email:     fmt.Sprintf("%s.%s.%d@example.com", lower(first), lower(last), index+1),
+		FirstName: first,
+		LastName:  last,
+	}
+}
+
+func generateArticle(r *rand.Rand, index, authorID int) *store.Article {
+	article := &store.Article{
+		Title:    title(r),
+		AuthorID: authorID,
+	}
+	if r.Float64() < 0.8 {
+		article.Description = sentence(r, 10, 22)
+	}
+	if r.Float64() < 0.6 {
+		article.Image = fmt.Sprintf("https://images.example.com/articles/%d.jpg", index+1)
+	}
+	// mostly a handful of paragraphs, sometimes one, sometimes a long read
+	count := 1 + r.IntN(3) + r.IntN(4) + r.IntN(6)
+	for i := 0; i < count; i++ {
+		article.Paraghraps = append(article.Paraghraps, store.Paraghraph{
+			Headline:   headline(r),
+			Body:       paragraph(r),
+			OrderIndex: i + 1,
+		})
+	}
+	return article
+}
+
+// generateReviews gives every article a quality its ratings cluster around,
+// most articles are liked and some are disliked, which ends up as the usual
+// J-shaped distribution with a peak at five stars and a bump at one
+func generateReviews(r *rand.Rand, opts Options, author, articleID int, userIDs []int) []*store.Review {
+	quality := 3.8 + 1.4*r.Float64()
+	if r.Float64() < 0.15 {
+		quality = 0.5 + 1.5*r.Float64()
+	}
+	count := int(r.ExpFloat64() * opts.ReviewsPerArticle)
+	reviewers := pickReviewers(r, count, author, len(userIDs))
+	reviews := make([]*store.Review, 0, len(reviewers))
+	for _, reviewer := range reviewers {
+		stars := int(math.Round(quality + 0.9*r.NormFloat64()))
+		stars = max(1, min(5, stars))
+		review := &store.Review{
+			ArticleID: int64(articleID),
+			AuthorID:  int64(userIDs[reviewer]),
+			Stars:     stars,
+		}
+		if r.Float64() < 0.6 {
+			note := reviewNote(r, stars)
+			review.Note = &note
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews
+}
+
+// pickReviewers returns up to count distinct users other than the author,
+// everyone reviews an article at most once
+func pickReviewers(r *rand.Rand, count, author, users int) []int {
+	count = min(count, users-1)
+	if count <= 0 {
+		return nil
+	}
+	reviewers := make([]int, 0, count)
+	seen := map[int]bool{author: true}
+	if count > users/2 {
+		for _, user := range r.Perm(users) {
+			if len(reviewers) == count {
+				break
+			}
+			if !seen[user] {
+				reviewers = append(reviewers, user)
+			}
+		}
+		return reviewers
+	}
+	for len(reviewers) < count {
+		user := r.IntN(users)
+		if !seen[user] {
+			seen[user] = true
+			reviewers = append(reviewers, user)
+		}
+	}
+	return reviewers
+}
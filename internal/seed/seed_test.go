@@ -0,0 +1,136 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store/memstore"
+)
+
+// fastHasher is the cheapest hash, it keeps the tests fast
+var fastHasher = passwords.Hasher{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 4}
+
+func newStores(t *testing.T) Stores {
+	t.Helper()
+	db := memstore.New()
+	return Stores{
+		Users:    memstore.NewUserStore(db, fastHasher),
+		Articles: memstore.NewArticleStore(db),
+		Reviews:  memstore.NewReviewStore(db),
+	}
+}
+
+// snapshot describes the seeded data without IDs, which depend on the
+// order the workers inserted it in
+func snapshot(t *testing.T, stores Stores, articles int) []string {
+	t.Helper()
+	ctx := context.Background()
+	users, err := stores.Users.ListUsers(ctx)
+	require.NoError(t, err)
+	emails := map[int]string{}
+	var lines []string
+	for _, user := range users {
+		emails[user.ID] = user.Email
+		lines = append(lines, "user "+user.Email)
+	}
+	for id := 1; id <= articles; id++ {
+		article, err := stores.Articles.GetArticleByID(ctx, int64(id))
+		require.NoError(t, err)
+		require.NotNil(t, article)
+		lines = append(lines, fmt.Sprintf("article %s by %s with %d paragraphs", article.Title, emails[article.AuthorID], len(article.Paraghraps)))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	stores := newStores(t)
+	var progress []string
+	opts := Options{
+		Seed: 42, Users: 30, Articles: 40, ReviewsPerArticle: 4, BatchSize: 16, Workers: 4, Password: "Secret123", Hasher: fastHasher,
+		// batches finish in any order, only the running total is reported
+		Progress: func(kind string, done, total int) { progress = append(progress, fmt.Sprintf("%s %d", kind, done)) },
+	}
+	result, err := Run(ctx, stores, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 30, result.Users)
+	assert.Equal(t, 40, result.Articles)
+	assert.Greater(t, result.Paragraphs, 40)
+	assert.Greater(t, result.Reviews, 0)
+	require.Len(t, progress, 5, "one report per batch")
+	assert.Equal(t, "users 30", progress[1])
+	assert.Equal(t, "articles 40", progress[4])
+
+	user, err := stores.Users.GetUserWithPasswordByID(ctx, 1)
+	require.NoError(t, err)
+	matches, err := user.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	reviews := 0
+	for articleID := int64(1); articleID <= 40; articleID++ {
+		authorID, err := stores.Articles.GetArticleAuthorID(ctx, articleID)
+		require.NoError(t, err)
+		for userID := int64(1); userID <= 30; userID++ {
+			review, err := stores.Reviews.GetReviewByUserAndArticle(ctx, userID, articleID)
+			require.NoError(t, err)
+			if review == nil {
+				continue
+			}
+			reviews++
+			assert.NotEqual(t, authorID, userID, "authors don't review their own articles")
+			assert.True(t, review.Stars >= 1 && review.Stars <= 5)
+		}
+	}
+	assert.Equal(t, result.Reviews, reviews)
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	opts := Options{Seed: 7, Users: 20, Articles: 25, ReviewsPerArticle: 3, BatchSize: 10, Password: "Secret123", Hasher: fastHasher}
+
+	serial := newStores(t)
+	_, err := Run(ctx, serial, opts)
+	require.NoError(t, err)
+	opts.Workers = 5
+	concurrent := newStores(t)
+	_, err = Run(ctx, concurrent, opts)
+	require.NoError(t, err)
+	assert.Equal(t, snapshot(t, serial, 25), snapshot(t, concurrent, 25))
+
+	opts.Seed = 8
+	other := newStores(t)
+	_, err = Run(ctx, other, opts)
+	require.NoError(t, err)
+	assert.NotEqual(t, snapshot(t, serial, 25), snapshot(t, other, 25))
+}
+
+func TestStarDistribution(t *testing.T) {
+	opts := Options{ReviewsPerArticle: 50}
+	userIDs := make([]int, 200)
+	for i := range userIDs {
+		userIDs[i] = i + 1
+	}
+	counts := map[int]int{}
+	for i := 0; i < 300; i++ {
+		for _, review := range generateReviews(newRand(1, kindArticle, i), opts, 0, i+1, userIDs) {
+			counts[review.Stars]++
+		}
+	}
+	// J-shaped: five stars are the most common and one star beats two
+	assert.Greater(t, counts[5], counts[4])
+	assert.Greater(t, counts[4], counts[3])
+	assert.Greater(t, counts[1], counts[2])
+}
+
+func TestRunValidation(t *testing.T) {
+	_, err := Run(context.Background(), newStores(t), Options{Password: "Secret123"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+var firstNames = []string{
+	"Aziz", "Dilnoza", "Olivia", "Liam", "Sofia", "Noah", "Amira", "Mateo", "Yuki", "Hana",
+	"Kofi", "Amara", "Ivan", "Elena", "Ravi", "Priya", "Lucas", "Emma", "Omar", "Layla",
+	"Chen", "Mei", "Jonas", "Freya", "Diego", "Lucia", "Sami", "Nadia", "Tom", "Grace",
+}
+
+var lastNames = []string{
+	"Karimov", "Yusupova", "Smith", "Garcia", "Muller", "Rossi", "Tanaka", "Kim", "Mensah", "Okafor",
+	"Petrov", "Ivanova", "Sharma", "Patel", "Silva", "Martin", "Haddad", "Nasser", "Wang", "Li",
+	"Berg", "Larsen", "Lopez", "Fernandez", "Novak", "Kowalski", "Brown", "Wilson", "Ali", "Rahimov",
+}
+
+var topics = []string{
+	"databases", "remote work", "urban gardening", "typography", "sourdough", "marathon training",
+	"home networking", "public transport", "photography", "budget travel", "open source", "chess openings",
+	"language learning", "minimalism", "coffee brewing", "electric bikes", "board games", "bird watching",
+}
+
+var adjectives = []string{
+	"practical", "modern", "surprising", "simple", "forgotten", "honest", "quiet", "better",
+	"small", "slow", "curious", "everyday", "hidden", "complete", "gentle", "reliable",
+}
+
+var audiences = []string{
+	"beginners", "busy parents", "students", "small teams", "weekend hobbyists", "everyone else",
+}
+
+var titleTemplates = []string{
+	"A %[1]s guide to %[2]s",
+	"What nobody tells you about %[2]s",
+	"%[3]d %[1]s lessons from a year of %[2]s",
+	"Why %[2]s matters for %[4]s",
+	"Getting started with %[2]s",
+	"The %[1]s side of %[2]s",
+}
+
+var words = strings.Fields(`
+	the a of and to in is it that for on with as was at by this from be are have
+	time people way day year work life world place week thing idea plan habit tool
+	change start learn build try keep make find notice improve share read write test
+	small simple careful steady clear useful quick hard easy good better real local
+	morning evening weekend budget project routine result problem detail friend city
+	because when while after before although usually often rarely never always still
+`)
+
+var positiveNotes = []string{
+	"Really well written, I learned a lot.",
+	"Clear and to the point, thanks for sharing.",
+	"Exactly what I was looking for.",
+	"Great examples, bookmarking this one.",
+}
+
+var neutralNotes = []string{
+	"Decent overview, could use more detail.",
+	"Some good points but a bit long.",
+	"Useful in parts, the ending felt rushed.",
+}
+
+var negativeNotes = []string{
+	"Too shallow to be useful.",
+	"Several claims here are simply wrong.",
+	"Hard to follow and mostly filler.",
+}
+
+func pick(r *rand.Rand, options []string) string {
+	return options[r.IntN(len(options))]
+}
+
+func lower(s string) string {
+	return strings.ToLower(s)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func title(r *rand.Rand) string {
+	template := pick(r, titleTemplates)
+	return capitalize(fmt.Sprintf(template, pick(r, adjectives), pick(r, topics), 3+r.IntN(8), pick(r, audiences)))
+}
+
+func headline(r *rand.Rand) string {
+	return capitalize(pick(r, adjectives) + " " + pick(r, words) + " " + pick(r, words))
+}
+
+// sentence strings between minWords and maxWords words together
+func sentence(r *rand.Rand, minWords, maxWords int) string {
+	count := minWords + r.IntN(maxWords-minWords+1)
+	parts := make([]string, count)
+	for i := range parts {
+		parts[i] = pick(r, words)
+	}
+	// now and then mention a topic so the text isn't only filler
+	if r.Float64() < 0.3 {
+		parts[r.IntN(count)] = pick(r, topics)
+	}
+	return capitalize(strings.Join(parts, " ")) + "."
+}
+
+func paragraph(r *rand.Rand) string {
+	count := 2 + r.IntN(5)
+	sentences := make([]string, count)
+	for i := range sentences {
+		sentences[i] = sentence(r, 6, 18)
+	}
+	return strings.Join(sentences, " ")
+}
+
+func reviewNote(r *rand.Rand, stars int) string {
+	switch {
+	case stars >= 4:
+		return pick(r, positiveNotes)
+	case stars == 3:
+		return pick(r, neutralNotes)
+	default:
+		return pick(r, negativeNotes)
+	}
+}
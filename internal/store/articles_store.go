@@ -1,175 +1,243 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Article struct {
-	ID              int            `json:"id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	Image           string         `json:"image"`
-	AuthorID        int            `json:"author_id"`
-	Paraghraps      []Paraghraph    `json:"paraghraps"`
-	CreatedAt       time.Time         `json:"created_at"`
-	UpdatedAt       time.Time         `json:"updated_at"`
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Image       string       `json:"image"`
+	AuthorID    int          `json:"author_id"`
+	Paraghraps  []Paraghraph `json:"paraghraps"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
 }
 
 type Paraghraph struct {
-	ID              int      `json:"id"`
-	Headline        string   `json:"headline"`
-	Body            string   `json:"body"`
-	OrderIndex      int      `json:"order_index"`
-	CreatedAt       time.Time   `json:"created_at"`
-	UpdatedAt       time.Time   `json:"updated_at"`
+	ID         int       `json:"id"`
+	Headline   string    `json:"headline"`
+	Body       string    `json:"body"`
+	OrderIndex int       `json:"order_index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type PostgresArticleStore struct {
-	db *sql.DB
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewPostgresArticleStore(db *sql.DB) *PostgresArticleStore {
-	return &PostgresArticleStore{db: db}
+func NewPostgresArticleStore(db *pgxpool.Pool, queryTimeout time.Duration) *PostgresArticleStore {
+	return &PostgresArticleStore{db: db, queryTimeout: queryTimeout}
 }
 
 type ArticleStore interface {
-	CreateArticle(article *Article) (*Article, error)
-	GetArticleByID(id int64) (*Article, error)
-	UpdateArticle(article *Article) error
-	DeleteArticle(id int64) error
-	ArticleExists(articleID int64) (bool, error)
-	GetArticleAuthorID(articleID int64) (int64, error)
+	CreateArticle(ctx context.Context, article *Article) (*Article, error)
+	CreateArticles(ctx context.Context, articles []*Article) error
+	GetArticleByID(ctx context.Context, id int64) (*Article, error)
+	UpdateArticle(ctx context.Context, article *Article) error
+	DeleteArticle(ctx context.Context, id int64) error
+	ArticleExists(ctx context.Context, articleID int64) (bool, error)
+	GetArticleAuthorID(ctx context.Context, articleID int64) (int64, error)
 }
 
-func (pg *PostgresArticleStore) CreateArticle(article *Article) (*Article, error) {
-	tx, err := pg.db.Begin()
+func (pg *PostgresArticleStore) CreateArticle(ctx context.Context, article *Article) (_ *Article, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.CreateArticle", "INSERT articles")
+	defer end(&err)
+	tx, err := pg.db.Begin(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 
-	query := 
-	`INSERT INTO articles (title, description, image, author_id)
+	query :=
+		`INSERT INTO articles (title, description, image, author_id)
 	VALUES ($1, $2, $3, $4) RETURNING id;
 	`
-	err = tx.QueryRow(query, article.Title, article.Description, article.Image, article.AuthorID).Scan(&article.ID)
+	err = tx.QueryRow(ctx, query, article.Title, article.Description, article.Image, article.AuthorID).Scan(&article.ID)
 	if err != nil {
 		return nil, err
 	}
-	for _, paraghraph := range article.Paraghraps {
-		query := 
-		`INSERT INTO paraghraps (article_id, headline, body, order_index)
-		VALUES ($1, $2, $3, $4) RETURNING id;
-		`
-		err = tx.QueryRow(query, article.ID, paraghraph.Headline, paraghraph.Body, paraghraph.OrderIndex).Scan(&paraghraph.ID)
-		if err != nil {
-			return nil, err
-		}
+	paragraphs := make([]*Paraghraph, len(article.Paraghraps))
+	for i := range article.Paraghraps {
+		paragraphs[i] = &article.Paraghraps[i]
+	}
+	err = insertParagraphs(ctx, tx, article.ID, paragraphs)
+	if err != nil {
+		return nil, err
 	}
-	err = tx.Commit()
+	article.Paraghraps, err = loadParagraphs(ctx, tx, article.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return article, nil
 }
 
-func (pg *PostgresArticleStore) GetArticleByID(id int64) (*Article, error) {
+// CreateArticles inserts the articles and their paragraphs in one
+// transaction, it is meant for bulk loads. The IDs are set on the given
+// records, unlike CreateArticle nothing is read back.
+func (pg *PostgresArticleStore) CreateArticles(ctx context.Context, articles []*Article) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.CreateArticles", "COPY articles")
+	defer end(&err)
+	if len(articles) == 0 {
+		return nil
+	}
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	ids, err := nextIDs(ctx, tx, "articles", len(articles))
+	if err != nil {
+		return err
+	}
+	copyRows := make([][]any, len(articles))
+	var articleIDs []int
+	var paragraphs []*Paraghraph
+	for i, article := range articles {
+		article.ID = ids[i]
+		copyRows[i] = []any{article.ID, article.Title, article.Description, article.Image, article.AuthorID}
+		for j := range article.Paraghraps {
+			articleIDs = append(articleIDs, article.ID)
+			paragraphs = append(paragraphs, &article.Paraghraps[j])
+		}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"articles"},
+		[]string{"id", "title", "description", "image", "author_id"},
+		pgx.CopyFromRows(copyRows))
+	if err != nil {
+		return err
+	}
+	err = copyParagraphs(ctx, tx, articleIDs, paragraphs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (pg *PostgresArticleStore) GetArticleByID(ctx context.Context, id int64) (_ *Article, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.GetArticleByID", "SELECT articles")
+	defer end(&err)
 	article := &Article{}
 	query := `
 	SELECT id, title, description, image, author_id, created_at, updated_at FROM articles WHERE id = $1;
 	`
-	row := pg.db.QueryRow(query, id)
-	err := row.Scan(&article.ID, &article.Title, &article.Description, &article.Image, &article.AuthorID, &article.CreatedAt, &article.UpdatedAt)
+	row := pg.db.QueryRow(ctx, query, id)
+	err = row.Scan(&article.ID, &article.Title, &article.Description, &article.Image, &article.AuthorID, &article.CreatedAt, &article.UpdatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	article.Paraghraps, err = loadParagraphs(ctx, pg.db, article.ID, false)
+	if err != nil {
+		return nil, err
+	}
 	return article, nil
 }
 
-func (pg *PostgresArticleStore) UpdateArticle(article *Article) error {
-	tx, err := pg.db.Begin()
+// UpdateArticle writes the article and applies the difference between its
+// paragraphs and the stored ones, paragraphs that did not change keep their
+// row untouched. The paragraphs are reloaded into article afterwards.
+func (pg *PostgresArticleStore) UpdateArticle(ctx context.Context, article *Article) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.UpdateArticle", "UPDATE articles")
+	defer end(&err)
+	tx, err := pg.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 	query := `
 	UPDATE articles SET title = $1, description = $2, image = $3, author_id = $4, updated_at = NOW()
 	WHERE id = $5;
 	`
-	result, err := tx.Exec(query, article.Title, article.Description, article.Image, article.AuthorID, article.ID)
+	result, err := tx.Exec(ctx, query, article.Title, article.Description, article.Image, article.AuthorID, article.ID)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	rowsAffected := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("article with ID %d %w", article.ID, ErrNotFound)
+	}
+	existing, err := loadParagraphs(ctx, tx, article.ID, true)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("article with ID %d not found", article.ID)
+	diff, err := diffParagraphs(existing, article.Paraghraps)
+	if err != nil {
+		return err
 	}
-	err = tx.Commit()
+	err = deleteParagraphs(ctx, tx, article.ID, diff.deletes)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(`DELETE FROM paragraphs WHERE article_id = $1;`, article.ID)
+	err = updateParagraphs(ctx, tx, article.ID, diff.updates)
 	if err != nil {
 		return err
 	}
-	for _, paragraph := range article.Paraghraps {
-		query :=
-		`INSERT INTO paragraphs (article_id, headline, body, order_index)
-		VALUES ($1, $2, $3, $4);
-		`
-		_, err := tx.Exec(query, article.ID, paragraph.Headline, paragraph.Body, paragraph.OrderIndex)
-		if err != nil {
-			return err
-		}
+	err = insertParagraphs(ctx, tx, article.ID, diff.inserts)
+	if err != nil {
+		return err
+	}
+	article.Paraghraps, err = loadParagraphs(ctx, tx, article.ID, false)
+	if err != nil {
+		return err
 	}
-	return tx.Commit()
+	return tx.Commit(ctx)
 }
 
-func (pg *PostgresArticleStore) DeleteArticle(id int64) error {
+func (pg *PostgresArticleStore) DeleteArticle(ctx context.Context, id int64) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.DeleteArticle", "DELETE articles")
+	defer end(&err)
 	query := `
 	DELETE FROM articles WHERE id = $1;
 	`
-	result, err := pg.db.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
+	result, err := pg.db.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("article with ID %d not found", id)
+		return fmt.Errorf("article with ID %d %w", id, ErrNotFound)
 	}
 	return nil
 }
 
-func (pg *PostgresArticleStore) ArticleExists(articleID int64) (bool, error) {
+func (pg *PostgresArticleStore) ArticleExists(ctx context.Context, articleID int64) (_ bool, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.ArticleExists", "SELECT articles")
+	defer end(&err)
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1)`
-	err := pg.db.QueryRow(query, articleID).Scan(&exists)
+	err = pg.db.QueryRow(ctx, query, articleID).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-func (pg *PostgresArticleStore) GetArticleAuthorID(articleID int64) (int64, error) {
+func (pg *PostgresArticleStore) GetArticleAuthorID(ctx context.Context, articleID int64) (_ int64, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ArticleStore.GetArticleAuthorID", "SELECT articles")
+	defer end(&err)
 	var authorID int64
 	query := `SELECT author_id FROM articles WHERE id = $1`
-	err := pg.db.QueryRow(query, articleID).Scan(&authorID)
+	err = pg.db.QueryRow(ctx, query, articleID).Scan(&authorID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("article not found")
+		if err == pgx.ErrNoRows {
+			return 0, fmt.Errorf("article %w", ErrNotFound)
 		}
 		return 0, err
 	}
 	return authorID, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,76 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/store/storetest"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+const (
+	testDSN          = "host=localhost port=5432 user=postgres password=postgres dbname=articles sslmode=disable"
+	testQueryTimeout = 5 * time.Second
+)
+
+func TestPostgresConformance(t *testing.T) {
+	ctx := context.Background()
+	pool, err := store.Open(ctx, testDSN, store.PoolOptions{})
+	if err != nil {
+		t.Skipf("postgres is not available: %v", err)
+	}
+	defer pool.Close()
+	db := &store.Database{Driver: store.DriverPostgres, Pool: pool, QueryTimeout: testQueryTimeout}
+	err = db.Migrate(ctx, migrations.FS)
+	if err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		_, err := pool.Exec(ctx, "TRUNCATE TABLE users, articles, paragraphs, reviews, tokens, password_history, user_totp, recovery_codes, login_failures, user_erasures, revoked_tokens, user_token_revocations RESTART IDENTITY CASCADE")
+		if err != nil {
+			t.Fatalf("Failed to truncate tables: %v", err)
+		}
+		return storetest.Stores{
+			Articles: store.NewPostgresArticleStore(pool, testQueryTimeout),
+			Users:    store.NewPostgresUserStore(pool, storetest.Hasher, testQueryTimeout),
+			Reviews:  store.NewPostgresReviewStore(pool, testQueryTimeout),
+			Tokens:   store.NewPostgresTokenStore(pool, testQueryTimeout),
+			Privacy:  store.NewPostgresPrivacyStore(pool, storetest.Hasher, testQueryTimeout),
+			MFA:      store.NewPostgresMFAStore(pool, testQueryTimeout),
+
+			LoginFailures: store.NewPostgresLoginFailureStore(pool, testQueryTimeout),
+			Dump:          db,
+		}
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	ctx := context.Background()
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db, err := store.OpenDatabase(ctx, store.DriverSQLite, filepath.Join(t.TempDir(), "articles.db"), store.PoolOptions{})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(db.Close)
+		db.QueryTimeout = testQueryTimeout
+		err = db.Migrate(ctx, migrations.FS)
+		if err != nil {
+			t.Fatalf("Failed to run migrations: %v", err)
+		}
+		return storetest.Stores{
+			Articles: store.NewSQLiteArticleStore(db.SQL, testQueryTimeout),
+			Users:    store.NewSQLiteUserStore(db.SQL, storetest.Hasher, testQueryTimeout),
+			Reviews:  store.NewSQLiteReviewStore(db.SQL, testQueryTimeout),
+			Tokens:   store.NewSQLiteTokenStore(db.SQL, testQueryTimeout),
+			Privacy:  store.NewSQLitePrivacyStore(db.SQL, storetest.Hasher, testQueryTimeout),
+			MFA:      store.NewSQLiteMFAStore(db.SQL, testQueryTimeout),
+
+			LoginFailures: store.NewSQLiteLoginFailureStore(db.SQL, testQueryTimeout),
+			Dump:          db,
+		}
+	})
+}
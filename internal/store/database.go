@@ -1,39 +1,266 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs"
+	"time"
 
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=articles port=5432 sslmode=disable")
+// PoolOptions sizes the connection pool, zero values keep the pgxpool defaults
+type PoolOptions struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// StatementCacheCapacity is how many prepared statements every
+	// connection keeps, 0 disables caching, as needed behind pgbouncer
+	StatementCacheCapacity int
+}
+
+// Open creates the connection pool and checks that the database answers
+func Open(ctx context.Context, dsn string, opts PoolOptions) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db: parse dsn %w", err)
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	cfg.MinConns = opts.MinConns
+	if opts.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.MaxConnIdleTime
+	}
+	if opts.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = opts.HealthCheckPeriod
+	}
+	if opts.StatementCacheCapacity > 0 {
+		cfg.ConnConfig.StatementCacheCapacity = opts.StatementCacheCapacity
+	} else {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("db: open %w", err)
 	}
-	fmt.Println("Connected to the database successfully")
-	return db, nil
+	err = pool.Ping(ctx)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("db: ping %w", err)
+	}
+	return pool, nil
+}
+
+// SQLDB wraps the pool for libraries that need a *sql.DB, like goose.
+// Closing the returned DB leaves the pool open.
+func SQLDB(pool *pgxpool.Pool) *sql.DB {
+	return stdlib.OpenDBFromPool(pool)
+}
+
+// Drivers the stores can run on
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Database is an open database of either driver, Pool is set for Postgres
+// and SQL for SQLite
+type Database struct {
+	Driver string
+	Pool   *pgxpool.Pool
+	SQL    *sql.DB
+	// QueryTimeout bounds every query of dumps and of the stores built on
+	// the database, zero means no limit other than the caller's context
+	QueryTimeout time.Duration
+}
+
+// OpenDatabase opens a database of the given driver, for SQLite dsn is the
+// path of the database file and only MaxConns of opts is used
+func OpenDatabase(ctx context.Context, driver, dsn string, opts PoolOptions) (*Database, error) {
+	switch driver {
+	case DriverPostgres:
+		pool, err := Open(ctx, dsn, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Database{Driver: driver, Pool: pool}, nil
+	case DriverSQLite:
+		db, err := OpenSQLite(ctx, dsn, int(opts.MaxConns))
+		if err != nil {
+			return nil, err
+		}
+		return &Database{Driver: driver, SQL: db}, nil
+	default:
+		return nil, fmt.Errorf("db: unknown driver %q", driver)
+	}
+}
+
+func (d *Database) Ping(ctx context.Context) error {
+	if d.Pool != nil {
+		return d.Pool.Ping(ctx)
+	}
+	return d.SQL.PingContext(ctx)
+}
+
+func (d *Database) Close() {
+	if d.Pool != nil {
+		d.Pool.Close()
+		return
+	}
+	d.SQL.Close()
+}
+
+// migrationsDir is where the migrations of the driver live in the
+// migrations file system
+func (d *Database) migrationsDir() string {
+	if d.Driver == DriverSQLite {
+		return "sqlite"
+	}
+	return "."
+}
+
+func (d *Database) gooseDialect() goose.Dialect {
+	if d.Driver == DriverSQLite {
+		return goose.DialectSQLite3
+	}
+	return goose.DialectPostgres
+}
+
+// Migrate applies the pending migrations of the driver found in migrationsFS
+func (d *Database) Migrate(ctx context.Context, migrationsFS fs.FS) error {
+	migrator, err := d.Migrator(migrationsFS)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	_, err = migrator.Up(ctx)
+	return err
+}
+
+// MigrationVersions returns the version the database is migrated to and the
+// latest version of the driver found in migrationsFS
+func (d *Database) MigrationVersions(ctx context.Context, migrationsFS fs.FS) (int64, int64, error) {
+	migrator, err := d.Migrator(migrationsFS)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer migrator.Close()
+	return migrator.Versions(ctx)
+}
+
+// SchemaVersion returns the highest migration version recorded in the
+// database with a single query, unlike MigrationVersions it reads no
+// migration files and is cheap enough for every readiness probe
+func (d *Database) SchemaVersion(ctx context.Context) (int64, error) {
+	query := `SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version;`
+	var version int64
+	if d.Pool != nil {
+		err := d.Pool.QueryRow(ctx, query).Scan(&version)
+		return version, err
+	}
+	err := d.SQL.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
 }
 
-func MigrateFS(db *sql.DB, migrationsFS fs.FS, dir string) error {
-	goose.SetBaseFS(migrationsFS)
-	defer func() {
-		goose.SetBaseFS(nil)
-	}()
-	return Migrate(db, dir)
+// Migrator applies and inspects the migrations of one database
+type Migrator struct {
+	provider *goose.Provider
+	// db is the wrapper opened for a Postgres pool, nil for SQLite whose
+	// *sql.DB belongs to the Database
+	db *sql.DB
 }
 
-func Migrate(db *sql.DB, dir string) error {
-	err := goose.SetDialect("postgres")
+// Migrator reads the migrations of the driver from migrationsFS. On Postgres
+// up and down hold a session advisory lock, so replicas starting together
+// wait for each other and apply every migration once. SQLite files are not
+// shared between hosts and its transactions already take the write lock.
+func (d *Database) Migrator(migrationsFS fs.FS) (*Migrator, error) {
+	dir, err := fs.Sub(migrationsFS, d.migrationsDir())
 	if err != nil {
-		return fmt.Errorf("goose: set dialect %w", err)
+		return nil, fmt.Errorf("goose: migrations dir %w", err)
 	}
-	err = goose.Up(db, dir)
+	if d.Pool == nil {
+		provider, err := goose.NewProvider(d.gooseDialect(), d.SQL, dir)
+		if err != nil {
+			return nil, fmt.Errorf("goose: provider %w", err)
+		}
+		return &Migrator{provider: provider}, nil
+	}
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("goose: locker %w", err)
+	}
+	db := SQLDB(d.Pool)
+	provider, err := goose.NewProvider(d.gooseDialect(), db, dir, goose.WithSessionLocker(locker))
 	if err != nil {
-		return fmt.Errorf("goose: up %w", err)
+		db.Close()
+		return nil, fmt.Errorf("goose: provider %w", err)
+	}
+	return &Migrator{provider: provider, db: db}, nil
+}
+
+// Close releases the connection of the migrator, the database stays open
+func (m *Migrator) Close() error {
+	if m.db != nil {
+		return m.db.Close()
 	}
 	return nil
 }
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	results, err := m.provider.Up(ctx)
+	if err != nil {
+		return results, fmt.Errorf("goose: up %w", err)
+	}
+	return results, nil
+}
+
+// Down rolls back the latest applied migration
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	result, err := m.provider.Down(ctx)
+	if err != nil {
+		return result, fmt.Errorf("goose: down %w", err)
+	}
+	return result, nil
+}
+
+// Redo rolls back the latest applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	down, err := m.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+	up, err := m.provider.ApplyVersion(ctx, down.Source.Version, true)
+	if err != nil {
+		return []*goose.MigrationResult{down}, fmt.Errorf("goose: up %w", err)
+	}
+	return []*goose.MigrationResult{down, up}, nil
+}
+
+// Status lists every known migration in version order
+func (m *Migrator) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("goose: status %w", err)
+	}
+	return statuses, nil
+}
+
+// Versions returns the version the database is migrated to and the latest
+// known version
+func (m *Migrator) Versions(ctx context.Context) (int64, int64, error) {
+	return m.provider.GetVersions(ctx)
+}
@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/store/storetest"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+func TestMigratorSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenDatabase(ctx, store.DriverSQLite, filepath.Join(t.TempDir(), "articles.db"), store.PoolOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	migrator, err := db.Migrator(migrations.FS)
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	_, err = migrator.Down(ctx)
+	assert.ErrorIs(t, err, goose.ErrNoNextVersion, "nothing to roll back on an empty database")
+
+	results, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	current, latest, err := migrator.Versions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, current)
+	assert.Len(t, results, int(latest))
+
+	results, err = migrator.Redo(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "down", results[0].Direction)
+	assert.Equal(t, "up", results[1].Direction)
+	assert.Equal(t, latest, results[1].Source.Version)
+
+	result, err := migrator.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, result.Source.Version)
+	version, err := db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version, "rolled back versions don't count")
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, int(latest))
+	assert.Equal(t, goose.StatePending, statuses[latest-1].State)
+	assert.Equal(t, goose.StateApplied, statuses[0].State)
+
+	// the server migrates through the same migrator
+	require.NoError(t, db.Migrate(ctx, migrations.FS))
+	current, _, err = db.MigrationVersions(ctx, migrations.FS)
+	require.NoError(t, err)
+	assert.Equal(t, latest, current)
+	version, err = db.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenDatabase(ctx, store.DriverSQLite, filepath.Join(t.TempDir(), "articles.db"), store.PoolOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate(ctx, migrations.FS))
+
+	_, err = store.NewSQLiteUserStore(db.SQL, storetest.Hasher, time.Nanosecond).GetUserByEmail(ctx, "john@example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the store applies its own timeout")
+
+	user, err := store.NewSQLiteUserStore(db.SQL, storetest.Hasher, 0).GetUserByEmail(ctx, "john@example.com")
+	require.NoError(t, err, "zero means no limit")
+	assert.Nil(t, user)
+}
+
+func TestQuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx := context.Background()
+	db, err := store.OpenDatabase(ctx, store.DriverSQLite, filepath.Join(t.TempDir(), "articles.db"), store.PoolOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Migrate(ctx, migrations.FS))
+
+	_, err = store.NewSQLiteUserStore(db.SQL, storetest.Hasher, 0).GetUserByEmail(ctx, "john@example.com")
+	require.NoError(t, err)
+	_, err = store.NewSQLiteUserStore(db.SQL, storetest.Hasher, time.Nanosecond).GetUserByEmail(ctx, "john@example.com")
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Empty(t, spans[0].Events())
+	assert.Equal(t, codes.Error, spans[1].Status().Code, "failed queries mark their span")
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+}
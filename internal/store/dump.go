@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Dump rows are whole table rows, unlike the records of the stores they
+// keep IDs, timestamps and password hashes. Export and import use them.
+type DumpUser struct {
+	ID        int64  `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	IsAdmin   bool   `json:"is_admin"`
+	Disabled  bool   `json:"disabled"`
+	// PasswordHash is only read when asked for
+	PasswordHash []byte    `json:"password_hash,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type DumpArticle struct {
+	ID          int64     `json:"id"`
+	AuthorID    int64     `json:"author_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Image       string    `json:"image"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type DumpParagraph struct {
+	ID         int64     `json:"id"`
+	ArticleID  int64     `json:"article_id"`
+	Headline   string    `json:"headline"`
+	Body       string    `json:"body"`
+	OrderIndex int       `json:"order_index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type DumpReview struct {
+	ID        int64     `json:"id"`
+	ArticleID int64     `json:"article_id"`
+	AuthorID  int64     `json:"author_id"`
+	Stars     int       `json:"stars"`
+	Note      *string   `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DumpReader streams every row of a table in ID order
+type DumpReader interface {
+	Users(ctx context.Context, withPasswords bool, fn func(*DumpUser) error) error
+	Articles(ctx context.Context, fn func(*DumpArticle) error) error
+	Paragraphs(ctx context.Context, fn func(*DumpParagraph) error) error
+	Reviews(ctx context.Context, fn func(*DumpReview) error) error
+}
+
+// DumpWriter inserts rows under new IDs, which it returns, everything else
+// is kept as given
+type DumpWriter interface {
+	InsertUser(ctx context.Context, user *DumpUser) (int64, error)
+	InsertArticle(ctx context.Context, article *DumpArticle) (int64, error)
+	InsertParagraph(ctx context.Context, paragraph *DumpParagraph) (int64, error)
+	InsertReview(ctx context.Context, review *DumpReview) (int64, error)
+}
+
+// ReadDump runs fn on a consistent snapshot of the database
+func (d *Database) ReadDump(ctx context.Context, fn func(DumpReader) error) error {
+	if d.Pool == nil {
+		return sqliteReadDump(ctx, d.SQL, d.QueryTimeout, fn)
+	}
+	tx, err := d.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = fn(&postgresDump{tx: tx, queryTimeout: d.QueryTimeout})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// WriteDump runs fn in one transaction, which is committed only when fn
+// succeeds and commit is true, so a dry run leaves no trace
+func (d *Database) WriteDump(ctx context.Context, commit bool, fn func(DumpWriter) error) error {
+	if d.Pool == nil {
+		return sqliteWriteDump(ctx, d.SQL, d.QueryTimeout, commit, fn)
+	}
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	err = fn(&postgresDump{tx: tx, queryTimeout: d.QueryTimeout})
+	if err != nil || !commit {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type postgresDump struct {
+	tx           pgx.Tx
+	queryTimeout time.Duration
+}
+
+func (p *postgresDump) Users(ctx context.Context, withPasswords bool, fn func(*DumpUser) error) (err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.Users", "SELECT users")
+	defer end(&err)
+	hash := "NULL"
+	if withPasswords {
+		hash = "password_hash"
+	}
+	rows, err := p.tx.Query(ctx, fmt.Sprintf(`
+	SELECT id, email, firstname, lastname, is_admin, disabled, %s, created_at, updated_at FROM users ORDER BY id;
+	`, hash))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := &DumpUser{}
+		err = rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresDump) Articles(ctx context.Context, fn func(*DumpArticle) error) (err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.Articles", "SELECT articles")
+	defer end(&err)
+	rows, err := p.tx.Query(ctx, `
+	SELECT id, author_id, title, COALESCE(description, ''), COALESCE(image, ''), created_at, updated_at FROM articles ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		article := &DumpArticle{}
+		err = rows.Scan(&article.ID, &article.AuthorID, &article.Title, &article.Description, &article.Image, &article.CreatedAt, &article.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(article)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresDump) Paragraphs(ctx context.Context, fn func(*DumpParagraph) error) (err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.Paragraphs", "SELECT paragraphs")
+	defer end(&err)
+	rows, err := p.tx.Query(ctx, `
+	SELECT id, article_id, headline, COALESCE(body, ''), order_index, created_at, updated_at FROM paragraphs ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		paragraph := &DumpParagraph{}
+		err = rows.Scan(&paragraph.ID, &paragraph.ArticleID, &paragraph.Headline, &paragraph.Body, &paragraph.OrderIndex, &paragraph.CreatedAt, &paragraph.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(paragraph)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresDump) Reviews(ctx context.Context, fn func(*DumpReview) error) (err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.Reviews", "SELECT reviews")
+	defer end(&err)
+	rows, err := p.tx.Query(ctx, `
+	SELECT id, article_id, author_id, stars, note, created_at, updated_at FROM reviews ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		review := &DumpReview{}
+		err = rows.Scan(&review.ID, &review.ArticleID, &review.AuthorID, &review.Stars, &review.Note, &review.CreatedAt, &review.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(review)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *postgresDump) InsertUser(ctx context.Context, user *DumpUser) (_ int64, err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.InsertUser", "INSERT users")
+	defer end(&err)
+	var id int64
+	err = p.tx.QueryRow(ctx, `
+	INSERT INTO users (email, firstname, lastname, is_admin, disabled, password_hash, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;
+	`, user.Email, user.FirstName, user.LastName, user.IsAdmin, user.Disabled, user.PasswordHash, user.CreatedAt, user.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+func (p *postgresDump) InsertArticle(ctx context.Context, article *DumpArticle) (_ int64, err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.InsertArticle", "INSERT articles")
+	defer end(&err)
+	var id int64
+	err = p.tx.QueryRow(ctx, `
+	INSERT INTO articles (author_id, title, description, image, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+	`, article.AuthorID, article.Title, article.Description, article.Image, article.CreatedAt, article.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+func (p *postgresDump) InsertParagraph(ctx context.Context, paragraph *DumpParagraph) (_ int64, err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.InsertParagraph", "INSERT paragraphs")
+	defer end(&err)
+	var id int64
+	err = p.tx.QueryRow(ctx, `
+	INSERT INTO paragraphs (article_id, headline, body, order_index, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+	`, paragraph.ArticleID, paragraph.Headline, paragraph.Body, paragraph.OrderIndex, paragraph.CreatedAt, paragraph.UpdatedAt).Scan(&id)
+	return id, err
+}
+
+func (p *postgresDump) InsertReview(ctx context.Context, review *DumpReview) (_ int64, err error) {
+	ctx, end := startQuery(ctx, p.queryTimeout, "Dump.InsertReview", "INSERT reviews")
+	defer end(&err)
+	var id int64
+	err = p.tx.QueryRow(ctx, `
+	INSERT INTO reviews (article_id, author_id, stars, note, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+	`, review.ArticleID, review.AuthorID, review.Stars, review.Note, review.CreatedAt, review.UpdatedAt).Scan(&id)
+	return id, err
+}
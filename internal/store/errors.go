@@ -0,0 +1,35 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Sentinel errors the stores wrap, so callers can tell the cause of a
+// failed call with errors.Is without parsing messages
+var (
+	// ErrNotFound is returned when a call needs a row that doesn't exist,
+	// lookups still return nil, nil for missing rows
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write breaks a uniqueness rule
+	ErrConflict = errors.New("already exists")
+	// ErrForbidden is returned when a row may not be changed the way asked
+	ErrForbidden = errors.New("not allowed")
+)
+
+// isUniqueViolation reports whether err comes from a unique index of
+// either database
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505" // unique_violation
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PostgresLoginFailureStore struct {
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+func NewPostgresLoginFailureStore(db *pgxpool.Pool, queryTimeout time.Duration) *PostgresLoginFailureStore {
+	return &PostgresLoginFailureStore{db: db, queryTimeout: queryTimeout}
+}
+
+// LoginFailureStore counts failed logins per key (an account or a client IP)
+type LoginFailureStore interface {
+	GetLockedUntil(ctx context.Context, key string) (time.Time, error)
+	RecordFailure(ctx context.Context, key string, since time.Time) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+	// DeleteStale removes keys without a failure since before that are not locked anymore
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AccountFailureKey is derived from the email and not the user ID, so
+// unknown emails are tracked exactly like existing accounts
+func AccountFailureKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPFailureKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MFAFailureKey counts wrong second factor codes of a user
+func MFAFailureKey(userID int64) string {
+	return "mfa:" + strconv.FormatInt(userID, 10)
+}
+
+// GetLockedUntil returns the zero time when the key is not locked
+func (pg *PostgresLoginFailureStore) GetLockedUntil(ctx context.Context, key string) (_ time.Time, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "LoginFailureStore.GetLockedUntil", "SELECT login_failures")
+	defer end(&err)
+	var lockedUntil pgtype.Timestamptz
+	query := `
+	SELECT locked_until FROM login_failures WHERE key = $1;
+	`
+	err = pg.db.QueryRow(ctx, query, key).Scan(&lockedUntil)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordFailure increments the failure counter and returns it, failures
+// older than since are forgotten and the count starts again from one
+func (pg *PostgresLoginFailureStore) RecordFailure(ctx context.Context, key string, since time.Time) (_ int, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "LoginFailureStore.RecordFailure", "INSERT login_failures")
+	defer end(&err)
+	var failures int
+	query := `
+	INSERT INTO login_failures (key, failures, updated_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_failures.updated_at < $2 THEN 1 ELSE login_failures.failures + 1 END,
+		updated_at = NOW()
+	RETURNING failures;
+	`
+	err = pg.db.QueryRow(ctx, query, key, since).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (pg *PostgresLoginFailureStore) Lock(ctx context.Context, key string, until time.Time) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "LoginFailureStore.Lock", "UPDATE login_failures")
+	defer end(&err)
+	query := `
+	UPDATE login_failures SET locked_until = $2 WHERE key = $1;
+	`
+	_, err = pg.db.Exec(ctx, query, key, until)
+	return err
+}
+
+func (pg *PostgresLoginFailureStore) Reset(ctx context.Context, key string) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "LoginFailureStore.Reset", "DELETE login_failures")
+	defer end(&err)
+	query := `
+	DELETE FROM login_failures WHERE key = $1;
+	`
+	_, err = pg.db.Exec(ctx, query, key)
+	return err
+}
+
+func (pg *PostgresLoginFailureStore) DeleteStale(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "LoginFailureStore.DeleteStale", "DELETE login_failures")
+	defer end(&err)
+	query := `
+	DELETE FROM login_failures
+	WHERE updated_at < $1 AND (locked_until IS NULL OR locked_until < NOW());
+	`
+	result, err := pg.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,167 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type ArticleStore struct {
+	db *DB
+}
+
+func NewArticleStore(db *DB) *ArticleStore {
+	return &ArticleStore{db: db}
+}
+
+var _ store.ArticleStore = (*ArticleStore)(nil)
+
+// copyArticle returns a copy that shares nothing with a stored article,
+// paragraphs in reading order
+func copyArticle(article *store.Article) *store.Article {
+	c := *article
+	c.Paraghraps = append([]store.Paraghraph(nil), article.Paraghraps...)
+	sort.SliceStable(c.Paraghraps, func(i, j int) bool {
+		if c.Paraghraps[i].OrderIndex != c.Paraghraps[j].OrderIndex {
+			return c.Paraghraps[i].OrderIndex < c.Paraghraps[j].OrderIndex
+		}
+		return c.Paraghraps[i].ID < c.Paraghraps[j].ID
+	})
+	return &c
+}
+
+func (s *ArticleStore) CreateArticle(ctx context.Context, article *store.Article) (*store.Article, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.db.requireUser(int64(article.AuthorID))
+	if err != nil {
+		return nil, err
+	}
+	stored := s.insert(article, time.Now())
+	article.Paraghraps = copyArticle(stored).Paraghraps
+	return article, nil
+}
+
+// CreateArticles inserts all articles or, when an author does not exist,
+// none
+func (s *ArticleStore) CreateArticles(ctx context.Context, articles []*store.Article) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, article := range articles {
+		err := s.db.requireUser(int64(article.AuthorID))
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for _, article := range articles {
+		s.insert(article, now)
+	}
+	return nil
+}
+
+// insert sets the IDs and timestamps of the article and its paragraphs and
+// returns the stored copy
+func (s *ArticleStore) insert(article *store.Article, now time.Time) *store.Article {
+	article.ID = s.db.id("articles")
+	article.CreatedAt = now
+	article.UpdatedAt = now
+	for i := range article.Paraghraps {
+		article.Paraghraps[i].ID = s.db.id("paragraphs")
+		article.Paraghraps[i].CreatedAt = now
+		article.Paraghraps[i].UpdatedAt = now
+	}
+	stored := copyArticle(article)
+	s.db.articles[article.ID] = stored
+	return stored
+}
+
+func (s *ArticleStore) GetArticleByID(ctx context.Context, id int64) (*store.Article, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	article, ok := s.db.articles[int(id)]
+	if !ok {
+		return nil, nil
+	}
+	return copyArticle(article), nil
+}
+
+func (s *ArticleStore) UpdateArticle(ctx context.Context, article *store.Article) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	stored, ok := s.db.articles[article.ID]
+	if !ok {
+		return fmt.Errorf("article with ID %d %w", article.ID, store.ErrNotFound)
+	}
+	err := s.db.requireUser(int64(article.AuthorID))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	existing := map[int]store.Paraghraph{}
+	for _, paragraph := range stored.Paraghraps {
+		existing[paragraph.ID] = paragraph
+	}
+	seen := map[int]bool{}
+	paragraphs := make([]store.Paraghraph, 0, len(article.Paraghraps))
+	for _, paragraph := range article.Paraghraps {
+		if paragraph.ID == 0 {
+			paragraph.ID = s.db.id("paragraphs")
+			paragraph.CreatedAt = now
+			paragraph.UpdatedAt = now
+			paragraphs = append(paragraphs, paragraph)
+			continue
+		}
+		old, ok := existing[paragraph.ID]
+		if !ok || seen[paragraph.ID] {
+			return fmt.Errorf("%w: %d", store.ErrUnknownParagraph, paragraph.ID)
+		}
+		seen[paragraph.ID] = true
+		if old.Headline != paragraph.Headline || old.Body != paragraph.Body || old.OrderIndex != paragraph.OrderIndex {
+			old.Headline = paragraph.Headline
+			old.Body = paragraph.Body
+			old.OrderIndex = paragraph.OrderIndex
+			old.UpdatedAt = now
+		}
+		paragraphs = append(paragraphs, old)
+	}
+
+	updated := *article
+	updated.Paraghraps = paragraphs
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = now
+	s.db.articles[article.ID] = copyArticle(&updated)
+	article.Paraghraps = copyArticle(&updated).Paraghraps
+	return nil
+}
+
+func (s *ArticleStore) DeleteArticle(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.articles[int(id)]; !ok {
+		return fmt.Errorf("article with ID %d %w", id, store.ErrNotFound)
+	}
+	s.db.deleteArticle(int(id))
+	return nil
+}
+
+func (s *ArticleStore) ArticleExists(ctx context.Context, articleID int64) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.articles[int(articleID)]
+	return ok, nil
+}
+
+func (s *ArticleStore) GetArticleAuthorID(ctx context.Context, articleID int64) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	article, ok := s.db.articles[int(articleID)]
+	if !ok {
+		return 0, fmt.Errorf("article %w", store.ErrNotFound)
+	}
+	return int64(article.AuthorID), nil
+}
@@ -0,0 +1,75 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type LoginFailureStore struct {
+	db *DB
+}
+
+func NewLoginFailureStore(db *DB) *LoginFailureStore {
+	return &LoginFailureStore{db: db}
+}
+
+var _ store.LoginFailureStore = (*LoginFailureStore)(nil)
+
+func (s *LoginFailureStore) GetLockedUntil(ctx context.Context, key string) (time.Time, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	failure, ok := s.db.loginFailures[key]
+	if !ok {
+		return time.Time{}, nil
+	}
+	return failure.lockedUntil, nil
+}
+
+func (s *LoginFailureStore) RecordFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	failure, ok := s.db.loginFailures[key]
+	if !ok {
+		failure = &loginFailure{}
+		s.db.loginFailures[key] = failure
+	}
+	if failure.updatedAt.Before(since) {
+		failure.failures = 0
+	}
+	failure.failures++
+	failure.updatedAt = now
+	return failure.failures, nil
+}
+
+func (s *LoginFailureStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if failure, ok := s.db.loginFailures[key]; ok {
+		failure.lockedUntil = until
+	}
+	return nil
+}
+
+func (s *LoginFailureStore) Reset(ctx context.Context, key string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.loginFailures, key)
+	return nil
+}
+
+func (s *LoginFailureStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var deleted int64
+	now := time.Now()
+	for key, failure := range s.db.loginFailures {
+		if failure.updatedAt.Before(before) && failure.lockedUntil.Before(now) {
+			delete(s.db.loginFailures, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,108 @@
+// Package memstore keeps the store interfaces in memory. It follows the
+// semantics of the Postgres stores, lookups of missing rows return nil,
+// foreign keys are checked and deletes cascade, so it can stand in for a
+// database in tests and local runs.
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+// DB holds the rows of every store, stores created from the same DB see
+// each other's writes like tables of one database
+type DB struct {
+	mu     sync.Mutex
+	nextID map[string]int
+
+	users           map[int]*store.User
+	passwordHistory map[int][]store.User
+	articles        map[int]*store.Article
+	reviews         map[int64]*store.Review
+	tokens          map[string]*tokens.Token
+	revokedTokens   map[string]time.Time
+	userRevocations map[int64]tokens.UserRevocation
+	totp            map[int64]*store.TOTPSettings
+	recoveryCodes   map[int64][]*recoveryCode
+	loginFailures   map[string]*loginFailure
+	erasures        map[int64]*store.Erasure
+}
+
+type recoveryCode struct {
+	hash []byte
+	used bool
+}
+
+type loginFailure struct {
+	failures    int
+	lockedUntil time.Time
+	updatedAt   time.Time
+}
+
+func New() *DB {
+	return &DB{
+		nextID:          map[string]int{},
+		users:           map[int]*store.User{},
+		passwordHistory: map[int][]store.User{},
+		articles:        map[int]*store.Article{},
+		reviews:         map[int64]*store.Review{},
+		tokens:          map[string]*tokens.Token{},
+		revokedTokens:   map[string]time.Time{},
+		userRevocations: map[int64]tokens.UserRevocation{},
+		totp:            map[int64]*store.TOTPSettings{},
+		recoveryCodes:   map[int64][]*recoveryCode{},
+		loginFailures:   map[string]*loginFailure{},
+		erasures:        map[int64]*store.Erasure{},
+	}
+}
+
+// id returns the next value of the sequence of a table
+func (db *DB) id(table string) int {
+	db.nextID[table]++
+	return db.nextID[table]
+}
+
+func (db *DB) requireUser(id int64) error {
+	if _, ok := db.users[int(id)]; !ok {
+		return fmt.Errorf("user with ID %d does not exist", id)
+	}
+	return nil
+}
+
+// deleteUser removes a user and every row that references it
+func (db *DB) deleteUser(id int) {
+	delete(db.users, id)
+	delete(db.passwordHistory, id)
+	for articleID, article := range db.articles {
+		if article.AuthorID == id {
+			db.deleteArticle(articleID)
+		}
+	}
+	for reviewID, review := range db.reviews {
+		if review.AuthorID == int64(id) {
+			delete(db.reviews, reviewID)
+		}
+	}
+	for hash, token := range db.tokens {
+		if token.UserID == int64(id) {
+			delete(db.tokens, hash)
+		}
+	}
+	delete(db.totp, int64(id))
+	delete(db.recoveryCodes, int64(id))
+	delete(db.erasures, int64(id))
+}
+
+// deleteArticle removes an article with its paragraphs and reviews
+func (db *DB) deleteArticle(id int) {
+	delete(db.articles, id)
+	for reviewID, review := range db.reviews {
+		if review.ArticleID == int64(id) {
+			delete(db.reviews, reviewID)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/makhammatovb/Articles/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db := New()
+		return storetest.Stores{
+			Articles: NewArticleStore(db),
+			Users:    NewUserStore(db, storetest.Hasher),
+			Reviews:  NewReviewStore(db),
+			Tokens:   NewTokenStore(db),
+			Privacy:  NewPrivacyStore(db, storetest.Hasher),
+			MFA:      NewMFAStore(db),
+
+			LoginFailures: NewLoginFailureStore(db),
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package memstore
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type MFAStore struct {
+	db *DB
+}
+
+func NewMFAStore(db *DB) *MFAStore {
+	return &MFAStore{db: db}
+}
+
+var _ store.MFAStore = (*MFAStore)(nil)
+
+func (s *MFAStore) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.db.requireUser(userID)
+	if err != nil {
+		return err
+	}
+	s.db.totp[userID] = &store.TOTPSettings{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (s *MFAStore) GetTOTP(ctx context.Context, userID int64) (*store.TOTPSettings, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	settings, ok := s.db.totp[userID]
+	if !ok {
+		return nil, nil
+	}
+	c := *settings
+	return &c, nil
+}
+
+func (s *MFAStore) EnableTOTP(ctx context.Context, userID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if settings, ok := s.db.totp[userID]; ok {
+		settings.Enabled = true
+	}
+	return nil
+}
+
+func (s *MFAStore) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	settings, ok := s.db.totp[userID]
+	if !ok || settings.LastUsedStep >= step {
+		return false, nil
+	}
+	settings.LastUsedStep = step
+	return true, nil
+}
+
+func (s *MFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.db.requireUser(userID)
+	if err != nil {
+		return err
+	}
+	codes := make([]*recoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = &recoveryCode{hash: append([]byte(nil), hash...)}
+	}
+	s.db.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	used := false
+	for _, code := range s.db.recoveryCodes[userID] {
+		if !code.used && bytes.Equal(code.hash, hash) {
+			code.used = true
+			used = true
+		}
+	}
+	return used, nil
+}
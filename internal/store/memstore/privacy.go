@@ -0,0 +1,159 @@
+package memstore
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type PrivacyStore struct {
+	db     *DB
+	hasher passwords.Hasher
+}
+
+// NewPrivacyStore creates a PrivacyStore, hasher makes the unusable
+// password hashes of erased users
+func NewPrivacyStore(db *DB, hasher passwords.Hasher) *PrivacyStore {
+	return &PrivacyStore{db: db, hasher: hasher}
+}
+
+var _ store.PrivacyStore = (*PrivacyStore)(nil)
+
+func (s *PrivacyStore) GetUserData(ctx context.Context, userID int64) (*store.UserData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	user, ok := s.db.users[int(userID)]
+	if !ok {
+		return nil, nil
+	}
+	data := &store.UserData{User: withoutPassword(user), Articles: []*store.Article{}, Reviews: []*store.Review{}, Sessions: []*store.Session{}}
+	for _, article := range s.db.articles {
+		if int64(article.AuthorID) == userID {
+			data.Articles = append(data.Articles, copyArticle(article))
+		}
+	}
+	sort.Slice(data.Articles, func(i, j int) bool { return data.Articles[i].ID < data.Articles[j].ID })
+	for _, review := range s.db.reviews {
+		if review.AuthorID == userID {
+			data.Reviews = append(data.Reviews, copyReview(review))
+		}
+	}
+	sort.Slice(data.Reviews, func(i, j int) bool { return data.Reviews[i].ID < data.Reviews[j].ID })
+	now := time.Now()
+	for _, token := range s.db.tokens {
+		if token.UserID == userID && token.Expiry.After(now) {
+			data.Sessions = append(data.Sessions, &store.Session{Scope: token.Scope, Expiry: token.Expiry})
+		}
+	}
+	sort.Slice(data.Sessions, func(i, j int) bool { return data.Sessions[i].Expiry.Before(data.Sessions[j].Expiry) })
+	return data, nil
+}
+
+func (s *PrivacyStore) ScheduleErasure(ctx context.Context, erasure *store.Erasure) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.db.requireUser(erasure.UserID)
+	if err != nil {
+		return err
+	}
+	if pending, ok := s.db.erasures[erasure.UserID]; ok {
+		*erasure = *pending
+		return nil
+	}
+	stored := *erasure
+	s.db.erasures[erasure.UserID] = &stored
+	return nil
+}
+
+func (s *PrivacyStore) GetErasure(ctx context.Context, userID int64) (*store.Erasure, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	erasure, ok := s.db.erasures[userID]
+	if !ok {
+		return nil, nil
+	}
+	c := *erasure
+	return &c, nil
+}
+
+func (s *PrivacyStore) CancelErasure(ctx context.Context, userID int64) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.erasures[userID]
+	delete(s.db.erasures, userID)
+	return ok, nil
+}
+
+func (s *PrivacyStore) DueErasures(ctx context.Context, now time.Time) ([]*store.Erasure, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	erasures := []*store.Erasure{}
+	for _, erasure := range s.db.erasures {
+		if !erasure.EraseAfter.After(now) {
+			c := *erasure
+			erasures = append(erasures, &c)
+		}
+	}
+	sort.Slice(erasures, func(i, j int) bool { return erasures[i].EraseAfter.Before(erasures[j].EraseAfter) })
+	return erasures, nil
+}
+
+func (s *PrivacyStore) EraseUser(ctx context.Context, erasure *store.Erasure) error {
+	// hashed before taking the lock, hashing is slow on purpose
+	var scrubbed store.User
+	err := scrubbed.PasswordHash.Set(s.hasher, rand.Text())
+	if err != nil {
+		return err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	id := int(erasure.UserID)
+	user, ok := s.db.users[id]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", erasure.UserID, store.ErrNotFound)
+	}
+	// failed logins are keyed by email, they would keep it after the erasure
+	delete(s.db.loginFailures, store.AccountFailureKey(user.Email))
+	delete(s.db.loginFailures, store.MFAFailureKey(erasure.UserID))
+	if !erasure.KeepArticles && !erasure.KeepReviews {
+		s.db.deleteUser(id)
+		return nil
+	}
+
+	for hash, token := range s.db.tokens {
+		if token.UserID == erasure.UserID {
+			delete(s.db.tokens, hash)
+		}
+	}
+	delete(s.db.totp, erasure.UserID)
+	delete(s.db.recoveryCodes, erasure.UserID)
+	delete(s.db.passwordHistory, id)
+	delete(s.db.erasures, erasure.UserID)
+	if !erasure.KeepArticles {
+		for articleID, article := range s.db.articles {
+			if article.AuthorID == id {
+				s.db.deleteArticle(articleID)
+			}
+		}
+	}
+	if !erasure.KeepReviews {
+		for reviewID, review := range s.db.reviews {
+			if review.AuthorID == erasure.UserID {
+				delete(s.db.reviews, reviewID)
+			}
+		}
+	}
+	user.Email = store.ErasedEmail(erasure.UserID)
+	user.FirstName = store.ErasedUser
+	user.LastName = ""
+	user.PasswordHash = scrubbed.PasswordHash
+	user.IsAdmin = false
+	user.Disabled = true
+	user.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,130 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+type ReviewStore struct {
+	db *DB
+}
+
+func NewReviewStore(db *DB) *ReviewStore {
+	return &ReviewStore{db: db}
+}
+
+var _ store.ReviewStore = (*ReviewStore)(nil)
+
+func copyReview(review *store.Review) *store.Review {
+	c := *review
+	if review.Note != nil {
+		note := *review.Note
+		c.Note = &note
+	}
+	return &c
+}
+
+func (s *ReviewStore) CreateReview(ctx context.Context, review *store.Review) (*store.Review, error) {
+	v := validator.New()
+	store.ValidateReview(v, review)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.checkReferences(review)
+	if err != nil {
+		return nil, err
+	}
+	s.insert(review, time.Now())
+	return review, nil
+}
+
+// CreateReviews inserts all reviews or, when one is invalid or refers to a
+// missing article or user, none
+func (s *ReviewStore) CreateReviews(ctx context.Context, reviews []*store.Review) error {
+	v := validator.New()
+	for _, review := range reviews {
+		store.ValidateReview(v, review)
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, review := range reviews {
+		err := s.checkReferences(review)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for _, review := range reviews {
+		s.insert(review, now)
+	}
+	return nil
+}
+
+// checkReferences stands in for the foreign keys of the reviews table
+func (s *ReviewStore) checkReferences(review *store.Review) error {
+	if _, ok := s.db.articles[int(review.ArticleID)]; !ok {
+		return fmt.Errorf("article with ID %d does not exist", review.ArticleID)
+	}
+	return s.db.requireUser(review.AuthorID)
+}
+
+func (s *ReviewStore) insert(review *store.Review, now time.Time) {
+	review.ID = int64(s.db.id("reviews"))
+	review.CreatedAt = now
+	review.UpdatedAt = now
+	s.db.reviews[review.ID] = copyReview(review)
+}
+
+func (s *ReviewStore) UpdateReview(ctx context.Context, review *store.Review) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	stored, ok := s.db.reviews[review.ID]
+	if !ok {
+		return fmt.Errorf("review with ID %d %w", review.ID, store.ErrNotFound)
+	}
+	updated := copyReview(review)
+	stored.Stars = updated.Stars
+	stored.Note = updated.Note
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *ReviewStore) GetReviewByID(ctx context.Context, id int64) (*store.Review, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	review, ok := s.db.reviews[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyReview(review), nil
+}
+
+func (s *ReviewStore) DeleteReview(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.reviews[id]; !ok {
+		return fmt.Errorf("review with ID %d %w", id, store.ErrNotFound)
+	}
+	delete(s.db.reviews, id)
+	return nil
+}
+
+func (s *ReviewStore) GetReviewByUserAndArticle(ctx context.Context, userID, articleID int64) (*store.Review, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, review := range s.db.reviews {
+		if review.AuthorID == userID && review.ArticleID == articleID {
+			return copyReview(review), nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,146 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+type TokenStore struct {
+	db *DB
+}
+
+func NewTokenStore(db *DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+var _ store.TokenStore = (*TokenStore)(nil)
+
+func (s *TokenStore) CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Insert(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *TokenStore) Insert(ctx context.Context, token *tokens.Token) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	err := s.db.requireUser(token.UserID)
+	if err != nil {
+		return err
+	}
+	// like the TIMESTAMP(0) column, expiry is kept to the second
+	stored := &tokens.Token{
+		Hash:   append([]byte(nil), token.Hash...),
+		UserID: token.UserID,
+		Expiry: token.Expiry.Round(time.Second),
+		Scope:  token.Scope,
+	}
+	s.db.tokens[string(token.Hash)] = stored
+	return nil
+}
+
+func (s *TokenStore) DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for hash, token := range s.db.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(s.db.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (s *TokenStore) DeleteToken(ctx context.Context, hash []byte) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.tokens, string(hash))
+	return nil
+}
+
+func (s *TokenStore) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var deleted int64
+	now := time.Now()
+	for hash, token := range s.db.tokens {
+		if token.Expiry.Before(now) {
+			delete(s.db.tokens, hash)
+			deleted++
+		}
+	}
+	for id, expiry := range s.db.revokedTokens {
+		if expiry.Before(now) {
+			delete(s.db.revokedTokens, id)
+			deleted++
+		}
+	}
+	for userID, user := range s.db.userRevocations {
+		if user.Expiry.Before(now) {
+			delete(s.db.userRevocations, userID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *TokenStore) RevokeJWT(ctx context.Context, id string, expiry time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.revokedTokens[id]; !ok {
+		s.db.revokedTokens[id] = expiry.Round(time.Second)
+	}
+	return nil
+}
+
+func (s *TokenStore) RevokeUserJWTs(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	user := s.db.userRevocations[userID]
+	if issuedBefore.After(user.IssuedBefore) {
+		user.IssuedBefore = issuedBefore
+	}
+	if expiry.After(user.Expiry) {
+		user.Expiry = expiry
+	}
+	s.db.userRevocations[userID] = user
+	return nil
+}
+
+func (s *TokenStore) RevokedJWTs(ctx context.Context) (*tokens.Revocations, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	revocations := &tokens.Revocations{IDs: map[string]time.Time{}, Users: map[int64]tokens.UserRevocation{}}
+	now := time.Now()
+	for id, expiry := range s.db.revokedTokens {
+		if expiry.After(now) {
+			revocations.IDs[id] = expiry
+		}
+	}
+	for userID, user := range s.db.userRevocations {
+		if user.Expiry.After(now) {
+			revocations.Users[userID] = user
+		}
+	}
+	return revocations, nil
+}
+
+func (s *TokenStore) GetToken(ctx context.Context, hash []byte) (*tokens.Token, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	token, ok := s.db.tokens[string(hash)]
+	if !ok {
+		return nil, nil
+	}
+	c := *token
+	c.Hash = append([]byte(nil), hash...)
+	return &c, nil
+}
@@ -0,0 +1,243 @@
+package memstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+)
+
+type UserStore struct {
+	db     *DB
+	hasher passwords.Hasher
+}
+
+// NewUserStore creates a UserStore, hasher hashes the passwords set with
+// UpdatePassword
+func NewUserStore(db *DB, hasher passwords.Hasher) *UserStore {
+	return &UserStore{db: db, hasher: hasher}
+}
+
+var _ store.UserStore = (*UserStore)(nil)
+
+// withoutPassword copies a user the way the Postgres queries that don't
+// select password_hash return it
+func withoutPassword(user *store.User) *store.User {
+	var empty store.User
+	c := *user
+	c.PasswordHash = empty.PasswordHash
+	return &c
+}
+
+func (s *UserStore) emailTaken(email string, exceptID int) bool {
+	for id, user := range s.db.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHistory keeps a copy of a user whose password was just set, the
+// copy carries the hash
+func (s *UserStore) recordHistory(user *store.User) {
+	if !user.PasswordHash.Changed() {
+		return
+	}
+	s.db.passwordHistory[user.ID] = append(s.db.passwordHistory[user.ID], *user)
+}
+
+func (s *UserStore) CreateUser(ctx context.Context, user *store.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.emailTaken(user.Email, 0) {
+		return fmt.Errorf("user with email %q %w", user.Email, store.ErrConflict)
+	}
+	s.insert(user, time.Now())
+	return nil
+}
+
+// CreateUsers inserts all users or, when an email is taken, none
+func (s *UserStore) CreateUsers(ctx context.Context, users []*store.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	emails := make(map[string]bool, len(users))
+	for _, user := range users {
+		if emails[user.Email] || s.emailTaken(user.Email, 0) {
+			return fmt.Errorf("user with email %q %w", user.Email, store.ErrConflict)
+		}
+		emails[user.Email] = true
+	}
+	now := time.Now()
+	for _, user := range users {
+		s.insert(user, now)
+	}
+	return nil
+}
+
+func (s *UserStore) insert(user *store.User, now time.Time) {
+	user.ID = s.db.id("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	s.db.users[user.ID] = &stored
+	s.recordHistory(user)
+}
+
+func (s *UserStore) PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (bool, error) {
+	if limit <= 0 {
+		return false, nil
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	candidates := []store.User{}
+	if user, ok := s.db.users[int(userID)]; ok {
+		candidates = append(candidates, *user)
+	}
+	// the newest entry is the current password, checked above
+	history := s.db.passwordHistory[int(userID)]
+	for i := len(history) - 2; i >= 0 && len(history)-1-i < limit; i-- {
+		candidates = append(candidates, history[i])
+	}
+	for _, candidate := range candidates {
+		matches, err := candidate.PasswordHash.Matches(plaintextPassword)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *UserStore) GetUserByID(ctx context.Context, id int64) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	user, ok := s.db.users[int(id)]
+	if !ok {
+		return nil, nil
+	}
+	return withoutPassword(user), nil
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, user := range s.db.users {
+		if user.Email == email {
+			c := *user
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *UserStore) GetUserWithPasswordByID(ctx context.Context, id int64) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	user, ok := s.db.users[int(id)]
+	if !ok {
+		return nil, nil
+	}
+	c := *user
+	return &c, nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, user *store.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	stored, ok := s.db.users[user.ID]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", user.ID, store.ErrNotFound)
+	}
+	if s.emailTaken(user.Email, user.ID) {
+		return fmt.Errorf("user with email %q %w", user.Email, store.ErrConflict)
+	}
+	stored.Email = user.Email
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.UpdatedAt = time.Now()
+	if user.PasswordHash.Changed() {
+		stored.PasswordHash = user.PasswordHash
+	}
+	s.recordHistory(user)
+	return nil
+}
+
+func (s *UserStore) UpdatePasswordHash(ctx context.Context, user *store.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if stored, ok := s.db.users[user.ID]; ok {
+		stored.PasswordHash = user.PasswordHash
+	}
+	return nil
+}
+
+func (s *UserStore) DeleteUser(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.users[int(id)]; !ok {
+		return fmt.Errorf("user with ID %d %w", id, store.ErrNotFound)
+	}
+	s.db.deleteUser(int(id))
+	return nil
+}
+
+func (s *UserStore) UpdatePassword(ctx context.Context, userID int64, newPassword string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	stored, ok := s.db.users[int(userID)]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", userID, store.ErrNotFound)
+	}
+	err := stored.PasswordHash.Set(s.hasher, newPassword)
+	if err != nil {
+		return err
+	}
+	stored.UpdatedAt = time.Now()
+	s.recordHistory(stored)
+	return nil
+}
+
+func (s *UserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	hash := sha256.Sum256([]byte(tokenPlainText))
+	token, ok := s.db.tokens[string(hash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, nil
+	}
+	user, ok := s.db.users[int(token.UserID)]
+	if !ok || user.Disabled {
+		return nil, nil
+	}
+	return withoutPassword(user), nil
+}
+
+func (s *UserStore) ListUsers(ctx context.Context) ([]*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	users := make([]*store.User, 0, len(s.db.users))
+	for _, user := range s.db.users {
+		users = append(users, withoutPassword(user))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (s *UserStore) SetUserDisabled(ctx context.Context, id int64, disabled bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	stored, ok := s.db.users[int(id)]
+	if !ok {
+		return fmt.Errorf("user with ID %d %w", id, store.ErrNotFound)
+	}
+	stored.Disabled = disabled
+	stored.UpdatedAt = time.Now()
+	return nil
+}
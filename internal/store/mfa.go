@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TOTPSettings is the authenticator app enrollment of a user
+type TOTPSettings struct {
+	UserID       int64
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+type PostgresMFAStore struct {
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
+}
+
+func NewPostgresMFAStore(db *pgxpool.Pool, queryTimeout time.Duration) *PostgresMFAStore {
+	return &PostgresMFAStore{db: db, queryTimeout: queryTimeout}
+}
+
+type MFAStore interface {
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string) error
+	GetTOTP(ctx context.Context, userID int64) (*TOTPSettings, error)
+	EnableTOTP(ctx context.Context, userID int64) error
+	MarkTOTPStepUsed(ctx context.Context, userID int64, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error)
+}
+
+// SaveTOTPSecret stores a new, not yet confirmed secret, replacing any previous enrollment
+func (pg *PostgresMFAStore) SaveTOTPSecret(ctx context.Context, userID int64, secret string) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.SaveTOTPSecret", "INSERT user_totp")
+	defer end(&err)
+	query := `
+	INSERT INTO user_totp (user_id, secret, enabled, last_used_step)
+	VALUES ($1, $2, FALSE, 0)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled = FALSE, last_used_step = 0;
+	`
+	_, err = pg.db.Exec(ctx, query, userID, secret)
+	return err
+}
+
+func (pg *PostgresMFAStore) GetTOTP(ctx context.Context, userID int64) (_ *TOTPSettings, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.GetTOTP", "SELECT user_totp")
+	defer end(&err)
+	settings := &TOTPSettings{}
+	query := `
+	SELECT user_id, secret, enabled, last_used_step FROM user_totp WHERE user_id = $1;
+	`
+	err = pg.db.QueryRow(ctx, query, userID).Scan(&settings.UserID, &settings.Secret, &settings.Enabled, &settings.LastUsedStep)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (pg *PostgresMFAStore) EnableTOTP(ctx context.Context, userID int64) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.EnableTOTP", "UPDATE user_totp")
+	defer end(&err)
+	query := `
+	UPDATE user_totp SET enabled = TRUE WHERE user_id = $1;
+	`
+	_, err = pg.db.Exec(ctx, query, userID)
+	return err
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code and reports
+// false when that step (or a later one) was already used
+func (pg *PostgresMFAStore) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64) (_ bool, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.MarkTOTPStepUsed", "UPDATE user_totp")
+	defer end(&err)
+	query := `
+	UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2;
+	`
+	result, err := pg.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+func (pg *PostgresMFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.ReplaceRecoveryCodes", "DELETE INSERT recovery_codes")
+	defer end(&err)
+	// a batch runs in a single implicit transaction, so the old codes are
+	// only gone if all the new ones were stored
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM recovery_codes WHERE user_id = $1;`, userID)
+	for _, hash := range hashes {
+		batch.Queue(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2);`, userID, hash)
+	}
+	return pg.db.SendBatch(ctx, batch).Close()
+}
+
+// UseRecoveryCode consumes an unused recovery code, it reports false if none matched
+func (pg *PostgresMFAStore) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (_ bool, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "MFAStore.UseRecoveryCode", "UPDATE recovery_codes")
+	defer end(&err)
+	query := `
+	UPDATE recovery_codes SET used_at = $3
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+	`
+	result, err := pg.db.Exec(ctx, query, userID, hash, time.Now())
+	if err != nil {
+		return false, err
+	}
+	rowsAffected := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
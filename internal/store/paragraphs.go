@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrUnknownParagraph is returned when an update refers to a paragraph ID
+// that does not belong to the article
+var ErrUnknownParagraph = errors.New("paragraph does not belong to the article")
+
+// paragraphDiff lists the writes that turn the stored paragraphs of an
+// article into the requested ones
+type paragraphDiff struct {
+	inserts []*Paraghraph
+	updates []Paraghraph
+	deletes []int64
+}
+
+// diffParagraphs keys paragraphs on their ID, requested paragraphs without
+// an ID are new, stored ones missing from the request are removed and the
+// rest are only written when something changed
+func diffParagraphs(existing []Paraghraph, requested []Paraghraph) (paragraphDiff, error) {
+	var diff paragraphDiff
+	stored := make(map[int]Paraghraph, len(existing))
+	for _, paragraph := range existing {
+		stored[paragraph.ID] = paragraph
+	}
+	kept := make(map[int]bool, len(requested))
+	for i := range requested {
+		paragraph := &requested[i]
+		if paragraph.ID == 0 {
+			diff.inserts = append(diff.inserts, paragraph)
+			continue
+		}
+		old, ok := stored[paragraph.ID]
+		if !ok || kept[paragraph.ID] {
+			return paragraphDiff{}, fmt.Errorf("%w: %d", ErrUnknownParagraph, paragraph.ID)
+		}
+		kept[paragraph.ID] = true
+		if old.Headline != paragraph.Headline || old.Body != paragraph.Body || old.OrderIndex != paragraph.OrderIndex {
+			diff.updates = append(diff.updates, *paragraph)
+		}
+	}
+	for _, paragraph := range existing {
+		if !kept[paragraph.ID] {
+			diff.deletes = append(diff.deletes, int64(paragraph.ID))
+		}
+	}
+	return diff, nil
+}
+
+// insertParagraphs copies the paragraphs into the table in one round trip
+func insertParagraphs(ctx context.Context, tx pgx.Tx, articleID int, paragraphs []*Paraghraph) error {
+	articleIDs := make([]int, len(paragraphs))
+	for i := range articleIDs {
+		articleIDs[i] = articleID
+	}
+	return copyParagraphs(ctx, tx, articleIDs, paragraphs)
+}
+
+// copyParagraphs inserts paragraphs of any number of articles with a single
+// COPY, paragraphs[i] belongs to articleIDs[i]
+func copyParagraphs(ctx context.Context, tx pgx.Tx, articleIDs []int, paragraphs []*Paraghraph) error {
+	if len(paragraphs) == 0 {
+		return nil
+	}
+	ids, err := nextIDs(ctx, tx, "paragraphs", len(paragraphs))
+	if err != nil {
+		return err
+	}
+	copyRows := make([][]any, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		paragraph.ID = ids[i]
+		copyRows[i] = []any{paragraph.ID, articleIDs[i], paragraph.Headline, paragraph.Body, paragraph.OrderIndex}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"paragraphs"},
+		[]string{"id", "article_id", "headline", "body", "order_index"},
+		pgx.CopyFromRows(copyRows))
+	return err
+}
+
+// nextIDs takes count IDs from the sequence of table. COPY can't return
+// generated keys, so rows copied into a table get their IDs this way and
+// write them explicitly.
+func nextIDs(ctx context.Context, tx pgx.Tx, table string, count int) ([]int, error) {
+	rows, err := tx.Query(ctx, `
+	SELECT nextval(pg_get_serial_sequence($1, 'id')) FROM generate_series(1, $2);
+	`, table, count)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// updateParagraphs rewrites the changed paragraphs with a single statement
+func updateParagraphs(ctx context.Context, tx pgx.Tx, articleID int, paragraphs []Paraghraph) error {
+	if len(paragraphs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(paragraphs))
+	headlines := make([]string, len(paragraphs))
+	bodies := make([]string, len(paragraphs))
+	orders := make([]int32, len(paragraphs))
+	for i, paragraph := range paragraphs {
+		ids[i] = int64(paragraph.ID)
+		headlines[i] = paragraph.Headline
+		bodies[i] = paragraph.Body
+		orders[i] = int32(paragraph.OrderIndex)
+	}
+	query := `
+	UPDATE paragraphs p
+	SET headline = u.headline, body = u.body, order_index = u.order_index, updated_at = NOW()
+	FROM unnest($2::bigint[], $3::text[], $4::text[], $5::int[]) AS u(id, headline, body, order_index)
+	WHERE p.id = u.id AND p.article_id = $1;
+	`
+	_, err := tx.Exec(ctx, query, articleID, ids, headlines, bodies, orders)
+	return err
+}
+
+func deleteParagraphs(ctx context.Context, tx pgx.Tx, articleID int, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `DELETE FROM paragraphs WHERE article_id = $1 AND id = ANY($2);`, articleID, ids)
+	return err
+}
+
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// loadParagraphs returns the paragraphs of an article in reading order
+func loadParagraphs(ctx context.Context, q rowsQuerier, articleID int, forUpdate bool) ([]Paraghraph, error) {
+	query := `
+	SELECT id, headline, body, order_index, created_at, updated_at
+	FROM paragraphs WHERE article_id = $1 ORDER BY order_index, id
+	`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	rows, err := q.Query(ctx, query, articleID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Paraghraph, error) {
+		var paragraph Paraghraph
+		var body *string
+		err := row.Scan(&paragraph.ID, &paragraph.Headline, &body, &paragraph.OrderIndex, &paragraph.CreatedAt, &paragraph.UpdatedAt)
+		if body != nil {
+			paragraph.Body = *body
+		}
+		return paragraph, err
+	})
+}
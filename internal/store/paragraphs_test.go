@@ -0,0 +1,42 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffParagraphs(t *testing.T) {
+	existing := []Paraghraph{
+		{ID: 1, Headline: "Intro", Body: "Hello", OrderIndex: 1},
+		{ID: 2, Headline: "Middle", Body: "World", OrderIndex: 2},
+		{ID: 3, Headline: "End", Body: "Bye", OrderIndex: 3},
+	}
+	requested := []Paraghraph{
+		{ID: 1, Headline: "Intro", Body: "Hello", OrderIndex: 1},
+		{ID: 3, Headline: "End", Body: "Goodbye", OrderIndex: 2},
+		{Headline: "Appendix", Body: "More", OrderIndex: 3},
+	}
+
+	diff, err := diffParagraphs(existing, requested)
+	require.NoError(t, err)
+	require.Len(t, diff.inserts, 1)
+	assert.Equal(t, "Appendix", diff.inserts[0].Headline)
+	assert.Equal(t, []Paraghraph{requested[1]}, diff.updates)
+	assert.Equal(t, []int64{2}, diff.deletes)
+
+	// inserts point into the request so generated IDs reach the caller
+	diff.inserts[0].ID = 10
+	assert.Equal(t, 10, requested[2].ID)
+}
+
+func TestDiffParagraphsRejectsForeignIDs(t *testing.T) {
+	existing := []Paraghraph{{ID: 1, Headline: "Intro"}}
+
+	_, err := diffParagraphs(existing, []Paraghraph{{ID: 7, Headline: "Not mine"}})
+	assert.ErrorIs(t, err, ErrUnknownParagraph)
+
+	_, err = diffParagraphs(existing, []Paraghraph{{ID: 1}, {ID: 1}})
+	assert.ErrorIs(t, err, ErrUnknownParagraph)
+}
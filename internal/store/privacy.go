@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+)
+
+// UserData is everything stored about a user that the user may download
+type UserData struct {
+	User     *User
+	Articles []*Article
+	// Reviews are the reviews the user wrote, on anyone's articles
+	Reviews  []*Review
+	Sessions []*Session
+}
+
+// Session describes a stored token without the token itself
+type Session struct {
+	Scope  string    `json:"scope"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// Erasure is a pending request to erase a user, it becomes final once
+// EraseAfter has passed. KeepArticles and KeepReviews are the content
+// settings in effect when it was requested.
+type Erasure struct {
+	UserID       int64     `json:"user_id"`
+	RequestedAt  time.Time `json:"requested_at"`
+	EraseAfter   time.Time `json:"erase_after"`
+	KeepArticles bool      `json:"keep_articles"`
+	KeepReviews  bool      `json:"keep_reviews"`
+}
+
+// ErasedUser is the name erased users keep when some of their content is
+// kept, their email becomes ErasedEmail
+const ErasedUser = "Deleted user"
+
+// ErasedEmail is the placeholder email of an erased user, unique per user
+// and in a domain that can't receive mail
+func ErasedEmail(userID int64) string {
+	return fmt.Sprintf("erased-%d@erased.invalid", userID)
+}
+
+// erasedPasswordHash returns a hash of a random password nobody knows, so
+// an erased account can't be logged into
+func erasedPasswordHash(hasher passwords.Hasher) ([]byte, error) {
+	return hasher.Hash(rand.Text())
+}
+
+type PrivacyStore interface {
+	// GetUserData returns nil when the user doesn't exist
+	GetUserData(ctx context.Context, userID int64) (*UserData, error)
+	// ScheduleErasure stores erasure unless the user already has one
+	// pending, in which case erasure is overwritten with the pending one
+	ScheduleErasure(ctx context.Context, erasure *Erasure) error
+	GetErasure(ctx context.Context, userID int64) (*Erasure, error)
+	// CancelErasure reports whether there was an erasure to cancel
+	CancelErasure(ctx context.Context, userID int64) (bool, error)
+	// DueErasures returns the erasures whose grace period ended before now
+	DueErasures(ctx context.Context, now time.Time) ([]*Erasure, error)
+	// EraseUser erases the user of erasure in one transaction. Without
+	// content to keep the user is deleted with everything referencing it,
+	// otherwise the content that is not kept is deleted and the user row
+	// is stripped of personal data and disabled, the kept content then
+	// shows ErasedUser as its author.
+	EraseUser(ctx context.Context, erasure *Erasure) error
+}
+
+type PostgresPrivacyStore struct {
+	db           *pgxpool.Pool
+	hasher       passwords.Hasher
+	queryTimeout time.Duration
+}
+
+// NewPostgresPrivacyStore creates a PostgresPrivacyStore, hasher makes the
+// unusable password hashes of erased users
+func NewPostgresPrivacyStore(db *pgxpool.Pool, hasher passwords.Hasher, queryTimeout time.Duration) *PostgresPrivacyStore {
+	return &PostgresPrivacyStore{db: db, hasher: hasher, queryTimeout: queryTimeout}
+}
+
+func (pg *PostgresPrivacyStore) GetUserData(ctx context.Context, userID int64) (_ *UserData, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.GetUserData", "SELECT users")
+	defer end(&err)
+	// one snapshot, so the files of an export agree with each other
+	tx, err := pg.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	user := &User{PasswordHash: password{}}
+	err = tx.QueryRow(ctx, `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at FROM users WHERE id = $1;
+	`, userID).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data := &UserData{User: user, Articles: []*Article{}, Reviews: []*Review{}, Sessions: []*Session{}}
+
+	rows, err := tx.Query(ctx, `
+	SELECT id, title, COALESCE(description, ''), COALESCE(image, ''), author_id, created_at, updated_at FROM articles WHERE author_id = $1 ORDER BY id;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	data.Articles, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Article, error) {
+		article := &Article{}
+		err := row.Scan(&article.ID, &article.Title, &article.Description, &article.Image, &article.AuthorID, &article.CreatedAt, &article.UpdatedAt)
+		return article, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, article := range data.Articles {
+		article.Paraghraps, err = loadParagraphs(ctx, tx, article.ID, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = tx.Query(ctx, `
+	SELECT id, stars, note, author_id, article_id, created_at, updated_at FROM reviews WHERE author_id = $1 ORDER BY id;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	data.Reviews, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Review, error) {
+		review := &Review{}
+		err := row.Scan(&review.ID, &review.Stars, &review.Note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
+		return review, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, `
+	SELECT scope, expiry FROM tokens WHERE user_id = $1 AND expiry > NOW() ORDER BY expiry;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	data.Sessions, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Session, error) {
+		session := &Session{}
+		err := row.Scan(&session.Scope, &session.Expiry)
+		return session, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, tx.Commit(ctx)
+}
+
+func (pg *PostgresPrivacyStore) ScheduleErasure(ctx context.Context, erasure *Erasure) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.ScheduleErasure", "INSERT user_erasures")
+	defer end(&err)
+	// the no-op update makes RETURNING give back the pending row
+	query := `
+	INSERT INTO user_erasures (user_id, requested_at, erase_after, keep_articles, keep_reviews)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+	RETURNING requested_at, erase_after, keep_articles, keep_reviews;
+	`
+	return pg.db.QueryRow(ctx, query, erasure.UserID, erasure.RequestedAt, erasure.EraseAfter, erasure.KeepArticles, erasure.KeepReviews).
+		Scan(&erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+}
+
+func (pg *PostgresPrivacyStore) GetErasure(ctx context.Context, userID int64) (_ *Erasure, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.GetErasure", "SELECT user_erasures")
+	defer end(&err)
+	erasure := &Erasure{}
+	query := `
+	SELECT user_id, requested_at, erase_after, keep_articles, keep_reviews FROM user_erasures WHERE user_id = $1;
+	`
+	err = pg.db.QueryRow(ctx, query, userID).Scan(&erasure.UserID, &erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return erasure, nil
+}
+
+func (pg *PostgresPrivacyStore) CancelErasure(ctx context.Context, userID int64) (_ bool, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.CancelErasure", "DELETE user_erasures")
+	defer end(&err)
+	result, err := pg.db.Exec(ctx, `
+	DELETE FROM user_erasures WHERE user_id = $1;
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (pg *PostgresPrivacyStore) DueErasures(ctx context.Context, now time.Time) (_ []*Erasure, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.DueErasures", "SELECT user_erasures")
+	defer end(&err)
+	rows, err := pg.db.Query(ctx, `
+	SELECT user_id, requested_at, erase_after, keep_articles, keep_reviews FROM user_erasures WHERE erase_after <= $1 ORDER BY erase_after;
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Erasure, error) {
+		erasure := &Erasure{}
+		err := row.Scan(&erasure.UserID, &erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+		return erasure, err
+	})
+}
+
+func (pg *PostgresPrivacyStore) EraseUser(ctx context.Context, erasure *Erasure) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "PrivacyStore.EraseUser", "DELETE users")
+	defer end(&err)
+	hash, err := erasedPasswordHash(pg.hasher)
+	if err != nil {
+		return err
+	}
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// failed logins are keyed by email, they would keep it after the erasure
+	var email string
+	err = tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1;`, erasure.UserID).Scan(&email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+		}
+		return err
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM login_failures WHERE key IN ($1, $2);`,
+		AccountFailureKey(email), MFAFailureKey(erasure.UserID))
+	if err != nil {
+		return err
+	}
+
+	if !erasure.KeepArticles && !erasure.KeepReviews {
+		result, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1;`, erasure.UserID)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+		}
+		return tx.Commit(ctx)
+	}
+
+	statements := []string{
+		`DELETE FROM tokens WHERE user_id = $1;`,
+		`DELETE FROM user_totp WHERE user_id = $1;`,
+		`DELETE FROM recovery_codes WHERE user_id = $1;`,
+		`DELETE FROM password_history WHERE user_id = $1;`,
+		`DELETE FROM user_erasures WHERE user_id = $1;`,
+	}
+	if !erasure.KeepArticles {
+		statements = append(statements, `DELETE FROM articles WHERE author_id = $1;`)
+	}
+	if !erasure.KeepReviews {
+		statements = append(statements, `DELETE FROM reviews WHERE author_id = $1;`)
+	}
+	for _, statement := range statements {
+		_, err = tx.Exec(ctx, statement, erasure.UserID)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(ctx, `
+	UPDATE users SET email = $1, firstname = $2, lastname = '', password_hash = $3, is_admin = FALSE, disabled = TRUE, updated_at = NOW()
+	WHERE id = $4;
+	`, ErasedEmail(erasure.UserID), ErasedUser, hash, erasure.UserID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/makhammatovb/Articles/internal/store")
+
+// startQuery starts a client span for a store method and bounds ctx with
+// timeout, so a slow query can't hold a pool connection forever. Zero means
+// no limit other than the caller's context. statement is a short name of
+// the SQL it runs, like "SELECT articles". The returned function must be
+// deferred with a pointer to the error the method returns, so failed
+// queries show up as failed spans.
+func startQuery(ctx context.Context, timeout time.Duration, method, statement string) (context.Context, func(*error)) {
+	return startSpan(ctx, semconv.DBSystemNamePostgreSQL, timeout, method, statement)
+}
+
+// startSQLiteQuery is startQuery for the SQLite stores
+func startSQLiteQuery(ctx context.Context, timeout time.Duration, method, statement string) (context.Context, func(*error)) {
+	return startSpan(ctx, semconv.DBSystemNameSQLite, timeout, method, statement)
+}
+
+func startSpan(ctx context.Context, system attribute.KeyValue, timeout time.Duration, method, statement string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			system,
+			semconv.DBQuerySummary(statement),
+		),
+	)
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func(err *error) {
+		cancel()
+		if *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
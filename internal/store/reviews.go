@@ -1,9 +1,14 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/makhammatovb/Articles/internal/validator"
 )
 
 type Review struct {
@@ -17,64 +22,109 @@ type Review struct {
 }
 
 type PostgresReviewStore struct {
-	db *sql.DB
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewPostgresReviewStore(db *sql.DB) *PostgresReviewStore {
-	return &PostgresReviewStore{db: db}
+func NewPostgresReviewStore(db *pgxpool.Pool, queryTimeout time.Duration) *PostgresReviewStore {
+	return &PostgresReviewStore{db: db, queryTimeout: queryTimeout}
 }
 
 type ReviewStore interface {
-	CreateReview(review *Review) (*Review, error)
-	GetReviewByID(id int64) (*Review, error)
-	UpdateReview(review *Review) error
-	DeleteReview(id int64) error
-	GetReviewByUserAndArticle(userID, articleID int64) (*Review, error)
+	CreateReview(ctx context.Context, review *Review) (*Review, error)
+	CreateReviews(ctx context.Context, reviews []*Review) error
+	GetReviewByID(ctx context.Context, id int64) (*Review, error)
+	UpdateReview(ctx context.Context, review *Review) error
+	DeleteReview(ctx context.Context, id int64) error
+	GetReviewByUserAndArticle(ctx context.Context, userID, articleID int64) (*Review, error)
 }
 
-func (pg *PostgresReviewStore) CreateReview(review *Review) (*Review, error) {
+func (pg *PostgresReviewStore) CreateReview(ctx context.Context, review *Review) (_ *Review, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.CreateReview", "INSERT reviews")
+	defer end(&err)
 	query :=
 		`INSERT INTO reviews (article_id, author_id, stars, note, created_at, updated_at)
 	VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id;
 	`
-	if review.Stars == 0 || review.Stars > 5 || review.Stars < 0 {
-		return nil, fmt.Errorf("invalid stars value: %d", review.Stars)
+	v := validator.New()
+	ValidateReview(v, review)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
-	err := pg.db.QueryRow(query, review.ArticleID, review.AuthorID, review.Stars, review.Note).Scan(&review.ID)
+	err = pg.db.QueryRow(ctx, query, review.ArticleID, review.AuthorID, review.Stars, review.Note).Scan(&review.ID)
 	if err != nil {
 		return nil, err
 	}
 	return review, nil
 }
 
-func (pg *PostgresReviewStore) UpdateReview(review *Review) error {
+// CreateReviews inserts the reviews in one transaction, it is meant for
+// bulk loads. The IDs are set on the given records.
+func (pg *PostgresReviewStore) CreateReviews(ctx context.Context, reviews []*Review) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.CreateReviews", "COPY reviews")
+	defer end(&err)
+	v := validator.New()
+	for _, review := range reviews {
+		ValidateReview(v, review)
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if len(reviews) == 0 {
+		return nil
+	}
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	ids, err := nextIDs(ctx, tx, "reviews", len(reviews))
+	if err != nil {
+		return err
+	}
+	copyRows := make([][]any, len(reviews))
+	for i, review := range reviews {
+		review.ID = int64(ids[i])
+		copyRows[i] = []any{review.ID, review.ArticleID, review.AuthorID, review.Stars, review.Note}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"reviews"},
+		[]string{"id", "article_id", "author_id", "stars", "note"},
+		pgx.CopyFromRows(copyRows))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (pg *PostgresReviewStore) UpdateReview(ctx context.Context, review *Review) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.UpdateReview", "UPDATE reviews")
+	defer end(&err)
 	query := `
 	UPDATE reviews SET stars = $1, note = $2, updated_at = NOW()
 	WHERE id = $3;
 	`
-	result, err := pg.db.Exec(query, review.Stars, review.Note, review.ID)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
+	result, err := pg.db.Exec(ctx, query, review.Stars, review.Note, review.ID)
 	if err != nil {
 		return err
 	}
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("review with ID %d not found", review.ID)
+		return fmt.Errorf("review with ID %d %w", review.ID, ErrNotFound)
 	}
 	return nil
 }
 
-func (pg *PostgresReviewStore) GetReviewByID(id int64) (*Review, error) {
+func (pg *PostgresReviewStore) GetReviewByID(ctx context.Context, id int64) (_ *Review, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.GetReviewByID", "SELECT reviews")
+	defer end(&err)
 	review := &Review{}
 	query := `
-	SELECT * FROM reviews WHERE id = $1;
+	SELECT id, stars, note, author_id, article_id, created_at, updated_at FROM reviews WHERE id = $1;
 	`
-	row := pg.db.QueryRow(query, id)
-	err := row.Scan(&review.ID, &review.AuthorID, &review.ArticleID, &review.Note, &review.Stars, &review.CreatedAt, &review.UpdatedAt)
+	row := pg.db.QueryRow(ctx, query, id)
+	err = row.Scan(&review.ID, &review.Stars, &review.Note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
@@ -82,37 +132,38 @@ func (pg *PostgresReviewStore) GetReviewByID(id int64) (*Review, error) {
 	return review, nil
 }
 
-func (pg *PostgresReviewStore) DeleteReview(id int64) error {
+func (pg *PostgresReviewStore) DeleteReview(ctx context.Context, id int64) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.DeleteReview", "DELETE reviews")
+	defer end(&err)
 	query := `
 	DELETE FROM reviews WHERE id = $1;
 	`
-	result, err := pg.db.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
+	result, err := pg.db.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("review with ID %d not found", id)
+		return fmt.Errorf("review with ID %d %w", id, ErrNotFound)
 	}
 	return nil
 }
 
-func (pg *PostgresReviewStore) GetReviewByUserAndArticle(userID, articleID int64) (*Review, error) {
-    review := &Review{}
-    query := `
+func (pg *PostgresReviewStore) GetReviewByUserAndArticle(ctx context.Context, userID, articleID int64) (_ *Review, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "ReviewStore.GetReviewByUserAndArticle", "SELECT reviews")
+	defer end(&err)
+	review := &Review{}
+	query := `
     SELECT id, stars, note, author_id, article_id, created_at, updated_at 
     FROM reviews WHERE author_id = $1 AND article_id = $2;
     `
-    row := pg.db.QueryRow(query, userID, articleID)
-    err := row.Scan(&review.ID, &review.Stars, &review.Note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return nil, nil
-        }
-        return nil, err
-    }
-    return review, nil
+	row := pg.db.QueryRow(ctx, query, userID, articleID)
+	err = row.Scan(&review.ID, &review.Stars, &review.Note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return review, nil
 }
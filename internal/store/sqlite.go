@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteParams turn on foreign keys, which SQLite leaves off by default,
+// let writers wait for each other instead of failing, and take the write
+// lock when a transaction begins so it can't fail halfway on a busy database
+var sqliteParams = []string{
+	"_pragma=foreign_keys(1)",
+	"_pragma=busy_timeout(5000)",
+	"_pragma=journal_mode(WAL)",
+	"_txlock=immediate",
+	"_time_format=sqlite",
+}
+
+// OpenSQLite opens the database file at path, creating it if needed, and
+// checks that it answers. maxConns limits open connections, 0 means no limit.
+func OpenSQLite(ctx context.Context, path string, maxConns int) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	dsn := path + separator + strings.Join(sqliteParams, "&")
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db: open %w", err)
+	}
+	db.SetMaxOpenConns(maxConns)
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db: ping %w", err)
+	}
+	return db, nil
+}
+
+// sqliteNow is the current time the way the SQLite stores write it, in UTC
+// so stored times compare in the order they happened
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+type sqliteQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
@@ -0,0 +1,300 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type SQLiteArticleStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLiteArticleStore(db *sql.DB, queryTimeout time.Duration) *SQLiteArticleStore {
+	return &SQLiteArticleStore{db: db, queryTimeout: queryTimeout}
+}
+
+func (s *SQLiteArticleStore) CreateArticle(ctx context.Context, article *Article) (_ *Article, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.CreateArticle", "INSERT articles")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteNow()
+	query := `
+	INSERT INTO articles (title, description, image, author_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`
+	err = tx.QueryRowContext(ctx, query, article.Title, article.Description, article.Image, article.AuthorID, now, now).Scan(&article.ID)
+	if err != nil {
+		return nil, err
+	}
+	paragraphs := make([]*Paraghraph, len(article.Paraghraps))
+	for i := range article.Paraghraps {
+		paragraphs[i] = &article.Paraghraps[i]
+	}
+	err = sqliteInsertParagraphs(ctx, tx, article.ID, paragraphs)
+	if err != nil {
+		return nil, err
+	}
+	article.Paraghraps, err = sqliteLoadParagraphs(ctx, tx, article.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// CreateArticles inserts the articles and their paragraphs in one
+// transaction, like the Postgres store nothing is read back
+func (s *SQLiteArticleStore) CreateArticles(ctx context.Context, articles []*Article) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.CreateArticles", "INSERT articles")
+	defer end(&err)
+	if len(articles) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO articles (title, description, image, author_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := sqliteNow()
+	for _, article := range articles {
+		err = stmt.QueryRowContext(ctx, article.Title, article.Description, article.Image, article.AuthorID, now, now).Scan(&article.ID)
+		if err != nil {
+			return err
+		}
+		paragraphs := make([]*Paraghraph, len(article.Paraghraps))
+		for i := range article.Paraghraps {
+			paragraphs[i] = &article.Paraghraps[i]
+		}
+		err = sqliteInsertParagraphs(ctx, tx, article.ID, paragraphs)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteArticleStore) GetArticleByID(ctx context.Context, id int64) (_ *Article, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.GetArticleByID", "SELECT articles")
+	defer end(&err)
+	article := &Article{}
+	var description, image sql.NullString
+	query := `
+	SELECT id, title, description, image, author_id, created_at, updated_at FROM articles WHERE id = ?;
+	`
+	err = s.db.QueryRowContext(ctx, query, id).Scan(&article.ID, &article.Title, &description, &image, &article.AuthorID, &article.CreatedAt, &article.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	article.Description = description.String
+	article.Image = image.String
+	article.Paraghraps, err = sqliteLoadParagraphs(ctx, s.db, article.ID)
+	if err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// UpdateArticle applies the same paragraph diff as the Postgres store, the
+// transaction holds the write lock from the start so the paragraphs read
+// for the diff can't change underneath it
+func (s *SQLiteArticleStore) UpdateArticle(ctx context.Context, article *Article) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.UpdateArticle", "UPDATE articles")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `
+	UPDATE articles SET title = ?, description = ?, image = ?, author_id = ?, updated_at = ?
+	WHERE id = ?;
+	`
+	result, err := tx.ExecContext(ctx, query, article.Title, article.Description, article.Image, article.AuthorID, sqliteNow(), article.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("article with ID %d %w", article.ID, ErrNotFound)
+	}
+	existing, err := sqliteLoadParagraphs(ctx, tx, article.ID)
+	if err != nil {
+		return err
+	}
+	diff, err := diffParagraphs(existing, article.Paraghraps)
+	if err != nil {
+		return err
+	}
+	err = sqliteDeleteParagraphs(ctx, tx, article.ID, diff.deletes)
+	if err != nil {
+		return err
+	}
+	err = sqliteUpdateParagraphs(ctx, tx, article.ID, diff.updates)
+	if err != nil {
+		return err
+	}
+	err = sqliteInsertParagraphs(ctx, tx, article.ID, diff.inserts)
+	if err != nil {
+		return err
+	}
+	article.Paraghraps, err = sqliteLoadParagraphs(ctx, tx, article.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteArticleStore) DeleteArticle(ctx context.Context, id int64) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.DeleteArticle", "DELETE articles")
+	defer end(&err)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM articles WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("article with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLiteArticleStore) ArticleExists(ctx context.Context, articleID int64) (_ bool, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.ArticleExists", "SELECT articles")
+	defer end(&err)
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM articles WHERE id = ?)`, articleID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (s *SQLiteArticleStore) GetArticleAuthorID(ctx context.Context, articleID int64) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ArticleStore.GetArticleAuthorID", "SELECT articles")
+	defer end(&err)
+	var authorID int64
+	err = s.db.QueryRowContext(ctx, `SELECT author_id FROM articles WHERE id = ?`, articleID).Scan(&authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("article %w", ErrNotFound)
+		}
+		return 0, err
+	}
+	return authorID, nil
+}
+
+// sqliteInsertParagraphs reuses one prepared statement, SQLite has no
+// round trips to save so a statement per row costs next to nothing
+func sqliteInsertParagraphs(ctx context.Context, tx *sql.Tx, articleID int, paragraphs []*Paraghraph) error {
+	if len(paragraphs) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO paragraphs (article_id, headline, body, order_index, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := sqliteNow()
+	for _, paragraph := range paragraphs {
+		err = stmt.QueryRowContext(ctx, articleID, paragraph.Headline, paragraph.Body, paragraph.OrderIndex, now, now).Scan(&paragraph.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqliteUpdateParagraphs(ctx context.Context, tx *sql.Tx, articleID int, paragraphs []Paraghraph) error {
+	if len(paragraphs) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+	UPDATE paragraphs SET headline = ?, body = ?, order_index = ?, updated_at = ?
+	WHERE id = ? AND article_id = ?;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := sqliteNow()
+	for _, paragraph := range paragraphs {
+		_, err = stmt.ExecContext(ctx, paragraph.Headline, paragraph.Body, paragraph.OrderIndex, now, paragraph.ID, articleID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqliteDeleteParagraphs(ctx context.Context, tx *sql.Tx, articleID int, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM paragraphs WHERE article_id = ? AND id = ?;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		_, err = stmt.ExecContext(ctx, articleID, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteLoadParagraphs returns the paragraphs of an article in reading order
+func sqliteLoadParagraphs(ctx context.Context, q sqliteQuerier, articleID int) ([]Paraghraph, error) {
+	rows, err := q.QueryContext(ctx, `
+	SELECT id, headline, body, order_index, created_at, updated_at
+	FROM paragraphs WHERE article_id = ? ORDER BY order_index, id;
+	`, articleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	paragraphs := []Paraghraph{}
+	for rows.Next() {
+		var paragraph Paraghraph
+		var body sql.NullString
+		err = rows.Scan(&paragraph.ID, &paragraph.Headline, &body, &paragraph.OrderIndex, &paragraph.CreatedAt, &paragraph.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		paragraph.Body = body.String
+		paragraphs = append(paragraphs, paragraph)
+	}
+	return paragraphs, rows.Err()
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqliteReadDump reads in one transaction, which holds the write lock so
+// the rows can't change halfway through
+func sqliteReadDump(ctx context.Context, db *sql.DB, queryTimeout time.Duration, fn func(DumpReader) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = fn(&sqliteDump{tx: tx, queryTimeout: queryTimeout})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func sqliteWriteDump(ctx context.Context, db *sql.DB, queryTimeout time.Duration, commit bool, fn func(DumpWriter) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = fn(&sqliteDump{tx: tx, queryTimeout: queryTimeout})
+	if err != nil || !commit {
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqliteDump struct {
+	tx           *sql.Tx
+	queryTimeout time.Duration
+}
+
+func (s *sqliteDump) Users(ctx context.Context, withPasswords bool, fn func(*DumpUser) error) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.Users", "SELECT users")
+	defer end(&err)
+	hash := "NULL"
+	if withPasswords {
+		hash = "password_hash"
+	}
+	rows, err := s.tx.QueryContext(ctx, fmt.Sprintf(`
+	SELECT id, email, firstname, lastname, is_admin, disabled, %s, created_at, updated_at FROM users ORDER BY id;
+	`, hash))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user := &DumpUser{}
+		err = rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(user)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteDump) Articles(ctx context.Context, fn func(*DumpArticle) error) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.Articles", "SELECT articles")
+	defer end(&err)
+	rows, err := s.tx.QueryContext(ctx, `
+	SELECT id, author_id, title, COALESCE(description, ''), COALESCE(image, ''), created_at, updated_at FROM articles ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		article := &DumpArticle{}
+		err = rows.Scan(&article.ID, &article.AuthorID, &article.Title, &article.Description, &article.Image, &article.CreatedAt, &article.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(article)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteDump) Paragraphs(ctx context.Context, fn func(*DumpParagraph) error) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.Paragraphs", "SELECT paragraphs")
+	defer end(&err)
+	rows, err := s.tx.QueryContext(ctx, `
+	SELECT id, article_id, headline, COALESCE(body, ''), order_index, created_at, updated_at FROM paragraphs ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		paragraph := &DumpParagraph{}
+		err = rows.Scan(&paragraph.ID, &paragraph.ArticleID, &paragraph.Headline, &paragraph.Body, &paragraph.OrderIndex, &paragraph.CreatedAt, &paragraph.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = fn(paragraph)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteDump) Reviews(ctx context.Context, fn func(*DumpReview) error) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.Reviews", "SELECT reviews")
+	defer end(&err)
+	rows, err := s.tx.QueryContext(ctx, `
+	SELECT id, article_id, author_id, stars, note, created_at, updated_at FROM reviews ORDER BY id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		review := &DumpReview{}
+		var note sql.NullString
+		err = rows.Scan(&review.ID, &review.ArticleID, &review.AuthorID, &review.Stars, &note, &review.CreatedAt, &review.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if note.Valid {
+			review.Note = &note.String
+		}
+		err = fn(review)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// the inserts store times in UTC like the other SQLite stores do
+
+func (s *sqliteDump) InsertUser(ctx context.Context, user *DumpUser) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.InsertUser", "INSERT users")
+	defer end(&err)
+	var id int64
+	err = s.tx.QueryRowContext(ctx, `
+	INSERT INTO users (email, firstname, lastname, is_admin, disabled, password_hash, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+	`, user.Email, user.FirstName, user.LastName, user.IsAdmin, user.Disabled, user.PasswordHash, user.CreatedAt.UTC(), user.UpdatedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *sqliteDump) InsertArticle(ctx context.Context, article *DumpArticle) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.InsertArticle", "INSERT articles")
+	defer end(&err)
+	var id int64
+	err = s.tx.QueryRowContext(ctx, `
+	INSERT INTO articles (author_id, title, description, image, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`, article.AuthorID, article.Title, article.Description, article.Image, article.CreatedAt.UTC(), article.UpdatedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *sqliteDump) InsertParagraph(ctx context.Context, paragraph *DumpParagraph) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.InsertParagraph", "INSERT paragraphs")
+	defer end(&err)
+	var id int64
+	err = s.tx.QueryRowContext(ctx, `
+	INSERT INTO paragraphs (article_id, headline, body, order_index, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`, paragraph.ArticleID, paragraph.Headline, paragraph.Body, paragraph.OrderIndex, paragraph.CreatedAt.UTC(), paragraph.UpdatedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *sqliteDump) InsertReview(ctx context.Context, review *DumpReview) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "Dump.InsertReview", "INSERT reviews")
+	defer end(&err)
+	var id int64
+	err = s.tx.QueryRowContext(ctx, `
+	INSERT INTO reviews (article_id, author_id, stars, note, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`, review.ArticleID, review.AuthorID, review.Stars, review.Note, review.CreatedAt.UTC(), review.UpdatedAt.UTC()).Scan(&id)
+	return id, err
+}
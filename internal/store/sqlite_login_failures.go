@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SQLiteLoginFailureStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLiteLoginFailureStore(db *sql.DB, queryTimeout time.Duration) *SQLiteLoginFailureStore {
+	return &SQLiteLoginFailureStore{db: db, queryTimeout: queryTimeout}
+}
+
+// GetLockedUntil returns the zero time when the key is not locked
+func (s *SQLiteLoginFailureStore) GetLockedUntil(ctx context.Context, key string) (_ time.Time, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "LoginFailureStore.GetLockedUntil", "SELECT login_failures")
+	defer end(&err)
+	var lockedUntil sql.NullTime
+	err = s.db.QueryRowContext(ctx, `SELECT locked_until FROM login_failures WHERE key = ?;`, key).Scan(&lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return lockedUntil.Time, nil
+}
+
+// RecordFailure increments the failure counter and returns it, failures
+// older than since are forgotten and the count starts again from one
+func (s *SQLiteLoginFailureStore) RecordFailure(ctx context.Context, key string, since time.Time) (_ int, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "LoginFailureStore.RecordFailure", "INSERT login_failures")
+	defer end(&err)
+	var failures int
+	query := `
+	INSERT INTO login_failures (key, failures, updated_at)
+	VALUES (?1, 1, ?3)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_failures.updated_at < ?2 THEN 1 ELSE login_failures.failures + 1 END,
+		updated_at = ?3
+	RETURNING failures;
+	`
+	err = s.db.QueryRowContext(ctx, query, key, since.UTC(), sqliteNow()).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	return failures, nil
+}
+
+func (s *SQLiteLoginFailureStore) Lock(ctx context.Context, key string, until time.Time) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "LoginFailureStore.Lock", "UPDATE login_failures")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `UPDATE login_failures SET locked_until = ? WHERE key = ?;`, until.UTC(), key)
+	return err
+}
+
+func (s *SQLiteLoginFailureStore) Reset(ctx context.Context, key string) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "LoginFailureStore.Reset", "DELETE login_failures")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `DELETE FROM login_failures WHERE key = ?;`, key)
+	return err
+}
+
+func (s *SQLiteLoginFailureStore) DeleteStale(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "LoginFailureStore.DeleteStale", "DELETE login_failures")
+	defer end(&err)
+	query := `
+	DELETE FROM login_failures
+	WHERE updated_at < ?1 AND (locked_until IS NULL OR locked_until < ?2);
+	`
+	result, err := s.db.ExecContext(ctx, query, before.UTC(), sqliteNow())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
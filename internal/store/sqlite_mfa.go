@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SQLiteMFAStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLiteMFAStore(db *sql.DB, queryTimeout time.Duration) *SQLiteMFAStore {
+	return &SQLiteMFAStore{db: db, queryTimeout: queryTimeout}
+}
+
+// SaveTOTPSecret stores a new, not yet confirmed secret, replacing any previous enrollment
+func (s *SQLiteMFAStore) SaveTOTPSecret(ctx context.Context, userID int64, secret string) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.SaveTOTPSecret", "INSERT user_totp")
+	defer end(&err)
+	query := `
+	INSERT INTO user_totp (user_id, secret, enabled, last_used_step, created_at)
+	VALUES (?, ?, FALSE, 0, ?)
+	ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = FALSE, last_used_step = 0;
+	`
+	_, err = s.db.ExecContext(ctx, query, userID, secret, sqliteNow())
+	return err
+}
+
+func (s *SQLiteMFAStore) GetTOTP(ctx context.Context, userID int64) (_ *TOTPSettings, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.GetTOTP", "SELECT user_totp")
+	defer end(&err)
+	settings := &TOTPSettings{}
+	query := `
+	SELECT user_id, secret, enabled, last_used_step FROM user_totp WHERE user_id = ?;
+	`
+	err = s.db.QueryRowContext(ctx, query, userID).Scan(&settings.UserID, &settings.Secret, &settings.Enabled, &settings.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *SQLiteMFAStore) EnableTOTP(ctx context.Context, userID int64) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.EnableTOTP", "UPDATE user_totp")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `UPDATE user_totp SET enabled = TRUE WHERE user_id = ?;`, userID)
+	return err
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code and reports
+// false when that step (or a later one) was already used
+func (s *SQLiteMFAStore) MarkTOTPStepUsed(ctx context.Context, userID int64, step int64) (_ bool, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.MarkTOTPStepUsed", "UPDATE user_totp")
+	defer end(&err)
+	query := `
+	UPDATE user_totp SET last_used_step = ?2 WHERE user_id = ?1 AND last_used_step < ?2;
+	`
+	result, err := s.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (s *SQLiteMFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes [][]byte) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.ReplaceRecoveryCodes", "DELETE INSERT recovery_codes")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?;`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?);`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode consumes an unused recovery code, it reports false if none matched
+func (s *SQLiteMFAStore) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (_ bool, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "MFAStore.UseRecoveryCode", "UPDATE recovery_codes")
+	defer end(&err)
+	query := `
+	UPDATE recovery_codes SET used_at = ?
+	WHERE id = (SELECT id FROM recovery_codes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1);
+	`
+	result, err := s.db.ExecContext(ctx, query, sqliteNow(), userID, hash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
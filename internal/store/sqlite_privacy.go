@@ -0,0 +1,252 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+)
+
+type SQLitePrivacyStore struct {
+	db           *sql.DB
+	hasher       passwords.Hasher
+	queryTimeout time.Duration
+}
+
+// NewSQLitePrivacyStore creates a SQLitePrivacyStore, hasher makes the
+// unusable password hashes of erased users
+func NewSQLitePrivacyStore(db *sql.DB, hasher passwords.Hasher, queryTimeout time.Duration) *SQLitePrivacyStore {
+	return &SQLitePrivacyStore{db: db, hasher: hasher, queryTimeout: queryTimeout}
+}
+
+func (s *SQLitePrivacyStore) GetUserData(ctx context.Context, userID int64) (_ *UserData, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.GetUserData", "SELECT users")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := sqliteScanUser(tx.QueryRowContext(ctx, `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at FROM users WHERE id = ?;
+	`, userID), false)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	data := &UserData{User: user, Articles: []*Article{}, Reviews: []*Review{}, Sessions: []*Session{}}
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT id, title, COALESCE(description, ''), COALESCE(image, ''), author_id, created_at, updated_at FROM articles WHERE author_id = ? ORDER BY id;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		article := &Article{}
+		err = rows.Scan(&article.ID, &article.Title, &article.Description, &article.Image, &article.AuthorID, &article.CreatedAt, &article.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		data.Articles = append(data.Articles, article)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, article := range data.Articles {
+		article.Paraghraps, err = sqliteLoadParagraphs(ctx, tx, article.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+	SELECT id, stars, note, author_id, article_id, created_at, updated_at FROM reviews WHERE author_id = ? ORDER BY id;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		review := &Review{}
+		var note sql.NullString
+		err = rows.Scan(&review.ID, &review.Stars, &note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if note.Valid {
+			review.Note = &note.String
+		}
+		data.Reviews = append(data.Reviews, review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+	SELECT scope, expiry FROM tokens WHERE user_id = ? AND expiry > ? ORDER BY expiry;
+	`, userID, sqliteNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		session := &Session{}
+		err = rows.Scan(&session.Scope, &session.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		data.Sessions = append(data.Sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return data, tx.Commit()
+}
+
+func (s *SQLitePrivacyStore) ScheduleErasure(ctx context.Context, erasure *Erasure) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.ScheduleErasure", "INSERT user_erasures")
+	defer end(&err)
+	query := `
+	INSERT INTO user_erasures (user_id, requested_at, erase_after, keep_articles, keep_reviews)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET user_id = excluded.user_id
+	RETURNING requested_at, erase_after, keep_articles, keep_reviews;
+	`
+	return s.db.QueryRowContext(ctx, query, erasure.UserID, erasure.RequestedAt.UTC(), erasure.EraseAfter.UTC(), erasure.KeepArticles, erasure.KeepReviews).
+		Scan(&erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+}
+
+func (s *SQLitePrivacyStore) GetErasure(ctx context.Context, userID int64) (_ *Erasure, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.GetErasure", "SELECT user_erasures")
+	defer end(&err)
+	erasure := &Erasure{}
+	query := `
+	SELECT user_id, requested_at, erase_after, keep_articles, keep_reviews FROM user_erasures WHERE user_id = ?;
+	`
+	err = s.db.QueryRowContext(ctx, query, userID).Scan(&erasure.UserID, &erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return erasure, nil
+}
+
+func (s *SQLitePrivacyStore) CancelErasure(ctx context.Context, userID int64) (_ bool, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.CancelErasure", "DELETE user_erasures")
+	defer end(&err)
+	result, err := s.db.ExecContext(ctx, `
+	DELETE FROM user_erasures WHERE user_id = ?;
+	`, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *SQLitePrivacyStore) DueErasures(ctx context.Context, now time.Time) (_ []*Erasure, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.DueErasures", "SELECT user_erasures")
+	defer end(&err)
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT user_id, requested_at, erase_after, keep_articles, keep_reviews FROM user_erasures WHERE erase_after <= ? ORDER BY erase_after;
+	`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	erasures := []*Erasure{}
+	for rows.Next() {
+		erasure := &Erasure{}
+		err = rows.Scan(&erasure.UserID, &erasure.RequestedAt, &erasure.EraseAfter, &erasure.KeepArticles, &erasure.KeepReviews)
+		if err != nil {
+			return nil, err
+		}
+		erasures = append(erasures, erasure)
+	}
+	return erasures, rows.Err()
+}
+
+func (s *SQLitePrivacyStore) EraseUser(ctx context.Context, erasure *Erasure) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "PrivacyStore.EraseUser", "DELETE users")
+	defer end(&err)
+	hash, err := erasedPasswordHash(s.hasher)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// failed logins are keyed by email, they would keep it after the erasure
+	var email string
+	err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = ?;`, erasure.UserID).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_failures WHERE key IN (?, ?);`,
+		AccountFailureKey(email), MFAFailureKey(erasure.UserID))
+	if err != nil {
+		return err
+	}
+
+	if !erasure.KeepArticles && !erasure.KeepReviews {
+		result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ?;`, erasure.UserID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+		}
+		return tx.Commit()
+	}
+
+	statements := []string{
+		`DELETE FROM tokens WHERE user_id = ?;`,
+		`DELETE FROM user_totp WHERE user_id = ?;`,
+		`DELETE FROM recovery_codes WHERE user_id = ?;`,
+		`DELETE FROM password_history WHERE user_id = ?;`,
+		`DELETE FROM user_erasures WHERE user_id = ?;`,
+	}
+	if !erasure.KeepArticles {
+		statements = append(statements, `DELETE FROM articles WHERE author_id = ?;`)
+	}
+	if !erasure.KeepReviews {
+		statements = append(statements, `DELETE FROM reviews WHERE author_id = ?;`)
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, erasure.UserID)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := tx.ExecContext(ctx, `
+	UPDATE users SET email = ?, firstname = ?, lastname = '', password_hash = ?, is_admin = FALSE, disabled = TRUE, updated_at = ?
+	WHERE id = ?;
+	`, ErasedEmail(erasure.UserID), ErasedUser, hash, sqliteNow(), erasure.UserID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("user with ID %d %w", erasure.UserID, ErrNotFound)
+	}
+	return tx.Commit()
+}
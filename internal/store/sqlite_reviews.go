@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+type SQLiteReviewStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLiteReviewStore(db *sql.DB, queryTimeout time.Duration) *SQLiteReviewStore {
+	return &SQLiteReviewStore{db: db, queryTimeout: queryTimeout}
+}
+
+func (s *SQLiteReviewStore) CreateReview(ctx context.Context, review *Review) (_ *Review, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.CreateReview", "INSERT reviews")
+	defer end(&err)
+	v := validator.New()
+	ValidateReview(v, review)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	now := sqliteNow()
+	query := `
+	INSERT INTO reviews (article_id, author_id, stars, note, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`
+	err = s.db.QueryRowContext(ctx, query, review.ArticleID, review.AuthorID, review.Stars, review.Note, now, now).Scan(&review.ID)
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// CreateReviews inserts the reviews in one transaction with a prepared
+// statement
+func (s *SQLiteReviewStore) CreateReviews(ctx context.Context, reviews []*Review) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.CreateReviews", "INSERT reviews")
+	defer end(&err)
+	v := validator.New()
+	for _, review := range reviews {
+		ValidateReview(v, review)
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if len(reviews) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO reviews (article_id, author_id, stars, note, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := sqliteNow()
+	for _, review := range reviews {
+		err = stmt.QueryRowContext(ctx, review.ArticleID, review.AuthorID, review.Stars, review.Note, now, now).Scan(&review.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteReviewStore) UpdateReview(ctx context.Context, review *Review) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.UpdateReview", "UPDATE reviews")
+	defer end(&err)
+	query := `
+	UPDATE reviews SET stars = ?, note = ?, updated_at = ? WHERE id = ?;
+	`
+	result, err := s.db.ExecContext(ctx, query, review.Stars, review.Note, sqliteNow(), review.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("review with ID %d %w", review.ID, ErrNotFound)
+	}
+	return nil
+}
+
+func sqliteScanReview(row *sql.Row) (*Review, error) {
+	review := &Review{}
+	err := row.Scan(&review.ID, &review.Stars, &review.Note, &review.AuthorID, &review.ArticleID, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return review, nil
+}
+
+func (s *SQLiteReviewStore) GetReviewByID(ctx context.Context, id int64) (_ *Review, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.GetReviewByID", "SELECT reviews")
+	defer end(&err)
+	query := `
+	SELECT id, stars, note, author_id, article_id, created_at, updated_at FROM reviews WHERE id = ?;
+	`
+	return sqliteScanReview(s.db.QueryRowContext(ctx, query, id))
+}
+
+func (s *SQLiteReviewStore) DeleteReview(ctx context.Context, id int64) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.DeleteReview", "DELETE reviews")
+	defer end(&err)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM reviews WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("review with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLiteReviewStore) GetReviewByUserAndArticle(ctx context.Context, userID, articleID int64) (_ *Review, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "ReviewStore.GetReviewByUserAndArticle", "SELECT reviews")
+	defer end(&err)
+	query := `
+	SELECT id, stars, note, author_id, article_id, created_at, updated_at
+	FROM reviews WHERE author_id = ? AND article_id = ?;
+	`
+	return sqliteScanReview(s.db.QueryRowContext(ctx, query, userID, articleID))
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+type SQLiteTokenStore struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewSQLiteTokenStore(db *sql.DB, queryTimeout time.Duration) *SQLiteTokenStore {
+	return &SQLiteTokenStore{db: db, queryTimeout: queryTimeout}
+}
+
+func (s *SQLiteTokenStore) CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (_ *tokens.Token, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.CreateNewToken", "INSERT tokens")
+	defer end(&err)
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Insert(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *SQLiteTokenStore) Insert(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.Insert", "INSERT tokens")
+	defer end(&err)
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope) VALUES (?, ?, ?, ?);
+	`
+	_, err = s.db.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry.UTC(), token.Scope)
+	return err
+}
+
+func (s *SQLiteTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.DeleteAllTokensForUser", "DELETE tokens")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ? AND scope = ?;`, userID, scope)
+	return err
+}
+
+func (s *SQLiteTokenStore) DeleteToken(ctx context.Context, hash []byte) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.DeleteToken", "DELETE tokens")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `DELETE FROM tokens WHERE hash = ?;`, hash)
+	return err
+}
+
+// DeleteExpiredTokens removes tokens of every scope that can no longer be
+// used, along with revocations of signed tokens that have expired
+func (s *SQLiteTokenStore) DeleteExpiredTokens(ctx context.Context) (_ int64, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.DeleteExpiredTokens", "DELETE tokens")
+	defer end(&err)
+	now := sqliteNow()
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM tokens WHERE expiry < ?;`,
+		`DELETE FROM revoked_tokens WHERE expiry < ?;`,
+		`DELETE FROM user_token_revocations WHERE expiry < ?;`,
+	} {
+		result, err := s.db.ExecContext(ctx, query, now)
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// RevokeJWT records the ID of a signed token that must no longer be accepted
+func (s *SQLiteTokenStore) RevokeJWT(ctx context.Context, id string, expiry time.Time) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.RevokeJWT", "INSERT revoked_tokens")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `INSERT OR IGNORE INTO revoked_tokens (jti, expiry) VALUES (?, ?);`, id, expiry.UTC())
+	return err
+}
+
+// RevokeUserJWTs revokes every signed token issued to the user before
+// issuedBefore, a later revocation replaces an earlier one
+func (s *SQLiteTokenStore) RevokeUserJWTs(ctx context.Context, userID int64, issuedBefore, expiry time.Time) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.RevokeUserJWTs", "INSERT user_token_revocations")
+	defer end(&err)
+	query := `
+	INSERT INTO user_token_revocations (user_id, issued_before, expiry) VALUES (?1, ?2, ?3)
+	ON CONFLICT (user_id) DO UPDATE SET
+		issued_before = MAX(issued_before, excluded.issued_before),
+		expiry = MAX(expiry, excluded.expiry);
+	`
+	_, err = s.db.ExecContext(ctx, query, userID, issuedBefore.UTC(), expiry.UTC())
+	return err
+}
+
+// RevokedJWTs returns the revocations of signed tokens that have not expired yet
+func (s *SQLiteTokenStore) RevokedJWTs(ctx context.Context) (_ *tokens.Revocations, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.RevokedJWTs", "SELECT revoked_tokens")
+	defer end(&err)
+	now := sqliteNow()
+	revocations := &tokens.Revocations{IDs: map[string]time.Time{}, Users: map[int64]tokens.UserRevocation{}}
+	rows, err := s.db.QueryContext(ctx, `SELECT jti, expiry FROM revoked_tokens WHERE expiry > ?;`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var expiry time.Time
+		err = rows.Scan(&id, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		revocations.IDs[id] = expiry
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT user_id, issued_before, expiry FROM user_token_revocations WHERE expiry > ?;`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int64
+		var user tokens.UserRevocation
+		err = rows.Scan(&userID, &user.IssuedBefore, &user.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		revocations.Users[userID] = user
+	}
+	return revocations, rows.Err()
+}
+
+func (s *SQLiteTokenStore) GetToken(ctx context.Context, hash []byte) (_ *tokens.Token, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "TokenStore.GetToken", "SELECT tokens")
+	defer end(&err)
+	token := &tokens.Token{}
+	query := `
+	SELECT hash, user_id, expiry, scope FROM tokens WHERE hash = ?;
+	`
+	err = s.db.QueryRowContext(ctx, query, hash).Scan(&token.Hash, &token.UserID, &token.Expiry, &token.Scope)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
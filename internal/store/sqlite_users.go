@@ -0,0 +1,340 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+)
+
+type SQLiteUserStore struct {
+	db           *sql.DB
+	hasher       passwords.Hasher
+	queryTimeout time.Duration
+}
+
+// NewSQLiteUserStore creates a SQLiteUserStore, hasher hashes the passwords
+// set with UpdatePassword
+func NewSQLiteUserStore(db *sql.DB, hasher passwords.Hasher, queryTimeout time.Duration) *SQLiteUserStore {
+	return &SQLiteUserStore{db: db, hasher: hasher, queryTimeout: queryTimeout}
+}
+
+func (s *SQLiteUserStore) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.CreateUser", "INSERT users")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := sqliteNow()
+	query := `
+	INSERT INTO users (email, password_hash, firstname, lastname, is_admin, disabled, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+	`
+	err = tx.QueryRowContext(ctx, query, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName, user.IsAdmin, user.Disabled, now, now).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with email %q %w", user.Email, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	err = sqliteRecordPasswordHistory(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateUsers inserts the users in one transaction with prepared statements
+func (s *SQLiteUserStore) CreateUsers(ctx context.Context, users []*User) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.CreateUsers", "INSERT users")
+	defer end(&err)
+	if len(users) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO users (email, password_hash, firstname, lastname, is_admin, disabled, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := sqliteNow()
+	for _, user := range users {
+		err = stmt.QueryRowContext(ctx, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName, user.IsAdmin, user.Disabled, now, now).Scan(&user.ID)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("user with email %q %w", user.Email, ErrConflict)
+		}
+		if err != nil {
+			return err
+		}
+		err = sqliteRecordPasswordHistory(ctx, tx, user)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func sqliteRecordPasswordHistory(ctx context.Context, tx *sql.Tx, user *User) error {
+	if !user.PasswordHash.Changed() {
+		return nil
+	}
+	query := `
+	INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?);
+	`
+	_, err := tx.ExecContext(ctx, query, user.ID, user.PasswordHash.hash, sqliteNow())
+	return err
+}
+
+// PasswordUsedRecently compares the password with the last limit passwords
+// of the user, the current one included. The newest history row is the
+// current password, it is skipped as the current hash is checked anyway,
+// also for imported accounts that have no history.
+func (s *SQLiteUserStore) PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (_ bool, err error) {
+	if limit <= 0 {
+		return false, nil
+	}
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.PasswordUsedRecently", "SELECT users password_history")
+	defer end(&err)
+	query := `
+	SELECT password_hash FROM users WHERE id = ?1
+	UNION ALL
+	SELECT * FROM (SELECT password_hash FROM password_history WHERE user_id = ?1 ORDER BY created_at DESC, id DESC LIMIT ?2 OFFSET 1);
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, limit-1)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		err = rows.Scan(&hash)
+		if err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	err = rows.Err()
+	if err != nil {
+		return false, err
+	}
+	// hashing is slow, so the connection is given back before comparing
+	rows.Close()
+	for _, hash := range hashes {
+		previous := password{hash: hash}
+		matches, err := previous.Matches(plaintextPassword)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sqliteScanUser scans the columns selected by the user queries, queries
+// that need the password select password_hash last
+func sqliteScanUser(row *sql.Row, withPassword bool) (*User, error) {
+	user := &User{PasswordHash: password{}}
+	dest := []any{&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt}
+	if withPassword {
+		dest = append(dest, &user.PasswordHash.hash)
+	}
+	err := row.Scan(dest...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLiteUserStore) GetUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.GetUserByID", "SELECT users")
+	defer end(&err)
+	query := `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at FROM users WHERE id = ?;
+	`
+	return sqliteScanUser(s.db.QueryRowContext(ctx, query, id), false)
+}
+
+func (s *SQLiteUserStore) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.GetUserByEmail", "SELECT users")
+	defer end(&err)
+	query := `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at, password_hash FROM users WHERE email = ?;
+	`
+	return sqliteScanUser(s.db.QueryRowContext(ctx, query, email), true)
+}
+
+func (s *SQLiteUserStore) GetUserWithPasswordByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.GetUserWithPasswordByID", "SELECT users")
+	defer end(&err)
+	query := `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at, password_hash FROM users WHERE id = ?;
+	`
+	return sqliteScanUser(s.db.QueryRowContext(ctx, query, id), true)
+}
+
+func (s *SQLiteUserStore) UpdateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.UpdateUser", "UPDATE users")
+	defer end(&err)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `
+	UPDATE users SET email = ?, password_hash = COALESCE(?, password_hash), firstname = ?, lastname = ?, updated_at = ?
+	WHERE id = ?;
+	`
+	// users loaded without their hash must not wipe it
+	var hash any
+	if user.PasswordHash.Changed() {
+		hash = user.PasswordHash.hash
+	}
+	result, err := tx.ExecContext(ctx, query, user.Email, hash, user.FirstName, user.LastName, sqliteNow(), user.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with email %q %w", user.Email, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", user.ID, ErrNotFound)
+	}
+	err = sqliteRecordPasswordHistory(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePasswordHash stores a new hash of the same password, as done when
+// rehashing on login, so nothing is added to the password history
+func (s *SQLiteUserStore) UpdatePasswordHash(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.UpdatePasswordHash", "UPDATE users")
+	defer end(&err)
+	_, err = s.db.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?;`, user.PasswordHash.hash, user.ID)
+	return err
+}
+
+func (s *SQLiteUserStore) DeleteUser(ctx context.Context, id int64) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.DeleteUser", "DELETE users")
+	defer end(&err)
+	result, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?;`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (s *SQLiteUserStore) UpdatePassword(ctx context.Context, userID int64, newPassword string) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.UpdatePassword", "UPDATE users")
+	defer end(&err)
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := sqliteNow()
+	result, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?;`, hashedPassword, now, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?);`, userID, hashedPassword, now)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteUserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (_ *User, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.GetUserToken", "SELECT users tokens")
+	defer end(&err)
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+	query := `
+	SELECT u.id, u.email, u.firstname, u.lastname, u.is_admin, u.disabled, u.created_at, u.updated_at
+	FROM users u
+	INNER JOIN tokens t ON u.id = t.user_id
+	WHERE t.hash = ? AND t.scope = ? AND t.expiry > ? AND NOT u.disabled;
+	`
+	return sqliteScanUser(s.db.QueryRowContext(ctx, query, tokenHash[:], scope, sqliteNow()), false)
+}
+
+// ListUsers returns every user ordered by ID, without password hashes
+func (s *SQLiteUserStore) ListUsers(ctx context.Context) (_ []*User, err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.ListUsers", "SELECT users")
+	defer end(&err)
+	query := `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at FROM users ORDER BY id;
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		user := &User{PasswordHash: password{}}
+		err = rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLiteUserStore) SetUserDisabled(ctx context.Context, id int64, disabled bool) (err error) {
+	ctx, end := startSQLiteQuery(ctx, s.queryTimeout, "UserStore.SetUserDisabled", "UPDATE users")
+	defer end(&err)
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET disabled = ?, updated_at = ? WHERE id = ?;`, disabled, sqliteNow(), id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -1,24 +1,31 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"testing"
+	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/migrations"
 )
 
-func setupTestDB(t *testing.T) *sql.DB {
-	db, err := sql.Open("pgx", "host=localhost port=5432 user=postgres password=postgres dbname=articles sslmode=disable")
+const testQueryTimeout = 5 * time.Second
+
+func setupTestDB(t *testing.T) *pgxpool.Pool {
+	db, err := Open(context.Background(), "host=localhost port=5432 user=postgres password=postgres dbname=articles sslmode=disable", PoolOptions{})
 	if err != nil {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
-	err = Migrate(db, "../../migrations")
+	database := &Database{Driver: DriverPostgres, Pool: db}
+	err = database.Migrate(context.Background(), migrations.FS)
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
 	}
-	_, err = db.Exec("TRUNCATE TABLE users, articles, paragraphs CASCADE")
+	_, err = db.Exec(context.Background(), "TRUNCATE TABLE users, articles, paragraphs CASCADE")
 	if err != nil {
 		t.Fatalf("Failed to truncate tables: %v", err)
 	}
@@ -29,7 +36,7 @@ func TestCreateArticle(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	store := NewPostgresArticleStore(db)
+	store := NewPostgresArticleStore(db, testQueryTimeout)
 
 	tests := []struct {
 		name    string
@@ -94,7 +101,7 @@ func TestCreateArticle(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			createdArticle, err := store.CreateArticle(tt.article)
+			createdArticle, err := store.CreateArticle(context.Background(), tt.article)
 			if tt.wantErr {
 				assert.Error(t, err, "Expected error but got none")
 				return
@@ -122,7 +129,7 @@ func TestCreateUser(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
 
-	store := NewPostgresUserStore(db)
+	store := NewPostgresUserStore(db, passwords.DefaultHasher, testQueryTimeout)
 
 	tests := []struct {
 		name    string
@@ -150,10 +157,10 @@ func TestCreateUser(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.user.PasswordHash.Set("test_password"); err != nil {
+			if err := tt.user.PasswordHash.Set(passwords.DefaultHasher, "test_password"); err != nil {
 				t.Fatalf("Failed to set password: %v", err)
 			}
-			err := store.CreateUser(tt.user)
+			err := store.CreateUser(context.Background(), tt.user)
 			if tt.wantErr {
 				assert.Error(t, err, "Expected error but got none")
 				return
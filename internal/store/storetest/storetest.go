@@ -0,0 +1,909 @@
+// Package storetest checks that an implementation of the store interfaces
+// behaves like the Postgres one. Every backend runs the same suite.
+package storetest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/tokens"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+// Stores are the implementations under test, they must share one database
+type Stores struct {
+	Articles store.ArticleStore
+	Users    store.UserStore
+	Reviews  store.ReviewStore
+	Tokens   store.TokenStore
+	Privacy  store.PrivacyStore
+	MFA      store.MFAStore
+
+	LoginFailures store.LoginFailureStore
+	// Dump exports and imports whole tables, it is nil for backends that
+	// cannot, their dump checks are skipped
+	Dump Dumper
+}
+
+// Dumper is implemented by *store.Database
+type Dumper interface {
+	ReadDump(ctx context.Context, fn func(store.DumpReader) error) error
+	WriteDump(ctx context.Context, commit bool, fn func(store.DumpWriter) error) error
+}
+
+// Hasher is the cheapest hash, it keeps the suite fast and the algorithm
+// doesn't matter here. The stores under test should hash with it too.
+var Hasher = passwords.Hasher{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 4}
+
+// Run runs the suite, newStores is called once per test and must return
+// stores backed by an empty database
+func Run(t *testing.T, newStores func(t *testing.T) Stores) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newStores(t)) })
+	t.Run("PasswordHistory", func(t *testing.T) { testPasswordHistory(t, newStores(t)) })
+	t.Run("Articles", func(t *testing.T) { testArticles(t, newStores(t)) })
+	t.Run("ArticleParagraphDiff", func(t *testing.T) { testParagraphDiff(t, newStores(t)) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, newStores(t)) })
+	t.Run("BulkInserts", func(t *testing.T) { testBulkInserts(t, newStores(t)) })
+	t.Run("Tokens", func(t *testing.T) { testTokens(t, newStores(t)) })
+	t.Run("RevokedJWTs", func(t *testing.T) { testRevokedJWTs(t, newStores(t)) })
+	t.Run("DisabledUsers", func(t *testing.T) { testDisabledUsers(t, newStores(t)) })
+	t.Run("Cascades", func(t *testing.T) { testCascades(t, newStores(t)) })
+	t.Run("UserData", func(t *testing.T) { testUserData(t, newStores(t)) })
+	t.Run("LoginFailures", func(t *testing.T) { testLoginFailures(t, newStores(t)) })
+	t.Run("MFA", func(t *testing.T) { testMFA(t, newStores(t)) })
+	t.Run("Dump", func(t *testing.T) { testDump(t, newStores(t)) })
+	t.Run("Erasures", func(t *testing.T) { testErasures(t, newStores(t)) })
+	t.Run("EraseKeepingContent", func(t *testing.T) { testEraseKeepingContent(t, newStores(t)) })
+}
+
+func createUser(t *testing.T, s Stores, email string) *store.User {
+	t.Helper()
+	user := &store.User{Email: email, FirstName: "John", LastName: "Doe"}
+	require.NoError(t, user.PasswordHash.Set(Hasher, "Secret123"))
+	require.NoError(t, s.Users.CreateUser(context.Background(), user))
+	require.NotZero(t, user.ID)
+	return user
+}
+
+func createArticle(t *testing.T, s Stores, authorID int, paragraphs ...store.Paraghraph) *store.Article {
+	t.Helper()
+	article := &store.Article{Title: "Title", Description: "Description", Image: "image.png", AuthorID: authorID, Paraghraps: paragraphs}
+	_, err := s.Articles.CreateArticle(context.Background(), article)
+	require.NoError(t, err)
+	require.NotZero(t, article.ID)
+	return article
+}
+
+func testUsers(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "john@example.com")
+
+	duplicate := &store.User{Email: "john@example.com", FirstName: "Other", LastName: "User"}
+	require.NoError(t, duplicate.PasswordHash.Set(Hasher, "Secret123"))
+	err := s.Users.CreateUser(ctx, duplicate)
+	assert.ErrorIs(t, err, store.ErrConflict, "emails are unique")
+
+	admin := &store.User{Email: "admin@example.com", FirstName: "Ada", LastName: "Admin", IsAdmin: true}
+	require.NoError(t, admin.PasswordHash.Set(Hasher, "Secret123"))
+	require.NoError(t, s.Users.CreateUser(ctx, admin))
+	stored, err := s.Users.GetUserByID(ctx, int64(admin.ID))
+	require.NoError(t, err)
+	assert.True(t, stored.IsAdmin)
+
+	missing, err := s.Users.GetUserByID(ctx, int64(user.ID)+1000)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	missing, err = s.Users.GetUserByEmail(ctx, "nobody@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	byEmail, err := s.Users.GetUserByEmail(ctx, "john@example.com")
+	require.NoError(t, err)
+	require.NotNil(t, byEmail)
+	assert.Equal(t, user.ID, byEmail.ID)
+	matches, err := byEmail.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	// updating a user loaded without its hash keeps the password
+	byID, err := s.Users.GetUserByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	require.NotNil(t, byID)
+	byID.FirstName = "Johnny"
+	require.NoError(t, s.Users.UpdateUser(ctx, byID))
+	withPassword, err := s.Users.GetUserWithPasswordByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "Johnny", withPassword.FirstName)
+	matches, err = withPassword.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	require.NoError(t, s.Users.UpdatePassword(ctx, int64(user.ID), "Changed456"))
+	withPassword, err = s.Users.GetUserWithPasswordByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	matches, err = withPassword.PasswordHash.Matches("Changed456")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	err = s.Users.UpdateUser(ctx, &store.User{ID: user.ID + 1000, Email: "ghost@example.com"})
+	assert.EqualError(t, err, "user with ID "+strconv.Itoa(user.ID+1000)+" not found")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	require.NoError(t, s.Users.DeleteUser(ctx, int64(user.ID)))
+	deleted, err := s.Users.GetUserByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+	assert.EqualError(t, s.Users.DeleteUser(ctx, int64(user.ID)), "user with ID "+strconv.Itoa(user.ID)+" not found")
+}
+
+func testPasswordHistory(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "jane@example.com")
+	require.NoError(t, s.Users.UpdatePassword(ctx, int64(user.ID), "Second123"))
+	require.NoError(t, s.Users.UpdatePassword(ctx, int64(user.ID), "Third123"))
+
+	// the limit counts the current password, so it is the newest of them
+	check := func() {
+		t.Helper()
+		for _, tt := range []struct {
+			password string
+			limit    int
+			want     bool
+		}{
+			{password: "Third123", limit: 0, want: false},
+			{password: "Third123", limit: 1, want: true},
+			{password: "Second123", limit: 1, want: false},
+			{password: "Second123", limit: 2, want: true},
+			{password: "Secret123", limit: 2, want: false},
+			{password: "Secret123", limit: 3, want: true},
+			{password: "Never123", limit: 5, want: false},
+		} {
+			used, err := s.Users.PasswordUsedRecently(ctx, int64(user.ID), tt.password, tt.limit)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, used, "%s with limit %d", tt.password, tt.limit)
+		}
+	}
+	check()
+
+	// rehashing on login stores a new hash of the same password, the window
+	// stays the same
+	current, err := s.Users.GetUserWithPasswordByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	require.NoError(t, current.PasswordHash.Set(Hasher, "Third123"))
+	require.NoError(t, s.Users.UpdatePasswordHash(ctx, current))
+	check()
+}
+
+func testArticles(t *testing.T, s Stores) {
+	ctx := context.Background()
+	author := createUser(t, s, "author@example.com")
+
+	_, err := s.Articles.CreateArticle(ctx, &store.Article{Title: "Orphan", AuthorID: author.ID + 1000})
+	assert.Error(t, err, "the author must exist")
+
+	article := createArticle(t, s, author.ID,
+		store.Paraghraph{Headline: "Second", Body: "b", OrderIndex: 2},
+		store.Paraghraph{Headline: "First", Body: "a", OrderIndex: 1},
+	)
+	for _, paragraph := range article.Paraghraps {
+		assert.NotZero(t, paragraph.ID)
+	}
+
+	loaded, err := s.Articles.GetArticleByID(ctx, int64(article.ID))
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, "Title", loaded.Title)
+	require.Len(t, loaded.Paraghraps, 2)
+	assert.Equal(t, "First", loaded.Paraghraps[0].Headline, "paragraphs come in reading order")
+
+	missing, err := s.Articles.GetArticleByID(ctx, int64(article.ID)+1000)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	exists, err := s.Articles.ArticleExists(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.True(t, exists)
+	authorID, err := s.Articles.GetArticleAuthorID(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.Equal(t, int64(author.ID), authorID)
+	_, err = s.Articles.GetArticleAuthorID(ctx, int64(article.ID)+1000)
+	assert.EqualError(t, err, "article not found")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	err = s.Articles.UpdateArticle(ctx, &store.Article{ID: article.ID + 1000, AuthorID: author.ID})
+	assert.EqualError(t, err, "article with ID "+strconv.Itoa(article.ID+1000)+" not found")
+
+	require.NoError(t, s.Articles.DeleteArticle(ctx, int64(article.ID)))
+	exists, err = s.Articles.ArticleExists(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.EqualError(t, s.Articles.DeleteArticle(ctx, int64(article.ID)), "article with ID "+strconv.Itoa(article.ID)+" not found")
+}
+
+func testParagraphDiff(t *testing.T, s Stores) {
+	ctx := context.Background()
+	author := createUser(t, s, "writer@example.com")
+	article := createArticle(t, s, author.ID,
+		store.Paraghraph{Headline: "Keep", Body: "same", OrderIndex: 1},
+		store.Paraghraph{Headline: "Change", Body: "old", OrderIndex: 2},
+		store.Paraghraph{Headline: "Drop", Body: "gone", OrderIndex: 3},
+	)
+	stored, err := s.Articles.GetArticleByID(ctx, int64(article.ID))
+	require.NoError(t, err)
+	kept, changed := stored.Paraghraps[0], stored.Paraghraps[1]
+
+	changed.Body = "new"
+	stored.Title = "New title"
+	stored.Paraghraps = []store.Paraghraph{
+		kept,
+		changed,
+		{Headline: "Added", Body: "fresh", OrderIndex: 3},
+	}
+	require.NoError(t, s.Articles.UpdateArticle(ctx, stored))
+
+	updated, err := s.Articles.GetArticleByID(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "New title", updated.Title)
+	require.Len(t, updated.Paraghraps, 3)
+	assert.Equal(t, kept.ID, updated.Paraghraps[0].ID)
+	assert.True(t, kept.UpdatedAt.Equal(updated.Paraghraps[0].UpdatedAt), "unchanged rows are not written")
+	assert.Equal(t, changed.ID, updated.Paraghraps[1].ID)
+	assert.Equal(t, "new", updated.Paraghraps[1].Body)
+	assert.True(t, changed.CreatedAt.Equal(updated.Paraghraps[1].CreatedAt))
+	assert.NotZero(t, updated.Paraghraps[2].ID)
+	assert.Equal(t, "Added", updated.Paraghraps[2].Headline)
+
+	other := createArticle(t, s, author.ID, store.Paraghraph{Headline: "Other", OrderIndex: 1})
+	updated.Paraghraps = append(updated.Paraghraps, other.Paraghraps[0])
+	err = s.Articles.UpdateArticle(ctx, updated)
+	assert.ErrorIs(t, err, store.ErrUnknownParagraph)
+}
+
+func testReviews(t *testing.T, s Stores) {
+	ctx := context.Background()
+	author := createUser(t, s, "author@example.com")
+	reader := createUser(t, s, "reader@example.com")
+	article := createArticle(t, s, author.ID)
+
+	_, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(article.ID), AuthorID: int64(reader.ID), Stars: 6})
+	var fieldErrs validator.Errors
+	require.ErrorAs(t, err, &fieldErrs)
+	assert.Equal(t, "stars", fieldErrs[0].Field)
+	_, err = s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(article.ID) + 1000, AuthorID: int64(reader.ID), Stars: 3})
+	assert.Error(t, err, "the article must exist")
+
+	note := "Great read"
+	review, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(article.ID), AuthorID: int64(reader.ID), Stars: 4, Note: &note})
+	require.NoError(t, err)
+	require.NotZero(t, review.ID)
+
+	loaded, err := s.Reviews.GetReviewByID(ctx, review.ID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, 4, loaded.Stars)
+	assert.Equal(t, int64(reader.ID), loaded.AuthorID)
+	assert.Equal(t, int64(article.ID), loaded.ArticleID)
+	require.NotNil(t, loaded.Note)
+	assert.Equal(t, note, *loaded.Note)
+
+	byUser, err := s.Reviews.GetReviewByUserAndArticle(ctx, int64(reader.ID), int64(article.ID))
+	require.NoError(t, err)
+	require.NotNil(t, byUser)
+	assert.Equal(t, review.ID, byUser.ID)
+	none, err := s.Reviews.GetReviewByUserAndArticle(ctx, int64(author.ID), int64(article.ID))
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	loaded.Stars = 5
+	loaded.Note = nil
+	require.NoError(t, s.Reviews.UpdateReview(ctx, loaded))
+	updated, err := s.Reviews.GetReviewByID(ctx, review.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, updated.Stars)
+	assert.Nil(t, updated.Note)
+
+	require.NoError(t, s.Reviews.DeleteReview(ctx, review.ID))
+	missing, err := s.Reviews.GetReviewByID(ctx, review.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	assert.EqualError(t, s.Reviews.DeleteReview(ctx, review.ID), "review with ID "+strconv.Itoa(int(review.ID))+" not found")
+	assert.EqualError(t, s.Reviews.UpdateReview(ctx, loaded), "review with ID "+strconv.Itoa(int(review.ID))+" not found")
+}
+
+func testBulkInserts(t *testing.T, s Stores) {
+	ctx := context.Background()
+	existing := createUser(t, s, "existing@example.com")
+
+	users := []*store.User{
+		{Email: "first@example.com", FirstName: "First", LastName: "User"},
+		{Email: "second@example.com", FirstName: "Second", LastName: "User"},
+	}
+	for _, user := range users {
+		require.NoError(t, user.PasswordHash.Set(Hasher, "Secret123"))
+	}
+	taken := &store.User{Email: existing.Email, FirstName: "Taken", LastName: "User"}
+	require.NoError(t, taken.PasswordHash.Set(Hasher, "Secret123"))
+	fresh := &store.User{Email: "rolled-back@example.com", FirstName: "Fresh", LastName: "User"}
+	require.NoError(t, fresh.PasswordHash.Set(Hasher, "Secret123"))
+	err := s.Users.CreateUsers(ctx, []*store.User{fresh, taken})
+	assert.ErrorIs(t, err, store.ErrConflict)
+	rolledBack, err := s.Users.GetUserByEmail(ctx, "rolled-back@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, rolledBack, "a failed batch inserts nothing")
+
+	require.NoError(t, s.Users.CreateUsers(ctx, users))
+	for _, user := range users {
+		require.NotZero(t, user.ID)
+		loaded, err := s.Users.GetUserWithPasswordByID(ctx, int64(user.ID))
+		require.NoError(t, err)
+		require.NotNil(t, loaded)
+		assert.Equal(t, user.Email, loaded.Email)
+		matches, err := loaded.PasswordHash.Matches("Secret123")
+		require.NoError(t, err)
+		assert.True(t, matches)
+		used, err := s.Users.PasswordUsedRecently(ctx, int64(user.ID), "Secret123", 1)
+		require.NoError(t, err)
+		assert.True(t, used, "the password is recorded in the history")
+	}
+
+	articles := []*store.Article{
+		{Title: "One", Description: "First", AuthorID: users[0].ID, Paraghraps: []store.Paraghraph{
+			{Headline: "B", Body: "b", OrderIndex: 2},
+			{Headline: "A", Body: "a", OrderIndex: 1},
+		}},
+		{Title: "Two", AuthorID: users[1].ID},
+	}
+	err = s.Articles.CreateArticles(ctx, []*store.Article{{Title: "Orphan", AuthorID: users[1].ID + 1000}})
+	assert.Error(t, err, "the author must exist")
+	require.NoError(t, s.Articles.CreateArticles(ctx, articles))
+	require.NotZero(t, articles[0].ID)
+	assert.NotEqual(t, articles[0].ID, articles[1].ID)
+	assert.NotZero(t, articles[0].Paraghraps[0].ID)
+	loaded, err := s.Articles.GetArticleByID(ctx, int64(articles[0].ID))
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, "One", loaded.Title)
+	assert.Equal(t, users[0].ID, loaded.AuthorID)
+	require.Len(t, loaded.Paraghraps, 2)
+	assert.Equal(t, "A", loaded.Paraghraps[0].Headline)
+	loaded, err = s.Articles.GetArticleByID(ctx, int64(articles[1].ID))
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Empty(t, loaded.Paraghraps)
+
+	note := "Solid"
+	reviews := []*store.Review{
+		{ArticleID: int64(articles[0].ID), AuthorID: int64(users[1].ID), Stars: 5, Note: &note},
+		{ArticleID: int64(articles[1].ID), AuthorID: int64(users[0].ID), Stars: 2},
+	}
+	err = s.Reviews.CreateReviews(ctx, []*store.Review{{ArticleID: int64(articles[0].ID), AuthorID: int64(existing.ID), Stars: 0}})
+	var fieldErrs validator.Errors
+	require.ErrorAs(t, err, &fieldErrs)
+	err = s.Reviews.CreateReviews(ctx, []*store.Review{{ArticleID: int64(articles[1].ID) + 1000, AuthorID: int64(existing.ID), Stars: 3}})
+	assert.Error(t, err, "the article must exist")
+	require.NoError(t, s.Reviews.CreateReviews(ctx, reviews))
+	for _, review := range reviews {
+		require.NotZero(t, review.ID)
+		stored, err := s.Reviews.GetReviewByUserAndArticle(ctx, review.AuthorID, review.ArticleID)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, review.ID, stored.ID)
+		assert.Equal(t, review.Stars, stored.Stars)
+	}
+	require.NoError(t, s.Reviews.CreateReviews(ctx, nil), "an empty batch is a no-op")
+}
+
+func testTokens(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "token@example.com")
+
+	token, err := s.Tokens.CreateNewToken(ctx, int64(user.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	owner, err := s.Users.GetUserToken(ctx, tokens.ScopeAuth, token.PlainText)
+	require.NoError(t, err)
+	require.NotNil(t, owner)
+	assert.Equal(t, user.ID, owner.ID)
+
+	wrongScope, err := s.Users.GetUserToken(ctx, tokens.ScopeResetPassword, token.PlainText)
+	require.NoError(t, err)
+	assert.Nil(t, wrongScope)
+
+	stored, err := s.Tokens.GetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, int64(user.ID), stored.UserID)
+	assert.Equal(t, tokens.ScopeAuth, stored.Scope)
+
+	expired, err := s.Tokens.CreateNewToken(ctx, int64(user.ID), -time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	owner, err = s.Users.GetUserToken(ctx, tokens.ScopeAuth, expired.PlainText)
+	require.NoError(t, err)
+	assert.Nil(t, owner, "expired tokens don't authenticate")
+	deleted, err := s.Tokens.DeleteExpiredTokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	require.NoError(t, s.Tokens.DeleteToken(ctx, token.Hash))
+	missing, err := s.Tokens.GetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	reset, err := s.Tokens.CreateNewToken(ctx, int64(user.ID), time.Hour, tokens.ScopeResetPassword)
+	require.NoError(t, err)
+	require.NoError(t, s.Tokens.DeleteAllTokensForUser(ctx, int64(user.ID), tokens.ScopeResetPassword))
+	missing, err = s.Tokens.GetToken(ctx, reset.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	_, err = s.Tokens.CreateNewToken(ctx, int64(user.ID)+1000, time.Hour, tokens.ScopeAuth)
+	assert.Error(t, err, "the user must exist")
+}
+
+func testRevokedJWTs(t *testing.T, s Stores) {
+	ctx := context.Background()
+	now := time.Now()
+	expiry := now.Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, s.Tokens.RevokeJWT(ctx, "revoked", expiry))
+	require.NoError(t, s.Tokens.RevokeJWT(ctx, "revoked", expiry), "revoking twice is fine")
+	require.NoError(t, s.Tokens.RevokeJWT(ctx, "expired", now.Add(-time.Hour)))
+
+	// user 42 doesn't exist, revocations outlive erased users
+	require.NoError(t, s.Tokens.RevokeUserJWTs(ctx, 42, now.Add(-time.Minute), expiry))
+	require.NoError(t, s.Tokens.RevokeUserJWTs(ctx, 42, now, expiry))
+	require.NoError(t, s.Tokens.RevokeUserJWTs(ctx, 42, now.Add(-2*time.Minute), expiry), "an older revocation doesn't win")
+	require.NoError(t, s.Tokens.RevokeUserJWTs(ctx, 43, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+
+	revocations, err := s.Tokens.RevokedJWTs(ctx)
+	require.NoError(t, err)
+	require.Len(t, revocations.IDs, 1)
+	assert.WithinDuration(t, expiry, revocations.IDs["revoked"], time.Second)
+	require.Len(t, revocations.Users, 1)
+	assert.WithinDuration(t, now, revocations.Users[42].IssuedBefore, time.Second)
+	assert.WithinDuration(t, expiry, revocations.Users[42].Expiry, time.Second)
+
+	deleted, err := s.Tokens.DeleteExpiredTokens(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted, "expired revocations are pruned with the tokens")
+	revocations, err = s.Tokens.RevokedJWTs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, revocations.IDs, 1)
+	assert.Len(t, revocations.Users, 1)
+}
+
+func testDisabledUsers(t *testing.T, s Stores) {
+	ctx := context.Background()
+	first := createUser(t, s, "first@example.com")
+	second := createUser(t, s, "second@example.com")
+	token, err := s.Tokens.CreateNewToken(ctx, int64(second.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	users, err := s.Users.ListUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, first.ID, users[0].ID)
+	assert.Equal(t, second.Email, users[1].Email)
+	assert.False(t, users[1].Disabled)
+
+	require.NoError(t, s.Users.SetUserDisabled(ctx, int64(second.ID), true))
+	stored, err := s.Users.GetUserByID(ctx, int64(second.ID))
+	require.NoError(t, err)
+	assert.True(t, stored.Disabled)
+	owner, err := s.Users.GetUserToken(ctx, tokens.ScopeAuth, token.PlainText)
+	require.NoError(t, err)
+	assert.Nil(t, owner, "tokens of disabled users don't authenticate")
+
+	require.NoError(t, s.Users.SetUserDisabled(ctx, int64(second.ID), false))
+	owner, err = s.Users.GetUserToken(ctx, tokens.ScopeAuth, token.PlainText)
+	require.NoError(t, err)
+	require.NotNil(t, owner)
+	assert.False(t, owner.Disabled)
+
+	assert.Error(t, s.Users.SetUserDisabled(ctx, int64(second.ID)+1000, true))
+}
+
+func testCascades(t *testing.T, s Stores) {
+	ctx := context.Background()
+	author := createUser(t, s, "author@example.com")
+	reader := createUser(t, s, "reader@example.com")
+	article := createArticle(t, s, author.ID, store.Paraghraph{Headline: "Only", OrderIndex: 1})
+	review, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(article.ID), AuthorID: int64(reader.ID), Stars: 3})
+	require.NoError(t, err)
+	token, err := s.Tokens.CreateNewToken(ctx, int64(reader.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	// deleting an article removes its reviews
+	require.NoError(t, s.Articles.DeleteArticle(ctx, int64(article.ID)))
+	missing, err := s.Reviews.GetReviewByID(ctx, review.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// deleting a user removes their articles and tokens
+	article = createArticle(t, s, author.ID)
+	require.NoError(t, s.Users.DeleteUser(ctx, int64(author.ID)))
+	exists, err := s.Articles.ArticleExists(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, s.Users.DeleteUser(ctx, int64(reader.ID)))
+	gone, err := s.Tokens.GetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, gone)
+}
+
+func testUserData(t *testing.T, s Stores) {
+	ctx := context.Background()
+	author := createUser(t, s, "author@example.com")
+	other := createUser(t, s, "other@example.com")
+	article := createArticle(t, s, author.ID, store.Paraghraph{Headline: "First", Body: "Body", OrderIndex: 1})
+	createArticle(t, s, other.ID)
+	note := "Good"
+	review, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(article.ID), AuthorID: int64(author.ID), Stars: 4, Note: &note})
+	require.NoError(t, err)
+	_, err = s.Tokens.CreateNewToken(ctx, int64(author.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	_, err = s.Tokens.CreateNewToken(ctx, int64(author.ID), -time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+
+	data, err := s.Privacy.GetUserData(ctx, int64(author.ID))
+	require.NoError(t, err)
+	require.NotNil(t, data)
+	assert.Equal(t, author.Email, data.User.Email)
+	require.Len(t, data.Articles, 1)
+	assert.Equal(t, article.ID, data.Articles[0].ID)
+	require.Len(t, data.Articles[0].Paraghraps, 1)
+	assert.Equal(t, "Body", data.Articles[0].Paraghraps[0].Body)
+	require.Len(t, data.Reviews, 1)
+	assert.Equal(t, review.ID, data.Reviews[0].ID)
+	require.NotNil(t, data.Reviews[0].Note)
+	assert.Equal(t, note, *data.Reviews[0].Note)
+	require.Len(t, data.Sessions, 1, "expired tokens are left out")
+	assert.Equal(t, tokens.ScopeAuth, data.Sessions[0].Scope)
+
+	data, err = s.Privacy.GetUserData(ctx, int64(other.ID)+1000)
+	require.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+func testLoginFailures(t *testing.T, s Stores) {
+	ctx := context.Background()
+	key := store.AccountFailureKey("John@Example.com ")
+	assert.Equal(t, "account:john@example.com", key)
+
+	lockedUntil, err := s.LoginFailures.GetLockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, lockedUntil.IsZero())
+
+	window := time.Now().Add(-time.Hour)
+	for want := 1; want <= 3; want++ {
+		failures, err := s.LoginFailures.RecordFailure(ctx, key, window)
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	failures, err := s.LoginFailures.RecordFailure(ctx, key, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures, "failures before the window are forgotten")
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, s.LoginFailures.Lock(ctx, key, until))
+	lockedUntil, err = s.LoginFailures.GetLockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.WithinDuration(t, until, lockedUntil, time.Second)
+
+	require.NoError(t, s.LoginFailures.Reset(ctx, key))
+	lockedUntil, err = s.LoginFailures.GetLockedUntil(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, lockedUntil.IsZero())
+
+	stale := store.IPFailureKey("192.0.2.1")
+	locked := store.IPFailureKey("192.0.2.2")
+	for _, key := range []string{stale, locked} {
+		_, err = s.LoginFailures.RecordFailure(ctx, key, window)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.LoginFailures.Lock(ctx, locked, until))
+	deleted, err := s.LoginFailures.DeleteStale(ctx, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted, "recent failures are kept")
+	deleted, err = s.LoginFailures.DeleteStale(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted, "locked keys are kept until the lock ends")
+	failures, err = s.LoginFailures.RecordFailure(ctx, locked, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+}
+
+// recordLoginFailures makes the email and user show up in failed logins
+func recordLoginFailures(t *testing.T, s Stores, user *store.User) {
+	t.Helper()
+	ctx := context.Background()
+	for _, key := range []string{store.AccountFailureKey(user.Email), store.MFAFailureKey(int64(user.ID))} {
+		_, err := s.LoginFailures.RecordFailure(ctx, key, time.Time{})
+		require.NoError(t, err)
+		require.NoError(t, s.LoginFailures.Lock(ctx, key, time.Now().Add(time.Hour)))
+	}
+}
+
+// assertNoLoginFailures checks that no failed login row is left for the
+// email and user, a fresh failure counts from one again
+func assertNoLoginFailures(t *testing.T, s Stores, user *store.User) {
+	t.Helper()
+	ctx := context.Background()
+	for _, key := range []string{store.AccountFailureKey(user.Email), store.MFAFailureKey(int64(user.ID))} {
+		lockedUntil, err := s.LoginFailures.GetLockedUntil(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, lockedUntil.IsZero(), "%s is still locked", key)
+		failures, err := s.LoginFailures.RecordFailure(ctx, key, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, failures, "%s still has failures", key)
+	}
+}
+
+func testMFA(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "john@example.com")
+	userID := int64(user.ID)
+
+	settings, err := s.MFA.GetTOTP(ctx, userID)
+	require.NoError(t, err)
+	assert.Nil(t, settings)
+	ok, err := s.MFA.MarkTOTPStepUsed(ctx, userID, 1)
+	require.NoError(t, err)
+	assert.False(t, ok, "no enrollment to mark")
+
+	require.NoError(t, s.MFA.SaveTOTPSecret(ctx, userID, "first"))
+	require.NoError(t, s.MFA.EnableTOTP(ctx, userID))
+	for _, step := range []int64{10, 11} {
+		ok, err = s.MFA.MarkTOTPStepUsed(ctx, userID, step)
+		require.NoError(t, err)
+		assert.True(t, ok, "step %d", step)
+	}
+	for _, step := range []int64{11, 10} {
+		ok, err = s.MFA.MarkTOTPStepUsed(ctx, userID, step)
+		require.NoError(t, err)
+		assert.False(t, ok, "step %d was already passed", step)
+	}
+	settings, err = s.MFA.GetTOTP(ctx, userID)
+	require.NoError(t, err)
+	require.NotNil(t, settings)
+	assert.Equal(t, store.TOTPSettings{UserID: userID, Secret: "first", Enabled: true, LastUsedStep: 11}, *settings)
+
+	require.NoError(t, s.MFA.SaveTOTPSecret(ctx, userID, "second"))
+	settings, err = s.MFA.GetTOTP(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, store.TOTPSettings{UserID: userID, Secret: "second"}, *settings, "a new secret starts a new enrollment")
+
+	require.NoError(t, s.MFA.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("old")}))
+	require.NoError(t, s.MFA.ReplaceRecoveryCodes(ctx, userID, [][]byte{[]byte("one"), []byte("two")}))
+	for _, tt := range []struct {
+		code string
+		want bool
+	}{
+		{code: "old", want: false},
+		{code: "one", want: true},
+		{code: "one", want: false},
+		{code: "two", want: true},
+	} {
+		ok, err = s.MFA.UseRecoveryCode(ctx, userID, []byte(tt.code))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, ok, "code %s", tt.code)
+	}
+	other := createUser(t, s, "jane@example.com")
+	require.NoError(t, s.MFA.ReplaceRecoveryCodes(ctx, int64(other.ID), [][]byte{[]byte("three")}))
+	ok, err = s.MFA.UseRecoveryCode(ctx, userID, []byte("three"))
+	require.NoError(t, err)
+	assert.False(t, ok, "codes belong to their user")
+}
+
+func testErasures(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "leaving@example.com")
+	article := createArticle(t, s, user.ID)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	erasure := &store.Erasure{UserID: int64(user.ID), RequestedAt: now, EraseAfter: now.Add(time.Hour)}
+	require.NoError(t, s.Privacy.ScheduleErasure(ctx, erasure))
+	// a second request keeps the first schedule
+	again := &store.Erasure{UserID: int64(user.ID), RequestedAt: now.Add(time.Minute), EraseAfter: now.Add(2 * time.Hour), KeepReviews: true}
+	require.NoError(t, s.Privacy.ScheduleErasure(ctx, again))
+	assert.True(t, again.EraseAfter.Equal(erasure.EraseAfter))
+	assert.False(t, again.KeepReviews)
+
+	stored, err := s.Privacy.GetErasure(ctx, int64(user.ID))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.True(t, stored.EraseAfter.Equal(erasure.EraseAfter))
+
+	due, err := s.Privacy.DueErasures(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	due, err = s.Privacy.DueErasures(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, int64(user.ID), due[0].UserID)
+
+	cancelled, err := s.Privacy.CancelErasure(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+	cancelled, err = s.Privacy.CancelErasure(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+	stored, err = s.Privacy.GetErasure(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// keeping nothing deletes the user with everything it wrote
+	recordLoginFailures(t, s, user)
+	require.NoError(t, s.Privacy.EraseUser(ctx, erasure))
+	assertNoLoginFailures(t, s, user)
+	gone, err := s.Users.GetUserByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.Nil(t, gone)
+	exists, err := s.Articles.ArticleExists(ctx, int64(article.ID))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Error(t, s.Privacy.EraseUser(ctx, erasure), "the user must exist")
+}
+
+func testEraseKeepingContent(t *testing.T, s Stores) {
+	ctx := context.Background()
+	user := createUser(t, s, "leaving@example.com")
+	other := createUser(t, s, "other@example.com")
+	own := createArticle(t, s, user.ID)
+	reviewed := createArticle(t, s, other.ID)
+	onOwn, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(own.ID), AuthorID: int64(other.ID), Stars: 5})
+	require.NoError(t, err)
+	onOther, err := s.Reviews.CreateReview(ctx, &store.Review{ArticleID: int64(reviewed.ID), AuthorID: int64(user.ID), Stars: 2})
+	require.NoError(t, err)
+	token, err := s.Tokens.CreateNewToken(ctx, int64(user.ID), time.Hour, tokens.ScopeAuth)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	erasure := &store.Erasure{UserID: int64(user.ID), RequestedAt: now, EraseAfter: now, KeepReviews: true}
+	require.NoError(t, s.Privacy.ScheduleErasure(ctx, erasure))
+	recordLoginFailures(t, s, user)
+
+	require.NoError(t, s.Privacy.EraseUser(ctx, erasure))
+	assertNoLoginFailures(t, s, user)
+
+	erased, err := s.Users.GetUserByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	require.NotNil(t, erased, "the row stays as the author of the kept reviews")
+	assert.Equal(t, store.ErasedEmail(int64(user.ID)), erased.Email)
+	assert.Equal(t, store.ErasedUser, erased.FirstName)
+	assert.Empty(t, erased.LastName)
+	assert.True(t, erased.Disabled)
+	byEmail, err := s.Users.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Nil(t, byEmail, "the email is free again")
+	withPassword, err := s.Users.GetUserWithPasswordByID(ctx, int64(user.ID))
+	require.NoError(t, err)
+	ok, err := withPassword.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	kept, err := s.Reviews.GetReviewByID(ctx, onOther.ID)
+	require.NoError(t, err)
+	require.NotNil(t, kept)
+	assert.Equal(t, int64(user.ID), kept.AuthorID)
+	exists, err := s.Articles.ArticleExists(ctx, int64(own.ID))
+	require.NoError(t, err)
+	assert.False(t, exists, "articles were not kept")
+	gone, err := s.Reviews.GetReviewByID(ctx, onOwn.ID)
+	require.NoError(t, err)
+	assert.Nil(t, gone, "reviews of deleted articles go with them")
+	missing, err := s.Tokens.GetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	pending, err := s.Privacy.GetErasure(ctx, int64(user.ID))
+	require.NoError(t, err)
+	assert.Nil(t, pending)
+}
+
+func testDump(t *testing.T, s Stores) {
+	if s.Dump == nil {
+		t.Skip("the backend has no dump")
+	}
+	ctx := context.Background()
+	created := time.Date(2024, 3, 1, 12, 30, 15, 250_000_000, time.UTC)
+	updated := created.Add(36 * time.Hour)
+	note := "Great"
+	user := &store.DumpUser{Email: "john@example.com", FirstName: "John", LastName: "Doe", IsAdmin: true, PasswordHash: []byte("hash"), CreatedAt: created, UpdatedAt: updated}
+	article := &store.DumpArticle{Title: "Title", Description: "Description", Image: "image.png", CreatedAt: created, UpdatedAt: updated}
+	paragraph := &store.DumpParagraph{Headline: "Headline", Body: "Body", OrderIndex: 2, CreatedAt: created, UpdatedAt: updated}
+	review := &store.DumpReview{Stars: 4, Note: &note, CreatedAt: created, UpdatedAt: updated}
+
+	write := func(commit bool) {
+		t.Helper()
+		err := s.Dump.WriteDump(ctx, commit, func(w store.DumpWriter) error {
+			var err error
+			user.ID, err = w.InsertUser(ctx, user)
+			if err != nil {
+				return err
+			}
+			article.AuthorID, review.AuthorID = user.ID, user.ID
+			article.ID, err = w.InsertArticle(ctx, article)
+			if err != nil {
+				return err
+			}
+			paragraph.ArticleID, review.ArticleID = article.ID, article.ID
+			paragraph.ID, err = w.InsertParagraph(ctx, paragraph)
+			if err != nil {
+				return err
+			}
+			review.ID, err = w.InsertReview(ctx, review)
+			return err
+		})
+		require.NoError(t, err)
+	}
+	read := func(withPasswords bool) (users []*store.DumpUser, articles []*store.DumpArticle, paragraphs []*store.DumpParagraph, reviews []*store.DumpReview) {
+		t.Helper()
+		err := s.Dump.ReadDump(ctx, func(r store.DumpReader) error {
+			err := r.Users(ctx, withPasswords, func(u *store.DumpUser) error { users = append(users, u); return nil })
+			if err != nil {
+				return err
+			}
+			err = r.Articles(ctx, func(a *store.DumpArticle) error { articles = append(articles, a); return nil })
+			if err != nil {
+				return err
+			}
+			err = r.Paragraphs(ctx, func(p *store.DumpParagraph) error { paragraphs = append(paragraphs, p); return nil })
+			if err != nil {
+				return err
+			}
+			return r.Reviews(ctx, func(v *store.DumpReview) error { reviews = append(reviews, v); return nil })
+		})
+		require.NoError(t, err)
+		return users, articles, paragraphs, reviews
+	}
+
+	write(false)
+	users, articles, paragraphs, reviews := read(true)
+	assert.Empty(t, users, "a dry run leaves nothing behind")
+	assert.Empty(t, articles)
+	assert.Empty(t, paragraphs)
+	assert.Empty(t, reviews)
+
+	write(true)
+	users, articles, paragraphs, reviews = read(true)
+	require.Len(t, users, 1)
+	require.Len(t, articles, 1)
+	require.Len(t, paragraphs, 1)
+	require.Len(t, reviews, 1)
+	assertDumpTimes(t, users[0].CreatedAt, users[0].UpdatedAt)
+	assertDumpTimes(t, articles[0].CreatedAt, articles[0].UpdatedAt)
+	assertDumpTimes(t, paragraphs[0].CreatedAt, paragraphs[0].UpdatedAt)
+	assertDumpTimes(t, reviews[0].CreatedAt, reviews[0].UpdatedAt)
+	users[0].CreatedAt, users[0].UpdatedAt = created, updated
+	articles[0].CreatedAt, articles[0].UpdatedAt = created, updated
+	paragraphs[0].CreatedAt, paragraphs[0].UpdatedAt = created, updated
+	reviews[0].CreatedAt, reviews[0].UpdatedAt = created, updated
+	assert.Equal(t, user, users[0])
+	assert.Equal(t, article, articles[0])
+	assert.Equal(t, paragraph, paragraphs[0])
+	assert.Equal(t, review, reviews[0])
+
+	users, _, _, _ = read(false)
+	assert.Empty(t, users[0].PasswordHash, "hashes are only read when asked for")
+
+	stored, err := s.Articles.GetArticleByID(ctx, article.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "Title", stored.Title, "imported rows are read by the stores")
+}
+
+// assertDumpTimes checks that the times of a dumped row are the ones written,
+// whatever location the backend reads them in
+func assertDumpTimes(t *testing.T, createdAt, updatedAt time.Time) {
+	t.Helper()
+	want := time.Date(2024, 3, 1, 12, 30, 15, 250_000_000, time.UTC)
+	assert.True(t, want.Equal(createdAt), "created_at %s", createdAt)
+	assert.True(t, want.Add(36*time.Hour).Equal(updatedAt), "updated_at %s", updatedAt)
+}
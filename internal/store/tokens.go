@@ -1,71 +1,186 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
 	"github.com/makhammatovb/Articles/internal/tokens"
 )
 
 type PostgresTokenStore struct {
-	db *sql.DB
+	db           *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
-	return &PostgresTokenStore{db: db}
+func NewPostgresTokenStore(db *pgxpool.Pool, queryTimeout time.Duration) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db, queryTimeout: queryTimeout}
 }
 
 type TokenStore interface {
-	Insert(token *tokens.Token) error
-	CreateNewToken(userID int64, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokensForUser(userID int64, scope string) error
-	GetToken(hash []byte) (*tokens.Token, error)
+	Insert(ctx context.Context, token *tokens.Token) error
+	CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*tokens.Token, error)
+	DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) error
+	DeleteToken(ctx context.Context, hash []byte) error
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+	GetToken(ctx context.Context, hash []byte) (*tokens.Token, error)
+	// the revocations back the denylist of signed tokens
+	tokens.RevocationStore
 }
 
-func (t *PostgresTokenStore) CreateNewToken(userID int64, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (t *PostgresTokenStore) CreateNewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (_ *tokens.Token, err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.CreateNewToken", "INSERT tokens")
+	defer end(&err)
 	token, err := tokens.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = t.Insert(token)
+	err = t.Insert(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 	return token, err
 }
 
-func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+func (t *PostgresTokenStore) Insert(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.Insert", "INSERT tokens")
+	defer end(&err)
 	query := `
 	INSERT INTO tokens (hash, user_id, expiry, scope)
 	VALUES ($1, $2, $3, $4);
 	`
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	_, err = t.db.Exec(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func (t *PostgresTokenStore) DeleteAllTokensForUser(userID int64, scope string) error {
+func (t *PostgresTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) (err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.DeleteAllTokensForUser", "DELETE tokens")
+	defer end(&err)
 	query := `
 	DELETE FROM tokens WHERE user_id = $1 AND scope = $2;
 	`
-	_, err := t.db.Exec(query, userID, scope)
+	_, err = t.db.Exec(ctx, query, userID, scope)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
+func (t *PostgresTokenStore) DeleteToken(ctx context.Context, hash []byte) (err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.DeleteToken", "DELETE tokens")
+	defer end(&err)
+	query := `
+	DELETE FROM tokens WHERE hash = $1;
+	`
+	_, err = t.db.Exec(ctx, query, hash)
+	return err
+}
+
+// DeleteExpiredTokens removes tokens of every scope that can no longer be
+// used, along with revocations of signed tokens that have expired
+func (t *PostgresTokenStore) DeleteExpiredTokens(ctx context.Context) (_ int64, err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.DeleteExpiredTokens", "DELETE tokens")
+	defer end(&err)
+	now := time.Now()
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM tokens WHERE expiry < $1;`,
+		`DELETE FROM revoked_tokens WHERE expiry < $1;`,
+		`DELETE FROM user_token_revocations WHERE expiry < $1;`,
+	} {
+		result, err := t.db.Exec(ctx, query, now)
+		if err != nil {
+			return 0, err
+		}
+		deleted += result.RowsAffected()
+	}
+	return deleted, nil
+}
+
+// RevokeJWT records the ID of a signed token that must no longer be accepted
+func (t *PostgresTokenStore) RevokeJWT(ctx context.Context, id string, expiry time.Time) (err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.RevokeJWT", "INSERT revoked_tokens")
+	defer end(&err)
+	query := `
+	INSERT INTO revoked_tokens (jti, expiry) VALUES ($1, $2)
+	ON CONFLICT (jti) DO NOTHING;
+	`
+	_, err = t.db.Exec(ctx, query, id, expiry)
+	return err
+}
+
+// RevokeUserJWTs revokes every signed token issued to the user before
+// issuedBefore, a later revocation replaces an earlier one
+func (t *PostgresTokenStore) RevokeUserJWTs(ctx context.Context, userID int64, issuedBefore, expiry time.Time) (err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.RevokeUserJWTs", "INSERT user_token_revocations")
+	defer end(&err)
+	query := `
+	INSERT INTO user_token_revocations (user_id, issued_before, expiry) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET
+		issued_before = GREATEST(user_token_revocations.issued_before, EXCLUDED.issued_before),
+		expiry = GREATEST(user_token_revocations.expiry, EXCLUDED.expiry);
+	`
+	_, err = t.db.Exec(ctx, query, userID, issuedBefore, expiry)
+	return err
+}
+
+// RevokedJWTs returns the revocations of signed tokens that have not expired yet
+func (t *PostgresTokenStore) RevokedJWTs(ctx context.Context) (_ *tokens.Revocations, err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.RevokedJWTs", "SELECT revoked_tokens")
+	defer end(&err)
+	now := time.Now()
+	revocations := &tokens.Revocations{IDs: map[string]time.Time{}, Users: map[int64]tokens.UserRevocation{}}
+	rows, err := t.db.Query(ctx, `SELECT jti, expiry FROM revoked_tokens WHERE expiry > $1;`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var expiry time.Time
+		err = rows.Scan(&id, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		revocations.IDs[id] = expiry
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = t.db.Query(ctx, `SELECT user_id, issued_before, expiry FROM user_token_revocations WHERE expiry > $1;`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int64
+		var user tokens.UserRevocation
+		err = rows.Scan(&userID, &user.IssuedBefore, &user.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		revocations.Users[userID] = user
+	}
+	return revocations, rows.Err()
+}
+
 // bu xato (token hash byte qabul qiladigon bo'ldi)
-func (t *PostgresTokenStore) GetToken(hash []byte) (*tokens.Token, error) {
+func (t *PostgresTokenStore) GetToken(ctx context.Context, hash []byte) (_ *tokens.Token, err error) {
+	ctx, end := startQuery(ctx, t.queryTimeout, "TokenStore.GetToken", "SELECT tokens")
+	defer end(&err)
 	token := &tokens.Token{}
 	query := `
 	SELECT hash, user_id, expiry, scope FROM tokens WHERE hash = $1;
 	`
-	err := t.db.QueryRow(query, hash).Scan(&token.Hash, &token.UserID, &token.Expiry, &token.Scope)
+	err = t.db.QueryRow(ctx, query, hash).Scan(&token.Hash, &token.UserID, &token.Expiry, &token.Scope)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
@@ -1,13 +1,17 @@
 package store
 
 import (
-	"database/sql"
-	"errors"
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
-	"crypto/sha256"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
 )
 
 type password struct {
@@ -15,9 +19,14 @@ type password struct {
 	hash      []byte
 }
 
-func (p *password) Set(plainPasswordText string) error {
-	// 12 is cost factor
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainPasswordText), 12)
+// LogValue keeps the password and its hash out of logs
+func (p password) LogValue() slog.Value {
+	return slog.StringValue("[REDACTED]")
+}
+
+// Set hashes the password with hasher, which should be the configured one
+func (p *password) Set(hasher passwords.Hasher, plainPasswordText string) error {
+	hash, err := hasher.Hash(plainPasswordText)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -27,27 +36,52 @@ func (p *password) Set(plainPasswordText string) error {
 }
 
 func (p *password) Matches(plaintextPassword string) (bool, error) {
-	fmt.Println("Comparing password hash:", p.hash , "with plaintext password:", plaintextPassword)
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, fmt.Errorf("failed to compare passwords: %w", err)
-		}
+	matches, err := passwords.Verify(p.hash, plaintextPassword)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare passwords: %w", err)
+	}
+	return matches, nil
+}
+
+// Changed reports whether Set was called, only then UpdateUser writes the
+// hash and the password history records it
+func (p *password) Changed() bool {
+	return p.plainText != nil
+}
+
+// NeedsRehash reports whether the stored hash uses an older algorithm or
+// weaker parameters than hasher
+func (p *password) NeedsRehash(hasher passwords.Hasher) bool {
+	return hasher.NeedsRehash(p.hash)
+}
+
+// dummyHashes holds a hash made by each hasher SimulatePasswordCheck was
+// called with
+var dummyHashes sync.Map
+
+// SimulatePasswordCheck costs as much as Matches on a hash made by hasher,
+// it is used when no account matches so unknown emails cannot be told apart
+// by timing
+func SimulatePasswordCheck(hasher passwords.Hasher, plaintextPassword string) {
+	hash, ok := dummyHashes.Load(hasher)
+	if !ok {
+		created, _ := hasher.Hash("dummy-password")
+		hash, _ = dummyHashes.LoadOrStore(hasher, created)
 	}
-	return true, nil
+	_, _ = passwords.Verify(hash.([]byte), plaintextPassword)
 }
 
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"-"`
-	FirstName    string    `json:"firstname"`
-	LastName     string    `json:"lastname"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int      `json:"id"`
+	Email        string   `json:"email"`
+	PasswordHash password `json:"-"`
+	FirstName    string   `json:"firstname"`
+	LastName     string   `json:"lastname"`
+	IsAdmin      bool     `json:"is_admin"`
+	// Disabled accounts can't log in and their tokens are not accepted
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 var AnonymousUser = &User{}
@@ -57,44 +91,163 @@ func (u *User) IsAnonymous() bool {
 }
 
 type PostgresUserStore struct {
-	db *sql.DB
+	db           *pgxpool.Pool
+	hasher       passwords.Hasher
+	queryTimeout time.Duration
 }
 
-func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
-	return &PostgresUserStore{db: db}
+// NewPostgresUserStore creates a PostgresUserStore, hasher hashes the
+// passwords set with UpdatePassword
+func NewPostgresUserStore(db *pgxpool.Pool, hasher passwords.Hasher, queryTimeout time.Duration) *PostgresUserStore {
+	return &PostgresUserStore{db: db, hasher: hasher, queryTimeout: queryTimeout}
 }
 
 type UserStore interface {
-	CreateUser(user *User) error
-	GetUserByID(id int64) (*User, error)
-	GetUserByEmail(email string) (*User, error)
-	GetUserWithPasswordByID(id int64) (*User, error)
-	UpdateUser(user *User) error
-	DeleteUser(id int64) error
-	UpdatePassword(userID int64, newPassword string) error
-	GetUserToken(scope, tokenPlainText string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	CreateUsers(ctx context.Context, users []*User) error
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserWithPasswordByID(ctx context.Context, id int64) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id int64) error
+	UpdatePassword(ctx context.Context, userID int64, newPassword string) error
+	GetUserToken(ctx context.Context, scope, tokenPlainText string) (*User, error)
+	PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (bool, error)
+	UpdatePasswordHash(ctx context.Context, user *User) error
+	ListUsers(ctx context.Context) ([]*User, error)
+	SetUserDisabled(ctx context.Context, id int64, disabled bool) error
 }
 
-func (pg *PostgresUserStore) CreateUser(user *User) error {
+func (pg *PostgresUserStore) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.CreateUser", "INSERT users")
+	defer end(&err)
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 	query :=
-		`INSERT INTO users (email, password_hash, firstname, lastname, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id;
+		`INSERT INTO users (email, password_hash, firstname, lastname, is_admin, disabled, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW()) RETURNING id;
 	`
-	err := pg.db.QueryRow(query, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName).Scan(&user.ID)
+	err = tx.QueryRow(ctx, query, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName, user.IsAdmin, user.Disabled).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with email %q %w", user.Email, ErrConflict)
+	}
 	if err != nil {
 		return err
 	}
-	return nil
+	err = recordPasswordHistory(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// CreateUsers inserts the users in one transaction, it is meant for bulk
+// loads. The IDs are set on the given records.
+func (pg *PostgresUserStore) CreateUsers(ctx context.Context, users []*User) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.CreateUsers", "COPY users")
+	defer end(&err)
+	if len(users) == 0 {
+		return nil
+	}
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	ids, err := nextIDs(ctx, tx, "users", len(users))
+	if err != nil {
+		return err
+	}
+	copyRows := make([][]any, len(users))
+	var historyRows [][]any
+	for i, user := range users {
+		user.ID = ids[i]
+		copyRows[i] = []any{user.ID, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName, user.IsAdmin, user.Disabled}
+		if user.PasswordHash.Changed() {
+			historyRows = append(historyRows, []any{user.ID, user.PasswordHash.hash})
+		}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"users"},
+		[]string{"id", "email", "password_hash", "firstname", "lastname", "is_admin", "disabled"},
+		pgx.CopyFromRows(copyRows))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user email %w", ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"password_history"},
+		[]string{"user_id", "password_hash"},
+		pgx.CopyFromRows(historyRows))
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// recordPasswordHistory keeps the hash of a password that was just set,
+// so it can't be chosen again later
+func recordPasswordHistory(ctx context.Context, tx pgx.Tx, user *User) error {
+	if !user.PasswordHash.Changed() {
+		return nil
+	}
+	query := `
+	INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2);
+	`
+	_, err := tx.Exec(ctx, query, user.ID, user.PasswordHash.hash)
+	return err
+}
+
+// PasswordUsedRecently compares the password with the last limit passwords
+// of the user, the current one included. The newest history row is the
+// current password, it is skipped as the current hash is checked anyway,
+// also for imported accounts that have no history.
+func (pg *PostgresUserStore) PasswordUsedRecently(ctx context.Context, userID int64, plaintextPassword string, limit int) (_ bool, err error) {
+	if limit <= 0 {
+		return false, nil
+	}
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.PasswordUsedRecently", "SELECT users password_history")
+	defer end(&err)
+	query := `
+	(SELECT password_hash FROM users WHERE id = $1)
+	UNION ALL
+	(SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC OFFSET 1 LIMIT $2);
+	`
+	rows, err := pg.db.Query(ctx, query, userID, limit-1)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		previous := password{}
+		err = rows.Scan(&previous.hash)
+		if err != nil {
+			return false, err
+		}
+		matches, err := previous.Matches(plaintextPassword)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
-func (pg *PostgresUserStore) GetUserByID(id int64) (*User, error) {
+func (pg *PostgresUserStore) GetUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.GetUserByID", "SELECT users")
+	defer end(&err)
 	user := &User{PasswordHash: password{}}
 	query := `
-	SELECT id, email, firstname, lastname, created_at, updated_at from users where id = $1;
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at from users where id = $1;
 	`
-	err := pg.db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	err = pg.db.QueryRow(ctx, query, id).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
@@ -102,14 +255,16 @@ func (pg *PostgresUserStore) GetUserByID(id int64) (*User, error) {
 	return user, nil
 }
 
-func (pg *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+func (pg *PostgresUserStore) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.GetUserByEmail", "SELECT users")
+	defer end(&err)
 	user := &User{PasswordHash: password{}}
 	query := `
-	SELECT id, email, password_hash, firstname, lastname, created_at, updated_at from users where email = $1;
+	SELECT id, email, password_hash, firstname, lastname, is_admin, disabled, created_at, updated_at from users where email = $1;
 	`
-	err := pg.db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	err = pg.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
@@ -118,14 +273,16 @@ func (pg *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
 }
 
 // bu kerak emas (faqat password change da ishlatildi)
-func (pg *PostgresUserStore) GetUserWithPasswordByID(id int64) (*User, error) {
+func (pg *PostgresUserStore) GetUserWithPasswordByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.GetUserWithPasswordByID", "SELECT users")
+	defer end(&err)
 	user := &User{PasswordHash: password{}}
 	query := `
-	SELECT id, email, password_hash, firstname, lastname, created_at, updated_at from users where id = $1;
+	SELECT id, email, password_hash, firstname, lastname, is_admin, disabled, created_at, updated_at from users where id = $1;
 	`
-	err := pg.db.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
+	err = pg.db.QueryRow(ctx, query, id).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
@@ -133,88 +290,127 @@ func (pg *PostgresUserStore) GetUserWithPasswordByID(id int64) (*User, error) {
 	return user, nil
 }
 
-func (pg *PostgresUserStore) UpdateUser(user *User) error {
+func (pg *PostgresUserStore) UpdateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.UpdateUser", "UPDATE users")
+	defer end(&err)
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 	query := `
-	UPDATE users SET email = $1, password_hash = $2, firstname = $3, lastname = $4, updated_at = NOW()
+	UPDATE users SET email = $1, password_hash = COALESCE($2, password_hash), firstname = $3, lastname = $4, updated_at = NOW()
 	WHERE id = $5;
 	`
-	result, err := pg.db.Exec(query, user.Email, user.PasswordHash.hash, user.FirstName, user.LastName, user.ID)
-	if err != nil {
-		return err
+	// users loaded without their hash must not wipe it
+	var hash any
+	if user.PasswordHash.Changed() {
+		hash = user.PasswordHash.hash
+	}
+	result, err := tx.Exec(ctx, query, user.Email, hash, user.FirstName, user.LastName, user.ID)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with email %q %w", user.Email, ErrConflict)
 	}
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %d not found", user.ID)
+		return fmt.Errorf("user with ID %d %w", user.ID, ErrNotFound)
 	}
-	return nil
+	err = recordPasswordHistory(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// UpdatePasswordHash stores a new hash of the same password, as done when
+// rehashing on login, so nothing is added to the password history
+func (pg *PostgresUserStore) UpdatePasswordHash(ctx context.Context, user *User) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.UpdatePasswordHash", "UPDATE users")
+	defer end(&err)
+	query := `
+	UPDATE users SET password_hash = $1 WHERE id = $2;
+	`
+	_, err = pg.db.Exec(ctx, query, user.PasswordHash.hash, user.ID)
+	return err
 }
 
-func (pg *PostgresUserStore) DeleteUser(id int64) error {
+func (pg *PostgresUserStore) DeleteUser(ctx context.Context, id int64) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.DeleteUser", "DELETE users")
+	defer end(&err)
 	query := `
 	DELETE FROM users WHERE id = $1;
 	`
-	result, err := pg.db.Exec(query, id)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
+	result, err := pg.db.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
+	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("article with ID %d not found", id)
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
 	}
 	return nil
 }
 
-func (pg *PostgresUserStore) UpdatePassword(userID int64, newPassword string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+func (pg *PostgresUserStore) UpdatePassword(ctx context.Context, userID int64, newPassword string) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.UpdatePassword", "UPDATE users")
+	defer end(&err)
+	hashedPassword, err := pg.hasher.Hash(newPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
+	tx, err := pg.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 	query := `
 	UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2;
 	`
-	result, err := pg.db.Exec(query, hashedPassword, userID)
+	result, err := tx.Exec(ctx, query, hashedPassword, userID)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	rowsAffected := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %d %w", userID, ErrNotFound)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2);`, userID, hashedPassword)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("user with ID %d not found", userID)
-	}
-	return nil
+	return tx.Commit(ctx)
 }
- 
-func (s *PostgresUserStore) GetUserToken (scope, plaintextPassword string) (*User, error) {
+
+func (s *PostgresUserStore) GetUserToken(ctx context.Context, scope, plaintextPassword string) (_ *User, err error) {
+	ctx, end := startQuery(ctx, s.queryTimeout, "UserStore.GetUserToken", "SELECT users tokens")
+	defer end(&err)
 	tokenHash := sha256.Sum256([]byte(plaintextPassword))
 
 	query := `
-	SELECT u.id, u.email, u.firstname, u.lastname, u.created_at, u.updated_at
+	SELECT u.id, u.email, u.firstname, u.lastname, u.is_admin, u.disabled, u.created_at, u.updated_at
 	FROM users u
 	INNER JOIN tokens t ON u.id = t.user_id
-	WHERE t.hash = $1 AND t.scope = $2 and t.expiry > $3;
+	WHERE t.hash = $1 AND t.scope = $2 and t.expiry > $3 AND NOT u.disabled;
 	`
 
 	user := &User{
 		PasswordHash: password{},
 	}
-	err := s.db.QueryRow(query, tokenHash[:], scope, time.Now()).Scan(
+	err = s.db.QueryRow(ctx, query, tokenHash[:], scope, time.Now()).Scan(
 		&user.ID,
 		&user.Email,
 		&user.FirstName,
 		&user.LastName,
+		&user.IsAdmin,
+		&user.Disabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 
-	if err == sql.ErrNoRows {
+	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 
@@ -223,4 +419,44 @@ func (s *PostgresUserStore) GetUserToken (scope, plaintextPassword string) (*Use
 	}
 
 	return user, nil
-}
\ No newline at end of file
+}
+
+// ListUsers returns every user ordered by ID, without password hashes
+func (pg *PostgresUserStore) ListUsers(ctx context.Context) (_ []*User, err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.ListUsers", "SELECT users")
+	defer end(&err)
+	query := `
+	SELECT id, email, firstname, lastname, is_admin, disabled, created_at, updated_at from users ORDER BY id;
+	`
+	rows, err := pg.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []*User{}
+	for rows.Next() {
+		user := &User{PasswordHash: password{}}
+		err = rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.IsAdmin, &user.Disabled, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (pg *PostgresUserStore) SetUserDisabled(ctx context.Context, id int64, disabled bool) (err error) {
+	ctx, end := startQuery(ctx, pg.queryTimeout, "UserStore.SetUserDisabled", "UPDATE users")
+	defer end(&err)
+	query := `
+	UPDATE users SET disabled = $1, updated_at = NOW() WHERE id = $2;
+	`
+	result, err := pg.db.Exec(ctx, query, disabled, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user with ID %d %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+// Limits of the VARCHAR columns, longer values fail in Postgres and would
+// be stored as they are by SQLite
+const (
+	MaxEmailLength    = 255
+	MaxNameLength     = 255
+	MaxTitleLength    = 255
+	MaxImageLength    = 255
+	MaxHeadlineLength = 255
+)
+
+// Stars a review may give
+const (
+	MinStars = 1
+	MaxStars = 5
+)
+
+// ValidateEmail checks an email an account is created or updated with
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Required("email", email)
+	v.MaxLength("email", email, MaxEmailLength)
+	v.Email("email", email)
+}
+
+// ValidateUser checks the profile of a user, passwords are checked by the
+// password policy
+func ValidateUser(v *validator.Validator, user *User) {
+	ValidateEmail(v, user.Email)
+	v.MaxLength("firstname", user.FirstName, MaxNameLength)
+	v.MaxLength("lastname", user.LastName, MaxNameLength)
+}
+
+// ValidateArticle checks an article and each of its paragraphs
+func ValidateArticle(v *validator.Validator, article *Article) {
+	v.Required("title", article.Title)
+	v.MaxLength("title", article.Title, MaxTitleLength)
+	v.MaxLength("image", article.Image, MaxImageLength)
+	for i := range article.Paraghraps {
+		ValidateParagraph(v, fmt.Sprintf("paraghraps[%d]", i), &article.Paraghraps[i])
+	}
+}
+
+// ValidateParagraph checks a paragraph, its fields are reported below
+// prefix
+func ValidateParagraph(v *validator.Validator, prefix string, paragraph *Paraghraph) {
+	v.Required(prefix+".headline", paragraph.Headline)
+	v.MaxLength(prefix+".headline", paragraph.Headline, MaxHeadlineLength)
+	v.Check(paragraph.OrderIndex >= 0, prefix+".order_index", validator.CodeOutOfRange, prefix+".order_index must not be negative")
+}
+
+// ValidateReview checks the stars of a review
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Between("stars", review.Stars, MinStars, MaxStars)
+}
@@ -0,0 +1,164 @@
+package tokens
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Denylist keeps signed tokens that were revoked before they expired
+type Denylist interface {
+	Revoke(ctx context.Context, id string, expiry time.Time) error
+	IsRevoked(claims *Claims) bool
+}
+
+// Revocations are revoked token IDs and, per user, the time up to which
+// every token issued to them is revoked. Both map to the time after which
+// the entry can be forgotten because the tokens it covers have expired.
+type Revocations struct {
+	IDs   map[string]time.Time
+	Users map[int64]UserRevocation
+}
+
+type UserRevocation struct {
+	IssuedBefore time.Time
+	Expiry       time.Time
+}
+
+// MemoryDenylist is a process-local Denylist, entries are dropped once
+// the tokens they refer to have expired
+type MemoryDenylist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	// users is keyed by the subject claim
+	users map[string]UserRevocation
+}
+
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{revoked: map[string]time.Time{}, users: map[string]UserRevocation{}}
+}
+
+func (d *MemoryDenylist) Revoke(ctx context.Context, id string, expiry time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(time.Now())
+	d.revoked[id] = expiry
+	return nil
+}
+
+// RevokeUser revokes every token issued to the user up to issuedBefore,
+// expiry is when the last of those tokens expires
+func (d *MemoryDenylist) RevokeUser(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(time.Now())
+	subject := strconv.FormatInt(userID, 10)
+	if current, ok := d.users[subject]; ok && current.IssuedBefore.After(issuedBefore) {
+		return nil
+	}
+	d.users[subject] = UserRevocation{IssuedBefore: issuedBefore, Expiry: expiry}
+	return nil
+}
+
+func (d *MemoryDenylist) IsRevoked(claims *Claims) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	expiry, ok := d.revoked[claims.ID]
+	if ok && now.Before(expiry) {
+		return true
+	}
+	user, ok := d.users[claims.Subject]
+	if !ok || !now.Before(user.Expiry) {
+		return false
+	}
+	// issued at is kept to the second, a token from the same second as the
+	// revocation counts as issued before it
+	return claims.IssuedAt == nil || !claims.IssuedAt.After(user.IssuedBefore)
+}
+
+// replace swaps every entry for the given ones
+func (d *MemoryDenylist) replace(revocations *Revocations) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revoked = revocations.IDs
+	if d.revoked == nil {
+		d.revoked = map[string]time.Time{}
+	}
+	d.users = make(map[string]UserRevocation, len(revocations.Users))
+	for userID, user := range revocations.Users {
+		d.users[strconv.FormatInt(userID, 10)] = user
+	}
+	d.prune(time.Now())
+}
+
+func (d *MemoryDenylist) prune(now time.Time) {
+	for id, expiry := range d.revoked {
+		if !now.Before(expiry) {
+			delete(d.revoked, id)
+		}
+	}
+	for subject, user := range d.users {
+		if !now.Before(user.Expiry) {
+			delete(d.users, subject)
+		}
+	}
+}
+
+// RevocationStore persists revocations, rows may be deleted once the tokens
+// they cover have expired
+type RevocationStore interface {
+	RevokeJWT(ctx context.Context, id string, expiry time.Time) error
+	RevokeUserJWTs(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error
+	RevokedJWTs(ctx context.Context) (*Revocations, error)
+}
+
+// SharedDenylist writes revocations through to a RevocationStore, so they
+// survive restarts and reach every replica. Lookups are answered from memory,
+// revocations made by other processes show up after the next Sync.
+type SharedDenylist struct {
+	store RevocationStore
+	// ttl is the lifetime of the tokens, it bounds how long a revocation of
+	// all tokens of a user has to be kept
+	ttl   time.Duration
+	local *MemoryDenylist
+}
+
+func NewSharedDenylist(store RevocationStore, ttl time.Duration) *SharedDenylist {
+	return &SharedDenylist{store: store, ttl: ttl, local: NewMemoryDenylist()}
+}
+
+func (d *SharedDenylist) Revoke(ctx context.Context, id string, expiry time.Time) error {
+	err := d.store.RevokeJWT(ctx, id, expiry)
+	if err != nil {
+		return err
+	}
+	return d.local.Revoke(ctx, id, expiry)
+}
+
+// RevokeUser revokes every token issued to the user so far, it is used when
+// an account is disabled or erased and when its password changes
+func (d *SharedDenylist) RevokeUser(ctx context.Context, userID int64) error {
+	now := time.Now()
+	expiry := now.Add(d.ttl)
+	err := d.store.RevokeUserJWTs(ctx, userID, now, expiry)
+	if err != nil {
+		return err
+	}
+	return d.local.RevokeUser(ctx, userID, now, expiry)
+}
+
+func (d *SharedDenylist) IsRevoked(claims *Claims) bool {
+	return d.local.IsRevoked(claims)
+}
+
+// Sync reloads the revocations from the store
+func (d *SharedDenylist) Sync(ctx context.Context) error {
+	revocations, err := d.store.RevokedJWTs(ctx)
+	if err != nil {
+		return err
+	}
+	d.local.replace(revocations)
+	return nil
+}
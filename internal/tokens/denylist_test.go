@@ -0,0 +1,79 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// revocationMap is a RevocationStore shared by several denylists, like a
+// table shared by several replicas
+type revocationMap Revocations
+
+func (m *revocationMap) RevokeJWT(ctx context.Context, id string, expiry time.Time) error {
+	m.IDs[id] = expiry
+	return nil
+}
+
+func (m *revocationMap) RevokeUserJWTs(ctx context.Context, userID int64, issuedBefore, expiry time.Time) error {
+	m.Users[userID] = UserRevocation{IssuedBefore: issuedBefore, Expiry: expiry}
+	return nil
+}
+
+func (m *revocationMap) RevokedJWTs(ctx context.Context) (*Revocations, error) {
+	revocations := &Revocations{IDs: map[string]time.Time{}, Users: map[int64]UserRevocation{}}
+	for id, expiry := range m.IDs {
+		revocations.IDs[id] = expiry
+	}
+	for userID, user := range m.Users {
+		revocations.Users[userID] = user
+	}
+	return revocations, nil
+}
+
+func TestSharedDenylist(t *testing.T) {
+	ctx := context.Background()
+	shared := &revocationMap{IDs: map[string]time.Time{}, Users: map[int64]UserRevocation{}}
+	first := NewSharedDenylist(shared, time.Hour)
+	second := NewSharedDenylist(shared, time.Hour)
+	claims := func(id string) *Claims {
+		return &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: id, Subject: "1", IssuedAt: jwt.NewNumericDate(time.Now())}}
+	}
+
+	require.NoError(t, first.Revoke(ctx, "revoked", time.Now().Add(time.Hour)))
+	require.NoError(t, first.Revoke(ctx, "expired", time.Now().Add(-time.Minute)))
+	assert.True(t, first.IsRevoked(claims("revoked")))
+	assert.False(t, second.IsRevoked(claims("revoked")), "other replicas only learn about it on sync")
+
+	require.NoError(t, second.Sync(ctx))
+	assert.True(t, second.IsRevoked(claims("revoked")))
+	assert.False(t, second.IsRevoked(claims("expired")))
+	assert.False(t, second.IsRevoked(claims("unknown")))
+
+	restarted := NewSharedDenylist(shared, time.Hour)
+	require.NoError(t, restarted.Sync(ctx))
+	assert.True(t, restarted.IsRevoked(claims("revoked")), "revocations survive a restart")
+}
+
+func TestSharedDenylistRevokeUser(t *testing.T) {
+	ctx := context.Background()
+	shared := &revocationMap{IDs: map[string]time.Time{}, Users: map[int64]UserRevocation{}}
+	denylist := NewSharedDenylist(shared, time.Hour)
+	issued := func(subject string, at time.Time) *Claims {
+		return &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "id", Subject: subject, IssuedAt: jwt.NewNumericDate(at)}}
+	}
+
+	before := issued("1", time.Now())
+	require.NoError(t, denylist.RevokeUser(ctx, 1))
+	assert.True(t, denylist.IsRevoked(before))
+	assert.False(t, denylist.IsRevoked(issued("2", time.Now())), "other users keep their tokens")
+	assert.False(t, denylist.IsRevoked(issued("1", time.Now().Add(2*time.Second))), "tokens issued afterwards are valid")
+
+	replica := NewSharedDenylist(shared, time.Hour)
+	require.NoError(t, replica.Sync(ctx))
+	assert.True(t, replica.IsRevoked(before))
+}
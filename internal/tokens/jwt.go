@@ -0,0 +1,204 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ModeOpaque = "opaque"
+	ModeJWT    = "jwt"
+)
+
+const keyFileExt = ".key"
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims is the payload of a signed access token
+type Claims struct {
+	Email string `json:"email"`
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// Keyring holds the HMAC keys used to sign and verify access tokens.
+// Keys live in a local directory as <kid>.key files, the newest one signs
+// and all of them are accepted for verification until they are removed.
+type Keyring struct {
+	mu     sync.RWMutex
+	dir    string
+	keys   map[string][]byte
+	active string
+}
+
+// LoadKeyring reads every key from dir and generates a first one if dir is empty
+func LoadKeyring(dir string) (*Keyring, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: create dir %w", err)
+	}
+	kr := &Keyring{dir: dir, keys: map[string][]byte{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: read dir %w", err)
+	}
+	var kids []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != keyFileExt {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("keyring: read key %w", err)
+		}
+		secret, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("keyring: decode key %s: %w", entry.Name(), err)
+		}
+		kid := strings.TrimSuffix(entry.Name(), keyFileExt)
+		kr.keys[kid] = secret
+		kids = append(kids, kid)
+	}
+	if len(kids) == 0 {
+		_, err = kr.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		return kr, nil
+	}
+	// key IDs are timestamps, so the last one in sorted order is the newest
+	sort.Strings(kids)
+	kr.active = kids[len(kids)-1]
+	return kr, nil
+}
+
+// Rotate generates a new signing key, stores it on disk and makes it active.
+// Previous keys stay valid for verification.
+func (kr *Keyring) Rotate() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	kid := time.Now().UTC().Format("20060102T150405.000000000Z")
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	err = os.WriteFile(filepath.Join(kr.dir, kid+keyFileExt), []byte(encoded+"\n"), 0o600)
+	if err != nil {
+		return "", fmt.Errorf("keyring: write key %w", err)
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.keys[kid] = secret
+	kr.active = kid
+	return kid, nil
+}
+
+func (kr *Keyring) signingKey() (string, []byte) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active, kr.keys[kr.active]
+}
+
+func (kr *Keyring) key(kid string) ([]byte, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	secret, ok := kr.keys[kid]
+	return secret, ok
+}
+
+// JWTManager issues and verifies self-contained access tokens
+type JWTManager struct {
+	keyring  *Keyring
+	denylist Denylist
+	issuer   string
+}
+
+func NewJWTManager(keyring *Keyring, denylist Denylist) *JWTManager {
+	return &JWTManager{
+		keyring:  keyring,
+		denylist: denylist,
+		issuer:   "articles",
+	}
+}
+
+// Issue signs a new access token for the user with the active key
+func (m *JWTManager) Issue(userID int64, email string, ttl time.Duration, scope string) (*Token, error) {
+	jti := make([]byte, 16)
+	_, err := rand.Read(jti)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	token := &Token{
+		ID:     base64.RawURLEncoding.EncodeToString(jti),
+		UserID: userID,
+		Expiry: now.Add(ttl),
+		Scope:  scope,
+	}
+	claims := Claims{
+		Email: email,
+		Scope: scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        token.ID,
+			Issuer:    m.issuer,
+			Subject:   fmt.Sprint(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(token.Expiry),
+		},
+	}
+	kid, secret := m.keyring.signingKey()
+	signed := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed.Header["kid"] = kid
+	token.PlainText, err = signed.SignedString(secret)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Verify checks the signature, expiry, scope and denylist of a token
+// and returns its claims. It never touches the database.
+func (m *JWTManager) Verify(tokenString, scope string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		secret, ok := m.keyring.key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Scope != scope {
+		return nil, fmt.Errorf("%w: wrong scope", ErrInvalidToken)
+	}
+	if m.denylist != nil && m.denylist.IsRevoked(claims) {
+		return nil, fmt.Errorf("%w: revoked", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// Revoke adds the token ID to the denylist until the token would have expired anyway
+func (m *JWTManager) Revoke(ctx context.Context, claims *Claims) error {
+	if m.denylist == nil {
+		return nil
+	}
+	return m.denylist.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
@@ -0,0 +1,55 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTManager(t *testing.T) {
+	keyring, err := LoadKeyring(t.TempDir())
+	require.NoError(t, err)
+	manager := NewJWTManager(keyring, NewMemoryDenylist())
+
+	token, err := manager.Issue(42, "john@example.com", time.Hour, ScopeAuth)
+	require.NoError(t, err)
+
+	claims, err := manager.Verify(token.PlainText, ScopeAuth)
+	require.NoError(t, err)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, "john@example.com", claims.Email)
+
+	_, err = manager.Verify(token.PlainText, ScopeResetPassword)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// tokens signed with an older key stay valid after rotation
+	_, err = keyring.Rotate()
+	require.NoError(t, err)
+	_, err = manager.Verify(token.PlainText, ScopeAuth)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.Revoke(context.Background(), claims))
+	_, err = manager.Verify(token.PlainText, ScopeAuth)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	expired, err := manager.Issue(42, "john@example.com", -time.Minute, ScopeAuth)
+	require.NoError(t, err)
+	_, err = manager.Verify(expired.PlainText, ScopeAuth)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoadKeyringKeepsKeys(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadKeyring(dir)
+	require.NoError(t, err)
+	token, err := NewJWTManager(first, nil).Issue(1, "a@example.com", time.Hour, ScopeAuth)
+	require.NoError(t, err)
+
+	second, err := LoadKeyring(dir)
+	require.NoError(t, err)
+	_, err = NewJWTManager(second, nil).Verify(token.PlainText, ScopeAuth)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,40 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+)
+
+// storedScopes are the scopes of the tokens kept in the token store
+var storedScopes = []string{ScopeAuth, ScopeResetPassword, ScopeMFAChallenge}
+
+// TokenDeleter deletes the stored tokens of a user
+type TokenDeleter interface {
+	DeleteAllTokensForUser(ctx context.Context, userID int64, scope string) error
+}
+
+// Revoker ends every session of a user. The API and the users command both
+// go through it, so a password change revokes the same tokens either way.
+type Revoker struct {
+	Tokens TokenDeleter
+	// Denylist denies signed tokens, it is nil in opaque token mode
+	Denylist *SharedDenylist
+}
+
+// RevokeUser denies the signed tokens of the user and deletes their stored
+// tokens of every scope
+func (rv Revoker) RevokeUser(ctx context.Context, userID int64) error {
+	if rv.Denylist != nil {
+		err := rv.Denylist.RevokeUser(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("revoke signed tokens: %w", err)
+		}
+	}
+	for _, scope := range storedScopes {
+		err := rv.Tokens.DeleteAllTokensForUser(ctx, userID, scope)
+		if err != nil {
+			return fmt.Errorf("revoke %s tokens: %w", scope, err)
+		}
+	}
+	return nil
+}
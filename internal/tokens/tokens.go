@@ -4,10 +4,12 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"log/slog"
 	"time"
 )
 
 type Token struct {
+	ID        string    `json:"-"`
 	PlainText string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
@@ -16,10 +18,22 @@ type Token struct {
 }
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth          = "authentication"
 	ScopeResetPassword = "reset-password"
+	// ScopeMFAChallenge marks the short-lived token handed out after a correct
+	// password when the account still has to pass the second factor
+	ScopeMFAChallenge = "mfa-challenge"
 )
 
+// LogValue logs only the metadata of a token, never its plaintext or hash
+func (t *Token) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("user_id", t.UserID),
+		slog.String("scope", t.Scope),
+		slog.Time("expiry", t.Expiry),
+	)
+}
+
 func GenerateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token := &Token{
 		UserID: userID,
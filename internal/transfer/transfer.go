@@ -0,0 +1,309 @@
+// Package transfer moves the content of a database in and out as newline
+// delimited JSON. The first line is a header naming the format and its
+// version, every other line is one row of users, articles, paragraphs or
+// reviews, each table after the ones it references. Tokens, MFA secrets,
+// login failures, password history and pending erasures are left out, they
+// belong to the database they were made in.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/internal/validator"
+)
+
+const (
+	Format = "articles-export"
+	// Version is bumped whenever a change of the rows would break imports
+	// of older releases, imports accept every version up to it
+	Version = 1
+)
+
+// Header is the first line of an export
+type Header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// PasswordHashes tells whether user rows carry their password hashes
+	PasswordHashes bool `json:"password_hashes"`
+}
+
+// Row types
+const (
+	TypeUser      = "user"
+	TypeArticle   = "article"
+	TypeParagraph = "paragraph"
+	TypeReview    = "review"
+)
+
+// line is one row of an export, Type tells what Data holds
+type line struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Counts struct {
+	Users      int `json:"users"`
+	Articles   int `json:"articles"`
+	Paragraphs int `json:"paragraphs"`
+	Reviews    int `json:"reviews"`
+}
+
+type ExportOptions struct {
+	// PasswordHashes includes the password hashes of users, without them
+	// imported users have to reset their passwords
+	PasswordHashes bool
+}
+
+// Export writes every row of db to w from one consistent snapshot
+func Export(ctx context.Context, db *store.Database, w io.Writer, opts ExportOptions) (Counts, error) {
+	var counts Counts
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	err := encoder.Encode(Header{
+		Format:         Format,
+		Version:        Version,
+		ExportedAt:     time.Now().UTC(),
+		PasswordHashes: opts.PasswordHashes,
+	})
+	if err != nil {
+		return counts, err
+	}
+	write := func(typ string, data any) error {
+		return encoder.Encode(struct {
+			Type string `json:"type"`
+			Data any    `json:"data"`
+		}{typ, data})
+	}
+	err = db.ReadDump(ctx, func(r store.DumpReader) error {
+		err := r.Users(ctx, opts.PasswordHashes, func(user *store.DumpUser) error {
+			counts.Users++
+			return write(TypeUser, user)
+		})
+		if err != nil {
+			return fmt.Errorf("export users: %w", err)
+		}
+		err = r.Articles(ctx, func(article *store.DumpArticle) error {
+			counts.Articles++
+			return write(TypeArticle, article)
+		})
+		if err != nil {
+			return fmt.Errorf("export articles: %w", err)
+		}
+		err = r.Paragraphs(ctx, func(paragraph *store.DumpParagraph) error {
+			counts.Paragraphs++
+			return write(TypeParagraph, paragraph)
+		})
+		if err != nil {
+			return fmt.Errorf("export paragraphs: %w", err)
+		}
+		err = r.Reviews(ctx, func(review *store.DumpReview) error {
+			counts.Reviews++
+			return write(TypeReview, review)
+		})
+		if err != nil {
+			return fmt.Errorf("export reviews: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return counts, err
+	}
+	return counts, buffered.Flush()
+}
+
+type ImportOptions struct {
+	// DryRun reads and inserts everything, then rolls the transaction back
+	DryRun bool
+	// KeepAdmins keeps the admin flag of imported users, without it nobody
+	// gains admin rights through an import
+	KeepAdmins bool
+	// Hasher makes the random password hashes of users exported without one
+	Hasher passwords.Hasher
+}
+
+var ErrUnsupported = errors.New("unsupported export")
+
+// Import adds the rows read from r to db in one transaction, nothing is
+// kept when any row fails. Rows get new IDs and references are remapped to
+// them, so an export can go into a database that already has data, as long
+// as no email is taken. Rows are validated like the API validates requests.
+// Users exported without password hashes get a random one nobody knows and
+// have to reset their passwords.
+func Import(ctx context.Context, db *store.Database, r io.Reader, opts ImportOptions) (Counts, error) {
+	var counts Counts
+	reader := bufio.NewReader(r)
+	number := 0
+	next := func() ([]byte, error) {
+		for {
+			data, err := reader.ReadBytes('\n')
+			if len(data) == 0 && err != nil {
+				return nil, err
+			}
+			number++
+			data = bytes.TrimSpace(data)
+			if len(data) > 0 {
+				return data, nil
+			}
+		}
+	}
+
+	data, err := next()
+	if err == io.EOF {
+		return counts, fmt.Errorf("%w: empty input", ErrUnsupported)
+	}
+	if err != nil {
+		return counts, err
+	}
+	var header Header
+	err = json.Unmarshal(data, &header)
+	if err != nil || header.Format != Format {
+		return counts, fmt.Errorf("%w: line %d is not an %s header", ErrUnsupported, number, Format)
+	}
+	if header.Version < 1 || header.Version > Version {
+		return counts, fmt.Errorf("%w: version %d, this release reads up to %d", ErrUnsupported, header.Version, Version)
+	}
+
+	users := map[int64]int64{}
+	articles := map[int64]int64{}
+	var unusableHash []byte
+	err = db.WriteDump(ctx, !opts.DryRun, func(w store.DumpWriter) error {
+		for {
+			data, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var row line
+			err = json.Unmarshal(data, &row)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", number, err)
+			}
+			switch row.Type {
+			case TypeUser:
+				user := &store.DumpUser{}
+				err = json.Unmarshal(row.Data, user)
+				if err != nil {
+					break
+				}
+				v := validator.New()
+				store.ValidateUser(v, &store.User{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName})
+				err = v.Err()
+				if err != nil {
+					break
+				}
+				if !opts.KeepAdmins {
+					user.IsAdmin = false
+				}
+				if len(user.PasswordHash) == 0 {
+					if unusableHash == nil {
+						err = opts.Hasher.Validate()
+						if err != nil {
+							break
+						}
+						unusableHash, err = opts.Hasher.Hash(rand.Text())
+						if err != nil {
+							break
+						}
+					}
+					user.PasswordHash = unusableHash
+				}
+				var id int64
+				id, err = w.InsertUser(ctx, user)
+				users[user.ID] = id
+				counts.Users++
+			case TypeArticle:
+				article := &store.DumpArticle{}
+				err = json.Unmarshal(row.Data, article)
+				if err != nil {
+					break
+				}
+				// paragraphs follow on lines of their own
+				v := validator.New()
+				store.ValidateArticle(v, &store.Article{Title: article.Title, Image: article.Image})
+				err = v.Err()
+				if err != nil {
+					break
+				}
+				article.AuthorID, err = remap(users, article.AuthorID, TypeUser)
+				if err != nil {
+					break
+				}
+				var id int64
+				id, err = w.InsertArticle(ctx, article)
+				articles[article.ID] = id
+				counts.Articles++
+			case TypeParagraph:
+				paragraph := &store.DumpParagraph{}
+				err = json.Unmarshal(row.Data, paragraph)
+				if err != nil {
+					break
+				}
+				v := validator.New()
+				store.ValidateParagraph(v, "paragraph", &store.Paraghraph{Headline: paragraph.Headline, OrderIndex: paragraph.OrderIndex})
+				err = v.Err()
+				if err != nil {
+					break
+				}
+				paragraph.ArticleID, err = remap(articles, paragraph.ArticleID, TypeArticle)
+				if err != nil {
+					break
+				}
+				_, err = w.InsertParagraph(ctx, paragraph)
+				counts.Paragraphs++
+			case TypeReview:
+				review := &store.DumpReview{}
+				err = json.Unmarshal(row.Data, review)
+				if err != nil {
+					break
+				}
+				v := validator.New()
+				store.ValidateReview(v, &store.Review{Stars: review.Stars})
+				err = v.Err()
+				if err != nil {
+					break
+				}
+				review.ArticleID, err = remap(articles, review.ArticleID, TypeArticle)
+				if err != nil {
+					break
+				}
+				review.AuthorID, err = remap(users, review.AuthorID, TypeUser)
+				if err != nil {
+					break
+				}
+				_, err = w.InsertReview(ctx, review)
+				counts.Reviews++
+			default:
+				err = fmt.Errorf("unknown row type %q", row.Type)
+			}
+			if err != nil {
+				return fmt.Errorf("line %d: %w", number, err)
+			}
+		}
+	})
+	if err != nil {
+		return Counts{}, err
+	}
+	return counts, nil
+}
+
+// remap returns the new ID of a row imported earlier
+func remap(ids map[int64]int64, id int64, typ string) (int64, error) {
+	newID, ok := ids[id]
+	if !ok {
+		return 0, fmt.Errorf("%s %d is not in the export before this line", typ, id)
+	}
+	return newID, nil
+}
@@ -0,0 +1,194 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/passwords"
+	"github.com/makhammatovb/Articles/internal/seed"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+func openDB(t *testing.T) *store.Database {
+	t.Helper()
+	ctx := context.Background()
+	db, err := store.OpenDatabase(ctx, store.DriverSQLite, filepath.Join(t.TempDir(), "articles.db"), store.PoolOptions{})
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	db.QueryTimeout = 5 * time.Second
+	require.NoError(t, db.Migrate(ctx, migrations.FS))
+	return db
+}
+
+// fastHasher is the cheapest hash, it keeps the tests fast
+var fastHasher = passwords.Hasher{Algorithm: passwords.AlgorithmBcrypt, BcryptCost: 4}
+
+func seeded(t *testing.T) *store.Database {
+	t.Helper()
+	db := openDB(t)
+	_, err := seed.Run(context.Background(), seed.Stores{
+		Users:    store.NewSQLiteUserStore(db.SQL, fastHasher, db.QueryTimeout),
+		Articles: store.NewSQLiteArticleStore(db.SQL, db.QueryTimeout),
+		Reviews:  store.NewSQLiteReviewStore(db.SQL, db.QueryTimeout),
+	}, seed.Options{Seed: 7, Users: 5, Articles: 8, ReviewsPerArticle: 3, BatchSize: 10, Workers: 1, Password: "Secret123", Hasher: fastHasher})
+	require.NoError(t, err)
+	return db
+}
+
+func export(t *testing.T, db *store.Database, opts ExportOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	_, err := Export(context.Background(), db, &buf, opts)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// rows returns the lines of an export after its header, which holds the
+// export time
+func rows(t *testing.T, data []byte) []string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.NotEmpty(t, lines)
+	return lines[1:]
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := seeded(t)
+	data := export(t, source, ExportOptions{PasswordHashes: true})
+
+	target := openDB(t)
+	counts, err := Import(ctx, target, bytes.NewReader(data), ImportOptions{Hasher: fastHasher})
+	require.NoError(t, err)
+	assert.Equal(t, 5, counts.Users)
+	assert.Equal(t, 8, counts.Articles)
+	assert.Positive(t, counts.Paragraphs)
+	assert.Positive(t, counts.Reviews)
+
+	// both databases start their IDs at 1, so the rows come out the same
+	assert.Equal(t, rows(t, data), rows(t, export(t, target, ExportOptions{PasswordHashes: true})))
+
+	users := store.NewSQLiteUserStore(target.SQL, fastHasher, target.QueryTimeout)
+	listed, err := users.ListUsers(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, listed)
+	user, err := users.GetUserByEmail(ctx, listed[0].Email)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	ok, err := user.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestImportRemapsIDs(t *testing.T) {
+	ctx := context.Background()
+	data := export(t, seeded(t), ExportOptions{})
+
+	target := openDB(t)
+	existing := &store.User{Email: "existing@example.com", FirstName: "Existing", LastName: "User"}
+	require.NoError(t, existing.PasswordHash.Set(fastHasher, "Secret123"))
+	require.NoError(t, store.NewSQLiteUserStore(target.SQL, fastHasher, target.QueryTimeout).CreateUser(ctx, existing))
+
+	_, err := Import(ctx, target, bytes.NewReader(data), ImportOptions{Hasher: fastHasher})
+	require.NoError(t, err)
+
+	articles := store.NewSQLiteArticleStore(target.SQL, target.QueryTimeout)
+	users := store.NewSQLiteUserStore(target.SQL, fastHasher, target.QueryTimeout)
+	article, err := articles.GetArticleByID(ctx, 1)
+	require.NoError(t, err)
+	require.NotNil(t, article)
+	author, err := users.GetUserByID(ctx, int64(article.AuthorID))
+	require.NoError(t, err)
+	require.NotNil(t, author)
+	author, err = users.GetUserByEmail(ctx, author.Email)
+	require.NoError(t, err)
+	assert.NotEqual(t, existing.ID, author.ID)
+
+	// exported without hashes, the old password no longer works
+	ok, err := author.PasswordHash.Matches("Secret123")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestImportDryRun(t *testing.T) {
+	ctx := context.Background()
+	data := export(t, seeded(t), ExportOptions{})
+
+	target := openDB(t)
+	counts, err := Import(ctx, target, bytes.NewReader(data), ImportOptions{DryRun: true, Hasher: fastHasher})
+	require.NoError(t, err)
+	assert.Equal(t, 5, counts.Users)
+	assert.Empty(t, rows(t, export(t, target, ExportOptions{})))
+}
+
+func TestImportRollsBack(t *testing.T) {
+	ctx := context.Background()
+	data := export(t, seeded(t), ExportOptions{})
+	broken := string(data) + `{"type":"review","data":{"id":99,"article_id":1000,"author_id":1,"stars":4}}` + "\n"
+
+	target := openDB(t)
+	_, err := Import(ctx, target, strings.NewReader(broken), ImportOptions{Hasher: fastHasher})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "article 1000")
+	assert.Empty(t, rows(t, export(t, target, ExportOptions{})))
+}
+
+func TestImportValidatesRows(t *testing.T) {
+	data := string(export(t, seeded(t), ExportOptions{}))
+	tests := []struct {
+		name string
+		row  string
+		want string
+	}{
+		{name: "user", row: `{"type":"user","data":{"id":99,"email":"not-an-email","firstname":"A","lastname":"B"}}`, want: "email must be a valid email address"},
+		{name: "article", row: `{"type":"article","data":{"id":99,"author_id":1,"title":" "}}`, want: "title is required"},
+		{name: "paragraph", row: `{"type":"paragraph","data":{"id":99,"article_id":1,"headline":"H","order_index":-1}}`, want: "paragraph.order_index must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := openDB(t)
+			_, err := Import(context.Background(), target, strings.NewReader(data+tt.row+"\n"), ImportOptions{Hasher: fastHasher})
+			assert.ErrorContains(t, err, tt.want)
+			assert.Empty(t, rows(t, export(t, target, ExportOptions{})))
+		})
+	}
+}
+
+func TestImportClearsAdmins(t *testing.T) {
+	ctx := context.Background()
+	source := openDB(t)
+	admin := &store.User{Email: "admin@example.com", FirstName: "Ada", LastName: "Admin", IsAdmin: true}
+	require.NoError(t, admin.PasswordHash.Set(fastHasher, "Secret123"))
+	require.NoError(t, store.NewSQLiteUserStore(source.SQL, fastHasher, source.QueryTimeout).CreateUser(ctx, admin))
+	data := export(t, source, ExportOptions{})
+
+	for _, keep := range []bool{false, true} {
+		target := openDB(t)
+		_, err := Import(ctx, target, bytes.NewReader(data), ImportOptions{KeepAdmins: keep, Hasher: fastHasher})
+		require.NoError(t, err)
+		imported, err := store.NewSQLiteUserStore(target.SQL, fastHasher, target.QueryTimeout).GetUserByEmail(ctx, admin.Email)
+		require.NoError(t, err)
+		require.NotNil(t, imported)
+		assert.Equal(t, keep, imported.IsAdmin)
+	}
+}
+
+func TestImportRejectsUnknownFormat(t *testing.T) {
+	target := openDB(t)
+	for _, input := range []string{
+		"",
+		`{"type":"user","data":{}}`,
+		`{"format":"articles-export","version":2}`,
+	} {
+		_, err := Import(context.Background(), target, strings.NewReader(input), ImportOptions{Hasher: fastHasher})
+		assert.ErrorIs(t, err, ErrUnsupported, input)
+	}
+}
@@ -2,10 +2,20 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/netip"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
 )
 
 // JSON format representor, keys are strings, values can be any type
@@ -13,6 +23,11 @@ type Envelope map[string]interface{}
 
 // WriteJSON sends JSON response to the client
 func WriteJSON(w http.ResponseWriter, status int, data Envelope) {
+	// a 204 has no body, not even a JSON null
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
 	// MarshalIndent formats the JSON with indentation for better readability
 	js, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
@@ -25,6 +40,93 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) {
 	w.Write(js)
 }
 
+// ReadJSON decodes the JSON body of r into dst. The body must be sent as
+// application/json, fit in maxBytes, hold exactly one value and only
+// fields dst has. The errors are *apierr.Error values that tell the client
+// what is wrong with the body.
+func ReadJSON(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return apierr.New(http.StatusUnsupportedMediaType, apierr.CodeUnsupportedMedia, "Content-Type must be application/json")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err != nil {
+		return bodyError(err)
+	}
+	// anything but the end of the body after the value is a second value
+	// or garbage
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return bodyError(err)
+		}
+		return invalidBody("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+// bodyError describes why decoding a body failed
+func bodyError(err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	var maxBytesError *http.MaxBytesError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	switch {
+	case errors.As(err, &syntaxError):
+		return invalidBody(fmt.Sprintf("body contains badly-formed JSON (at character %d)", syntaxError.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return invalidBody("body contains badly-formed JSON")
+	case errors.As(err, &typeError):
+		if typeError.Field != "" {
+			return invalidBody(fmt.Sprintf("body contains the wrong type for field %q, expected %s but got %s", typeError.Field, jsonType(typeError.Type), typeError.Value))
+		}
+		return invalidBody(fmt.Sprintf("body must be a JSON %s (at character %d)", jsonType(typeError.Type), typeError.Offset))
+	case errors.Is(err, io.EOF):
+		return invalidBody("body must not be empty")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return invalidBody("body contains unknown field " + field)
+	case errors.As(err, &maxBytesError):
+		return apierr.New(http.StatusRequestEntityTooLarge, apierr.CodeBodyTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit))
+	case errors.As(err, &invalidUnmarshalError):
+		// a non-pointer dst is a bug in the handler
+		panic(err)
+	default:
+		return err
+	}
+}
+
+func invalidBody(detail string) error {
+	return apierr.BadRequest(apierr.CodeInvalidRequest, detail)
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
 // ReadIDParam reads the "id" parameter from the URL and converts it to int64
 func ReadIDParam(r *http.Request) (int64, error) {
 	idParam := chi.URLParam(r, "id")
@@ -39,9 +141,82 @@ func ReadIDParam(r *http.Request) (int64, error) {
 }
 
 func ReadTokenParam(r *http.Request) (string, error) {
-    token := chi.URLParam(r, "token")
-    if token == "" {
-        return "", http.ErrNoLocation
-    }
-    return token, nil
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		return "", http.ErrNoLocation
+	}
+	return token, nil
+}
+
+// ClientIPResolver finds the address of the client behind a request. The
+// forwarding header is only believed when the connection comes from one of
+// the trusted proxies, otherwise any client could pick its own address. The
+// zero value uses the remote end of the connection.
+type ClientIPResolver struct {
+	// Header lists the addresses a request passed through, like
+	// X-Forwarded-For, every proxy appends the address it received from
+	Header         string
+	TrustedProxies []netip.Prefix
+}
+
+// NewClientIPResolver parses the trusted proxies, each one is an IP address
+// or a CIDR range
+func NewClientIPResolver(header string, trustedProxies []string) (ClientIPResolver, error) {
+	resolver := ClientIPResolver{Header: header}
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return ClientIPResolver{}, fmt.Errorf("trusted proxy %q is neither an IP address nor a CIDR range", proxy)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		resolver.TrustedProxies = append(resolver.TrustedProxies, prefix.Masked())
+	}
+	return resolver, nil
+}
+
+// ClientIP returns the IP address of the client. It walks the header from
+// the right, skipping trusted proxies, and stops at the first address a
+// trusted proxy received from something it does not trust.
+func (c ClientIPResolver) ClientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err == nil {
+		ip = host
+	}
+	if c.Header == "" || !c.trusted(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values(c.Header), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// a garbled entry cannot be followed any further
+			return ip
+		}
+		ip = hop
+		if !c.trusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func (c ClientIPResolver) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/makhammatovb/Articles/internal/apierr"
+)
+
+func TestReadJSON(t *testing.T) {
+	type paragraph struct {
+		Headline string `json:"headline"`
+	}
+	type article struct {
+		Title      string      `json:"title"`
+		Stars      int         `json:"stars"`
+		Paragraphs []paragraph `json:"paragraphs"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantDetail  string
+	}{
+		{name: "valid", contentType: "application/json", body: `{"title":"Go","stars":5}`},
+		{name: "charset parameter", contentType: "application/json; charset=utf-8", body: `{"title":"Go"}`},
+		{name: "missing content type", body: `{"title":"Go"}`, wantStatus: http.StatusUnsupportedMediaType, wantDetail: "Content-Type must be application/json"},
+		{name: "form content type", contentType: "application/x-www-form-urlencoded", body: `title=Go`, wantStatus: http.StatusUnsupportedMediaType, wantDetail: "Content-Type must be application/json"},
+		{name: "empty", contentType: "application/json", body: ``, wantStatus: http.StatusBadRequest, wantDetail: "body must not be empty"},
+		{name: "syntax error", contentType: "application/json", body: `{"title":"Go",}`, wantStatus: http.StatusBadRequest, wantDetail: "body contains badly-formed JSON (at character 15)"},
+		{name: "truncated", contentType: "application/json", body: `{"title":"Go"`, wantStatus: http.StatusBadRequest, wantDetail: "body contains badly-formed JSON"},
+		{name: "wrong type for field", contentType: "application/json", body: `{"stars":"five"}`, wantStatus: http.StatusBadRequest, wantDetail: `body contains the wrong type for field "stars", expected number but got string`},
+		{name: "wrong type for nested field", contentType: "application/json", body: `{"paragraphs":[{"headline":1}]}`, wantStatus: http.StatusBadRequest, wantDetail: `body contains the wrong type for field "paragraphs.0.headline", expected string but got number`},
+		{name: "wrong top level type", contentType: "application/json", body: `["Go"]`, wantStatus: http.StatusBadRequest, wantDetail: "body must be a JSON object (at character 1)"},
+		{name: "unknown field", contentType: "application/json", body: `{"title":"Go","is_admin":true}`, wantStatus: http.StatusBadRequest, wantDetail: `body contains unknown field "is_admin"`},
+		{name: "two values", contentType: "application/json", body: `{"title":"Go"}{"title":"Rust"}`, wantStatus: http.StatusBadRequest, wantDetail: "body must only contain a single JSON value"},
+		{name: "trailing garbage", contentType: "application/json", body: `{"title":"Go"} x`, wantStatus: http.StatusBadRequest, wantDetail: "body must only contain a single JSON value"},
+		{name: "too large", contentType: "application/json", body: `{"title":"` + strings.Repeat("a", 100) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantDetail: "body must not be larger than 64 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/articles/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var dst article
+			err := ReadJSON(httptest.NewRecorder(), r, &dst, 64)
+			if tt.wantStatus == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, "Go", dst.Title)
+				return
+			}
+			var apiErr *apierr.Error
+			require.True(t, errors.As(err, &apiErr), "got %v", err)
+			assert.Equal(t, tt.wantStatus, apiErr.Status)
+			assert.Equal(t, tt.wantDetail, apiErr.Detail)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	resolver, err := NewClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/8", "192.0.2.7"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		resolver   ClientIPResolver
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "no proxies", resolver: ClientIPResolver{}, remoteAddr: "198.51.100.1:4000", forwarded: []string{"203.0.113.9"}, want: "198.51.100.1"},
+		{name: "untrusted peer", resolver: resolver, remoteAddr: "198.51.100.1:4000", forwarded: []string{"203.0.113.9"}, want: "198.51.100.1"},
+		{name: "trusted peer", resolver: resolver, remoteAddr: "10.1.2.3:4000", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "spoofed left entries", resolver: resolver, remoteAddr: "10.1.2.3:4000", forwarded: []string{"1.1.1.1, 203.0.113.9, 192.0.2.7"}, want: "203.0.113.9"},
+		{name: "repeated header", resolver: resolver, remoteAddr: "10.1.2.3:4000", forwarded: []string{"1.1.1.1", "203.0.113.9"}, want: "203.0.113.9"},
+		{name: "only proxies", resolver: resolver, remoteAddr: "10.1.2.3:4000", forwarded: []string{"10.0.0.5, 192.0.2.7"}, want: "10.0.0.5"},
+		{name: "garbled entry", resolver: resolver, remoteAddr: "10.1.2.3:4000", forwarded: []string{"nonsense"}, want: "10.1.2.3"},
+		{name: "no header", resolver: resolver, remoteAddr: "10.1.2.3:4000", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, tt.want, tt.resolver.ClientIP(r))
+		})
+	}
+
+	_, err = NewClientIPResolver("X-Forwarded-For", []string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+// Package validator collects the field errors of a request, so a client
+// learns about every invalid field at once instead of one per round trip.
+//
+// Rules are declared one per line against a Validator and the outcome is
+// read once at the end:
+//
+//	v := validator.New()
+//	v.Required("title", article.Title)
+//	v.MaxLength("title", article.Title, 255)
+//	if err := v.Err(); err != nil {
+//		return err
+//	}
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Code identifies why a field is invalid, codes are part of the API
+type Code string
+
+const (
+	CodeRequired      Code = "required"
+	CodeInvalidFormat Code = "invalid_format"
+	CodeTooLong       Code = "too_long"
+	CodeOutOfRange    Code = "out_of_range"
+	CodeMismatch      Code = "mismatch"
+	CodeTaken         Code = "taken"
+	CodeWeakPassword  Code = "weak_password"
+	CodeUnknown       Code = "unknown"
+)
+
+// EmailRX matches the email addresses accounts may be registered with
+var EmailRX = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+
+// FieldError is one invalid field, Field is its JSON name and nested
+// fields are written as paraghraps[0].headline
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors is the error a failed validation returns
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validator collects field errors. The rule methods skip fields that
+// already failed, so an empty field is reported as required and not also
+// as malformed.
+type Validator struct {
+	errors Errors
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+// Valid reports whether no rule failed
+func (v *Validator) Valid() bool {
+	return len(v.errors) == 0
+}
+
+// Err returns the collected errors as Errors, nil when there are none
+func (v *Validator) Err() error {
+	if v.Valid() {
+		return nil
+	}
+	return v.errors
+}
+
+// Add records an error for field, even if the field already has one
+func (v *Validator) Add(field string, code Code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check records an error for field unless ok or the field already failed
+func (v *Validator) Check(ok bool, field string, code Code, message string) {
+	if ok || v.failed(field) {
+		return
+	}
+	v.Add(field, code, message)
+}
+
+func (v *Validator) failed(field string) bool {
+	for _, fieldErr := range v.errors {
+		if fieldErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Required fails for values that are empty or only whitespace
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, CodeRequired, field+" is required")
+}
+
+// MaxLength fails for values longer than max characters
+func (v *Validator) MaxLength(field, value string, max int) {
+	v.Check(utf8.RuneCountInString(value) <= max, field, CodeTooLong, fmt.Sprintf("%s must be at most %d characters long", field, max))
+}
+
+// Between fails for values outside min..max
+func (v *Validator) Between(field string, value, min, max int) {
+	v.Check(value >= min && value <= max, field, CodeOutOfRange, fmt.Sprintf("%s must be between %d and %d", field, min, max))
+}
+
+// Email fails for values that are not an email address
+func (v *Validator) Email(field, value string) {
+	v.Check(EmailRX.MatchString(value), field, CodeInvalidFormat, field+" must be a valid email address")
+}
+
+// Equal fails when value differs from the one it must repeat
+func (v *Validator) Equal(field, value, other, message string) {
+	v.Check(value == other, field, CodeMismatch, message)
+}
@@ -0,0 +1,38 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	assert.True(t, v.Valid())
+	assert.NoError(t, v.Err())
+
+	v.Required("email", "  ")
+	v.Email("email", "  ")
+	v.Email("backup_email", "not-an-email")
+	v.MaxLength("title", strings.Repeat("é", 11), 10)
+	v.MaxLength("headline", strings.Repeat("é", 10), 10)
+	v.Between("stars", 6, 1, 5)
+	v.Equal("confirm_password", "a", "b", "passwords do not match")
+	v.Add("password", CodeWeakPassword, "password must contain a digit")
+	v.Add("password", CodeWeakPassword, "password must contain a symbol")
+
+	assert.False(t, v.Valid())
+	var errs Errors
+	assert.ErrorAs(t, v.Err(), &errs)
+	assert.Equal(t, Errors{
+		{Field: "email", Code: CodeRequired, Message: "email is required"},
+		{Field: "backup_email", Code: CodeInvalidFormat, Message: "backup_email must be a valid email address"},
+		{Field: "title", Code: CodeTooLong, Message: "title must be at most 10 characters long"},
+		{Field: "stars", Code: CodeOutOfRange, Message: "stars must be between 1 and 5"},
+		{Field: "confirm_password", Code: CodeMismatch, Message: "passwords do not match"},
+		{Field: "password", Code: CodeWeakPassword, Message: "password must contain a digit"},
+		{Field: "password", Code: CodeWeakPassword, Message: "password must contain a symbol"},
+	}, errs)
+	assert.Equal(t, "email is required; backup_email must be a valid email address; title must be at most 10 characters long; stars must be between 1 and 5; passwords do not match; password must contain a digit; password must contain a symbol", errs.Error())
+}
@@ -1,43 +1,154 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/makhammatovb/Articles/internal/routes"
 	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/routes"
 )
 
-// main function to start the server server
+const usage = `Usage: articles [command] [flags] [arguments]
+
+Commands:
+  serve                  start the HTTP server (default)
+  migrate up             apply all pending migrations
+  migrate down           roll back the latest migration
+  migrate redo           roll back the latest migration and apply it again
+  migrate status         list migrations and whether they are applied
+  migrate create NAME    add an empty migration for Postgres and for SQLite
+  users list             list every account
+  users create-admin EMAIL
+                         create an administrator
+  users reset-password USER
+                         set a new password and revoke the user's tokens
+  users disable USER     block logins and revoke the user's tokens
+  users enable USER      allow a disabled user to log in again
+  users revoke-tokens USER
+                         revoke every stored token of the user
+  seed                   fill the database with generated users, articles
+                         and reviews for development and load testing
+  export [FILE]          write users, articles, paragraphs and reviews as
+                         newline delimited JSON, to stdout without FILE
+  import [FILE]          add an export to the database in one transaction,
+                         read from stdin without FILE
+  version                print the build version
+
+USER is a user ID or an email. Passwords are read from the first line of
+stdin, on a terminal a random one is generated and printed.
+
+Run "articles <command> -h" to list the flags of a command.
+`
+
+// main picks the command from the first argument, flags without a command
+// start the server as before commands existed
 func main() {
-	// defines a command-line flag for the port number, defaulting to 8080 if not provided
-	var port int
-	flag.IntVar(&port, "port", 8080, "Port to run the server on")
-	flag.Parse()
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		os.Exit(serve(args))
+	case "migrate":
+		os.Exit(migrate(args))
+	case "users":
+		os.Exit(users(args))
+	case "seed":
+		os.Exit(seedDatabase(args))
+	case "export":
+		os.Exit(exportDatabase(args))
+	case "import":
+		os.Exit(importDatabase(args))
+	case "version":
+		os.Exit(printVersion())
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// serve runs the server until SIGINT or SIGTERM and returns the exit code
+func serve(args []string) int {
+	// loads settings from the config file, environment and command-line flags
+	cfg, err := config.Load("articles serve", args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
 	// creates a new instance of the application and checks for errors
-	app, err := app.NewApplication()
+	app, err := app.NewApplication(cfg)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
 	// sets up the routes using the chi router and the application instance
 	r := routes.SetupRoutes(app)
 	// configures and starts the HTTP server with specified timeouts
 	server := &http.Server{
-		Addr:       fmt.Sprintf(":%d", port),
-		Handler:    r,
-		IdleTimeout: time.Minute,
-		ReadTimeout: time.Second * 10,
-		WriteTimeout: time.Second * 30,
-	}
-	// logs any fatal errors
-	app.Logger.Printf("Listening on port %d", port)
-	// starts the server and logs any errors
+		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:      r,
+		ErrorLog:     slog.NewLogLogger(app.Logger.Handler(), slog.LevelError),
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	// on SIGINT or SIGTERM stops accepting connections and gives in-flight
+	// requests up to the shutdown timeout to finish
+	shutdownErr := make(chan error, 1)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		app.Logger.Info("draining requests", "signal", s.String())
+		app.BeginShutdown()
+		if cfg.Server.DrainDelay > 0 {
+			// readiness fails from now on, keep serving until load balancers
+			// have noticed and stopped sending new requests
+			app.Logger.Info("waiting before closing the listener", "drain_delay", cfg.Server.DrainDelay)
+			time.Sleep(cfg.Server.DrainDelay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+
+	app.StartBackgroundJobs()
+	app.Logger.Info("listening", "port", cfg.Server.Port)
+	// starts the server and logs any fatal errors
 	err = server.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		app.Logger.Error("server failed", "error", err)
+		return 1
+	}
+
+	exitCode := 0
+	err = <-shutdownErr
+	if err != nil {
+		app.Logger.Error("requests did not drain in time", "error", err)
+		exitCode = 1
+	}
+	// background workers and the database pool go last, after every request is done
+	err = app.Close()
 	if err != nil {
-		app.Logger.Fatal(err)
+		app.Logger.Error("error closing application", "error", err)
+		exitCode = 1
 	}
+	app.Logger.Info("server stopped")
+	return exitCode
 }
 
 // Comment from Asilbek
\ No newline at end of file
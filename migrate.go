@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+// migrationsDir is where migrate create writes, relative to the repository root
+const migrationsDir = "migrations"
+
+// migrationTemplate follows the layout of the existing migration files
+var migrationTemplate = template.Must(template.New("migration").Parse(`-- +goose Up
+-- +goose StatementBegin
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- +goose StatementEnd
+`))
+
+// migrate runs one migrate action and returns the exit code
+func migrate(args []string) int {
+	cfg, args, err := config.LoadArgs("articles migrate", args, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	action, args := args[0], args[1:]
+	if action == "create" {
+		return createMigration(args)
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "migrate %s takes no arguments\n", action)
+		return 2
+	}
+
+	ctx := context.Background()
+	db, err := store.OpenDatabase(ctx, cfg.Database.Driver, cfg.Database.DSN, cfg.Database.PoolOptions())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	migrator, err := db.Migrator(migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer migrator.Close()
+
+	var results []*goose.MigrationResult
+	switch action {
+	case "up":
+		results, err = migrator.Up(ctx)
+		if err == nil && len(results) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		var result *goose.MigrationResult
+		result, err = migrator.Down(ctx)
+		if result != nil {
+			results = append(results, result)
+		}
+	case "redo":
+		results, err = migrator.Redo(ctx)
+	case "status":
+		err = printMigrationStatus(ctx, migrator)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q\n\n%s", action, usage)
+		return 2
+	}
+	for _, result := range results {
+		printMigrationResult(result)
+	}
+	if err != nil {
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Println("no migrations to roll back")
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationResult(result *goose.MigrationResult) {
+	status := "OK"
+	if result.Error != nil {
+		status = "FAILED"
+	}
+	fmt.Printf("%-6s %-4s %s (%s)\n", status, result.Direction, filepath.Base(result.Source.Path), result.Duration.Round(time.Millisecond))
+}
+
+func printMigrationStatus(ctx context.Context, migrator *store.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tFILE")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, filepath.Base(status.Source.Path))
+	}
+	return w.Flush()
+}
+
+// createMigration adds the next numbered migration for every driver, the
+// Postgres and SQLite sets keep the same versions so neither falls behind.
+// The migrations are embedded, the binary has to be rebuilt to apply them.
+func createMigration(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: articles migrate create NAME")
+		return 2
+	}
+	dirs := []string{migrationsDir, filepath.Join(migrationsDir, "sqlite")}
+	var last int64
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "%s not found, run migrate create from the repository root\n", dir)
+			return 1
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, entry := range entries {
+			version, err := goose.NumericComponent(entry.Name())
+			if err == nil && version > last {
+				last = version
+			}
+		}
+	}
+	name := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(args[0]))
+	var created []string
+	for _, dir := range dirs {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.sql", last+1, name))
+		err := writeMigration(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			// don't leave one dialect with a migration the other lacks
+			for _, path := range created {
+				os.Remove(path)
+			}
+			return 1
+		}
+		created = append(created, path)
+	}
+	for _, path := range created {
+		fmt.Println("created", path)
+	}
+	return 0
+}
+
+func writeMigration(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	err = migrationTemplate.Execute(file, nil)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
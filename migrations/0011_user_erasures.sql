@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+
+CREATE TABLE IF NOT EXISTS user_erasures (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    requested_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    erase_after TIMESTAMP WITH TIME ZONE NOT NULL,
+    keep_articles BOOLEAN NOT NULL,
+    keep_reviews BOOLEAN NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_erasures_erase_after_idx ON user_erasures (erase_after);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_erasures;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- no foreign key, the revocation has to outlive an erased user
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id BIGINT PRIMARY KEY,
+    issued_before TIMESTAMP WITH TIME ZONE NOT NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_token_revocations_expiry_idx ON user_token_revocations (expiry);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_token_revocations;
+-- +goose StatementEnd
@@ -2,5 +2,7 @@ package migrations
 
 import "embed"
 
-//go:embed *.sql
+// FS holds the Postgres migrations at its root and the SQLite ones in sqlite/
+//
+//go:embed *.sql sqlite/*.sql
 var FS embed.FS
\ No newline at end of file
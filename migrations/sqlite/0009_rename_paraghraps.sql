@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE paraghraps RENAME TO paragraphs;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS paragraphs_article_id_idx ON paragraphs (article_id, order_index);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS paragraphs_article_id_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE paragraphs RENAME TO paraghraps;
+-- +goose StatementEnd
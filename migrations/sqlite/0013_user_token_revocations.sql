@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- no foreign key, the revocation has to outlive an erased user
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id INTEGER PRIMARY KEY,
+    issued_before TIMESTAMP NOT NULL,
+    expiry TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_token_revocations_expiry_idx ON user_token_revocations (expiry);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_token_revocations;
+-- +goose StatementEnd
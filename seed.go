@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/seed"
+	"github.com/makhammatovb/Articles/internal/store"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+// seedDatabase fills the configured database with generated data and
+// returns the exit code
+func seedDatabase(args []string) int {
+	opts := seed.Options{}
+	cfg, args, err := config.LoadArgs("articles seed", args, func(fs *flag.FlagSet) {
+		fs.Uint64Var(&opts.Seed, "seed", 1, "Seed value, the same seed generates the same data")
+		fs.IntVar(&opts.Users, "users", 100, "Number of users")
+		fs.IntVar(&opts.Articles, "articles", 500, "Number of articles")
+		fs.Float64Var(&opts.ReviewsPerArticle, "reviews-per-article", 5, "Average number of reviews of an article")
+		fs.IntVar(&opts.BatchSize, "batch-size", 500, "Users or articles inserted in one transaction")
+		fs.IntVar(&opts.Workers, "workers", 0, "Batches inserted at the same time, 0 picks one for SQLite and 8 for Postgres")
+		fs.StringVar(&opts.Password, "password", "Password123", "Password of every generated user")
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "seed takes no arguments")
+		return 2
+	}
+	if opts.Workers == 0 {
+		// SQLite has a single writer, more workers would only wait for it
+		opts.Workers = 8
+		if cfg.Database.Driver == store.DriverSQLite {
+			opts.Workers = 1
+		}
+	}
+	opts.Hasher = cfg.Security.PasswordHasher()
+	opts.Progress = func(kind string, done, total int) {
+		fmt.Fprintf(os.Stderr, "%s %d/%d\n", kind, done, total)
+	}
+
+	ctx := context.Background()
+	db, stores, err := app.OpenStores(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	if cfg.Database.AutoMigrate {
+		err = db.Migrate(ctx, migrations.FS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	start := time.Now()
+	result, err := seed.Run(ctx, seed.Stores{Users: stores.Users, Articles: stores.Articles, Reviews: stores.Reviews}, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("seeded %d users, %d articles, %d paragraphs and %d reviews in %s\n",
+		result.Users, result.Articles, result.Paragraphs, result.Reviews, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("every user logs in with the password %q\n", opts.Password)
+	return 0
+}
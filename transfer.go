@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/transfer"
+	"github.com/makhammatovb/Articles/migrations"
+)
+
+// exportDatabase writes the content of the configured database to the file
+// given as argument, or stdout, and returns the exit code
+func exportDatabase(args []string) int {
+	opts := transfer.ExportOptions{}
+	cfg, args, err := config.LoadArgs("articles export", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&opts.PasswordHashes, "with-password-hashes", false, "Include password hashes, keep the export as secret as the database")
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "export takes at most one FILE")
+		return 2
+	}
+
+	ctx := context.Background()
+	db, _, err := app.OpenStores(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if len(args) == 1 && args[0] != "-" {
+		// the file may hold password hashes, only the owner reads it
+		file, err = os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	counts, err := transfer.Export(ctx, db, out, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if file != nil {
+		err = file.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	// stdout may be the export itself
+	fmt.Fprintf(os.Stderr, "exported %d users, %d articles, %d paragraphs and %d reviews\n",
+		counts.Users, counts.Articles, counts.Paragraphs, counts.Reviews)
+	return 0
+}
+
+// importDatabase adds the content of an export, read from the file given as
+// argument or stdin, to the configured database and returns the exit code
+func importDatabase(args []string) int {
+	opts := transfer.ImportOptions{}
+	cfg, args, err := config.LoadArgs("articles import", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&opts.DryRun, "dry-run", false, "Check the export and roll back instead of committing, the schema is not migrated")
+		fs.BoolVar(&opts.KeepAdmins, "keep-admin", false, "Keep the admin flag of imported users, by default nobody is admin after an import")
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "import takes at most one FILE")
+		return 2
+	}
+	opts.Hasher = cfg.Security.PasswordHasher()
+
+	var in io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	ctx := context.Background()
+	db, _, err := app.OpenStores(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	// a dry run applies no migrations, the schema has to be current already
+	if cfg.Database.AutoMigrate && !opts.DryRun {
+		err = db.Migrate(ctx, migrations.FS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		current, expected, err := db.MigrationVersions(ctx, migrations.FS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if current != expected {
+			fmt.Fprintf(os.Stderr, "database schema is at version %d, the import needs version %d, run the migrate command first\n", current, expected)
+			return 1
+		}
+	}
+
+	counts, err := transfer.Import(ctx, db, in, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import failed, nothing was written:", err)
+		return 1
+	}
+	verb := "imported"
+	if opts.DryRun {
+		verb = "dry run, would import"
+	}
+	fmt.Printf("%s %d users, %d articles, %d paragraphs and %d reviews\n",
+		verb, counts.Users, counts.Articles, counts.Paragraphs, counts.Reviews)
+	return 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/makhammatovb/Articles/internal/admin"
+	"github.com/makhammatovb/Articles/internal/app"
+	"github.com/makhammatovb/Articles/internal/config"
+	"github.com/makhammatovb/Articles/internal/tokens"
+)
+
+// users runs one account management action and returns the exit code,
+// USER arguments are a user ID or an email
+func users(args []string) int {
+	cfg, args, err := config.LoadArgs("articles users", args, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	action, args := args[0], args[1:]
+	wantArgs := 1
+	if action == "list" {
+		wantArgs = 0
+	}
+	if len(args) != wantArgs {
+		fmt.Fprintf(os.Stderr, "wrong number of arguments for users %s\n\n%s", action, usage)
+		return 2
+	}
+
+	policy, err := cfg.Security.PasswordPolicy()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx := context.Background()
+	db, stores, err := app.OpenStores(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	manager := &admin.Manager{Users: stores.Users, Tokens: stores.Tokens, Policy: policy, Hasher: cfg.Security.PasswordHasher()}
+	if cfg.Tokens.Mode == tokens.ModeJWT {
+		manager.Denylist = tokens.NewSharedDenylist(stores.Tokens, cfg.Tokens.AuthTTL)
+	}
+
+	switch action {
+	case "list":
+		err = listUsers(ctx, manager)
+	case "create-admin":
+		err = createAdmin(ctx, manager, args[0])
+	case "reset-password", "disable", "enable", "revoke-tokens":
+		err = manageUser(ctx, manager, action, args[0], manager.Denylist != nil, cfg.Tokens.DenylistSyncInterval)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown users action %q\n\n%s", action, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func listUsers(ctx context.Context, manager *admin.Manager) error {
+	all, err := manager.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tADMIN\tDISABLED\tCREATED AT")
+	for _, user := range all {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%t\t%s\n", user.ID, user.Email, user.IsAdmin, user.Disabled, user.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func createAdmin(ctx context.Context, manager *admin.Manager, email string) error {
+	password, generated, err := readPassword(manager)
+	if err != nil {
+		return err
+	}
+	user, err := manager.CreateAdmin(ctx, email, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created admin %s with ID %d\n", user.Email, user.ID)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+	return nil
+}
+
+// manageUser applies an action to one user, signedTokens tells whether auth
+// tokens are JWTs, which running servers only deny after their next sync
+func manageUser(ctx context.Context, manager *admin.Manager, action, ref string, signedTokens bool, syncInterval time.Duration) error {
+	user, err := manager.FindUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "reset-password":
+		password, generated, err := readPassword(manager)
+		if err != nil {
+			return err
+		}
+		err = manager.ResetPassword(ctx, user, password)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reset the password of %s and revoked their tokens\n", user.Email)
+		if generated {
+			fmt.Printf("password: %s\n", password)
+		}
+	case "disable":
+		err = manager.SetDisabled(ctx, user, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("disabled %s and revoked their tokens\n", user.Email)
+	case "enable":
+		err = manager.SetDisabled(ctx, user, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("enabled %s\n", user.Email)
+	case "revoke-tokens":
+		err = manager.RevokeTokens(ctx, user)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("revoked the tokens of %s\n", user.Email)
+	}
+	if signedTokens && action != "enable" {
+		fmt.Printf("running servers stop accepting their signed auth tokens within %s\n", syncInterval)
+	}
+	return nil
+}
+
+// readPassword takes the password from the first line of stdin when it is
+// piped in, on a terminal it generates one so it never lands in shell history
+func readPassword(manager *admin.Manager) (string, bool, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		password, err := manager.GeneratePassword(20)
+		return password, true, err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", false, fmt.Errorf("no password on stdin")
+	}
+	return password, false, nil
+}
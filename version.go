@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is set when building releases with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+func printVersion() int {
+	revision := "unknown"
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	fmt.Printf("articles %s (revision %s, %s)\n", version, revision, runtime.Version())
+	return 0
+}